@@ -0,0 +1,210 @@
+// Package certs builds TLS configurations from the certificate files of the sharding config.
+// The files are watched and reloaded when they change, so certificates can be rotated without a restart.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader holds the current node certificate and cluster CA.
+type Reloader struct {
+	cfg config.TLS
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+
+	stop chan struct{}
+}
+
+// NewReloader loads the certificate, key and CA files. It fails if any of them cannot be loaded.
+func NewReloader(cfg config.TLS) (*Reloader, error) {
+	r := &Reloader{
+		cfg:      cfg,
+		modTimes: make(map[string]time.Time),
+		stop:     make(chan struct{}),
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading the certificate %s: %w", r.cfg.CertFile, err)
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("reading the CA %s: %w", r.cfg.CAFile, err)
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificate found in the CA %s", r.cfg.CAFile)
+		}
+	}
+
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.modTimes = modTimes
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.CAFile != "" {
+		files = append(files, r.cfg.CAFile)
+	}
+	return files
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks the files every interval and reloads them when one changed, until Close is called.
+// A failed reload keeps serving the previous certificates.
+func (r *Reloader) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+
+			if err := r.load(); err != nil {
+				slog.Error("Could not reload the TLS certificates, keeping the previous ones", "error", err)
+				continue
+			}
+			slog.Info("Reloaded the TLS certificates", "file", r.cfg.CertFile)
+		}
+	}
+}
+
+// Close stops watching the files.
+func (r *Reloader) Close() {
+	close(r.stop)
+}
+
+func (r *Reloader) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+func (r *Reloader) roots() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// ServerConfig returns the configuration of a listener. With requireClientCert, only clients
+// presenting a certificate signed by the cluster CA can connect.
+func (r *Reloader) ServerConfig(requireClientCert bool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+	}
+
+	if requireClientCert {
+		// the chain is verified against the current CA, which may be reloaded
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return r.verify(rawCerts)
+		}
+	}
+
+	return cfg
+}
+
+// PeerConfig returns the configuration for connections to other nodes. The node presents its own
+// certificate and accepts peers whose certificate is signed by the cluster CA, whatever address they are dialed on.
+func (r *Reloader) PeerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+		// the chain is verified against the current CA, which may be reloaded
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return r.verify(rawCerts)
+		},
+	}
+}
+
+// verify checks that the presented chain is signed by the cluster CA.
+func (r *Reloader) verify(rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no certificate was presented")
+	}
+
+	// without a CA file, the system roots are used
+	roots := r.roots()
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
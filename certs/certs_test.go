@@ -0,0 +1,194 @@
+package certs_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/EliriaT/distributed-store/certs"
+	"github.com/EliriaT/distributed-store/config"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T, name string) authority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate the CA key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create the CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a node certificate signed by the authority and returns the config pointing at it.
+func (a authority) issue(t *testing.T, dir, name string, serial int64) config.TLS {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate the node key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatalf("Could not create the node certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Could not encode the node key: %v", err)
+	}
+
+	cfg := config.TLS{
+		CertFile:  filepath.Join(dir, name+".crt"),
+		KeyFile:   filepath.Join(dir, name+".key"),
+		CAFile:    filepath.Join(dir, "ca.crt"),
+		MutualTLS: true,
+	}
+	write(t, cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	write(t, cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	write(t, cfg.CAFile, a.pem)
+
+	return cfg
+}
+
+func write(t *testing.T, name string, contents []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(name, contents, 0600); err != nil {
+		t.Fatalf("Could not write %s: %v", name, err)
+	}
+}
+
+// handshake connects a client to a server over TLS and returns the handshake error, if any.
+func handshake(t *testing.T, server, client *tls.Config) error {
+	t.Helper()
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	defer lis.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err == nil {
+		// the server verifies the client certificate after the client finished its side
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+
+	if err = <-serverErr; err != nil {
+		return err
+	}
+	return nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newAuthority(t, "cluster")
+
+	node0, err := certs.NewReloader(ca.issue(t, dir, "node0", 2))
+	if err != nil {
+		t.Fatalf("Could not load the node0 certificates: %v", err)
+	}
+	node1, err := certs.NewReloader(ca.issue(t, dir, "node1", 3))
+	if err != nil {
+		t.Fatalf("Could not load the node1 certificates: %v", err)
+	}
+
+	if err = handshake(t, node0.ServerConfig(true), node1.PeerConfig()); err != nil {
+		t.Errorf("A peer with a cluster certificate should connect: %v", err)
+	}
+
+	if err = handshake(t, node0.ServerConfig(true), &tls.Config{InsecureSkipVerify: true}); err == nil {
+		t.Errorf("A client without a certificate should be rejected")
+	}
+
+	other := newAuthority(t, "other")
+	stranger, err := certs.NewReloader(other.issue(t, t.TempDir(), "stranger", 4))
+	if err != nil {
+		t.Fatalf("Could not load the stranger certificates: %v", err)
+	}
+	if err = handshake(t, node0.ServerConfig(true), stranger.PeerConfig()); err == nil {
+		t.Errorf("A client with a certificate of another CA should be rejected")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newAuthority(t, "cluster")
+	cfg := ca.issue(t, dir, "node0", 2)
+
+	reloader, err := certs.NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("Could not load the certificates: %v", err)
+	}
+	go reloader.Watch(10 * time.Millisecond)
+	defer reloader.Close()
+
+	before, _ := reloader.ServerConfig(false).GetCertificate(nil)
+
+	// make sure the modification time changes
+	time.Sleep(20 * time.Millisecond)
+	ca.issue(t, dir, "node0", 5)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		after, _ := reloader.ServerConfig(false).GetCertificate(nil)
+		if after != before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Errorf("The certificate was not reloaded after the files changed")
+}
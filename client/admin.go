@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"sync"
+	"time"
+)
+
+// Maintenance operations a node can run on its local keys.
+const (
+	// OperationPurge deletes the keys the node does not own.
+	OperationPurge = "purge"
+	// OperationRepair pushes the keys the node is a replica for to the other replicas.
+	OperationRepair = "repair"
+	// OperationRebalance moves the keys the node is no longer a replica for to their replicas.
+	OperationRebalance = "rebalance"
+)
+
+// NodeStatus is the state of one node as seen by the client.
+type NodeStatus struct {
+	Shard     int           `json:"shard"`
+	Name      string        `json:"name"`
+	Address   string        `json:"address"`
+	Reachable bool          `json:"reachable"`
+	Latency   time.Duration `json:"latency"`
+	Keys      int           `json:"keys"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// OperationResult is the outcome of a maintenance operation on one node.
+type OperationResult struct {
+	Shard int    `json:"shard"`
+	Name  string `json:"name"`
+	Keys  int    `json:"keys"`
+	Error string `json:"error,omitempty"`
+}
+
+// LogLevelResult is the log level of one node.
+type LogLevelResult struct {
+	Shard int    `json:"shard"`
+	Name  string `json:"name"`
+	Level string `json:"level"`
+	Error string `json:"error,omitempty"`
+}
+
+// Topology returns the cluster config the client routes with.
+func (c *Client) Topology() config.Config {
+	return c.cfg
+}
+
+// Status asks every node for its key count, in shard order. Unreachable nodes are reported, not returned as an error.
+func (c *Client) Status(ctx context.Context) []NodeStatus {
+	statuses := make([]NodeStatus, len(c.cfg.Shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range c.cfg.Shards {
+		wg.Add(1)
+		go func(i int, shard config.Shard) {
+			defer wg.Done()
+
+			attemptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			keys, err := c.transport.stats(attemptCtx, shard.Address)
+
+			statuses[i] = NodeStatus{
+				Shard:     shard.Idx,
+				Name:      shard.Name,
+				Address:   shard.Address,
+				Reachable: err == nil,
+				Latency:   time.Since(start),
+				Keys:      keys,
+			}
+			if err != nil {
+				statuses[i].Error = err.Error()
+			}
+		}(i, shard)
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+// Run runs a maintenance operation on the given shards, or on every shard when none is given.
+func (c *Client) Run(ctx context.Context, operation string, shards ...int) ([]OperationResult, error) {
+	switch operation {
+	case OperationPurge, OperationRepair, OperationRebalance:
+	default:
+		return nil, fmt.Errorf("unknown operation %q", operation)
+	}
+
+	if len(shards) == 0 {
+		for _, shard := range c.cfg.Shards {
+			shards = append(shards, shard.Idx)
+		}
+	}
+
+	results := make([]OperationResult, 0, len(shards))
+	for _, shard := range shards {
+		addr, ok := c.address(shard)
+		if !ok {
+			return results, fmt.Errorf("shard %d is not found", shard)
+		}
+
+		keys, err := c.transport.admin(ctx, addr, operation)
+
+		result := OperationResult{Shard: shard, Name: c.cfg.GetShardName(shard), Keys: keys}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// LogLevel changes the log level of the given shards, or of every shard when none is given, and returns the level
+// each of them logs at. An empty level only reports the levels.
+func (c *Client) LogLevel(ctx context.Context, level string, shards ...int) ([]LogLevelResult, error) {
+	if len(shards) == 0 {
+		for _, shard := range c.cfg.Shards {
+			shards = append(shards, shard.Idx)
+		}
+	}
+
+	results := make([]LogLevelResult, 0, len(shards))
+	for _, shard := range shards {
+		addr, ok := c.address(shard)
+		if !ok {
+			return results, fmt.Errorf("shard %d is not found", shard)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		current, err := c.transport.logLevel(attemptCtx, addr, level)
+		cancel()
+
+		result := LogLevelResult{Shard: shard, Name: c.cfg.GetShardName(shard), Level: current}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,399 @@
+// Package client is a Go client for the distributed store. It loads the cluster topology, hashes keys
+// with the same consistent hashing the nodes use and sends every request straight to a replica of the key,
+// so the replica coordinates the request itself and no extra hop through another node is needed.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/session"
+	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/sharding"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HTTPTransport = "http"
+	GRPCTransport = "grpc"
+)
+
+var (
+	// ErrNotFound is returned by Get when the key does not exist.
+	ErrNotFound = errors.New("key not found")
+	// ErrUnauthenticated is returned when the node rejects the API key or token of the client.
+	ErrUnauthenticated = errors.New("missing or invalid credentials")
+	// ErrForbidden is returned when the principal of the client may not do the operation on the key.
+	ErrForbidden = errors.New("access denied")
+	// ErrQuotaExceeded is returned when the request is over a rate, storage or value size limit of the cluster.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrUnknownNamespace is returned by Namespace for a namespace the cluster config does not define.
+	ErrUnknownNamespace = errors.New("unknown namespace")
+)
+
+// KeyValue is a key with its value, as returned by MGet and Scan.
+type KeyValue = db.KeyValue
+
+// transport sends single requests to one node. Every node can coordinate any request.
+type transport interface {
+	get(ctx context.Context, addr, namespace, session, key string, linearizable bool) (value []byte, found bool, err error)
+	// set and delete return the session token including the write
+	set(ctx context.Context, addr, namespace, mode, session, key string, value []byte) (string, error)
+	delete(ctx context.Context, addr, namespace, mode, session, key string) (string, error)
+	scan(ctx context.Context, addr, namespace, prefix string, limit int) ([]KeyValue, error)
+	stats(ctx context.Context, addr string) (keys int, err error)
+	admin(ctx context.Context, addr string, operation string) (keys int, err error)
+	logLevel(ctx context.Context, addr, level string) (string, error)
+	close() error
+}
+
+// Client routes requests to the replicas of a key and retries on the other replicas when one fails.
+type Client struct {
+	cfg               config.Config
+	sharder           sharding.Sharder
+	transport         transport
+	replicationFactor int
+	timeout           time.Duration
+	namespace         string
+	mode              string
+	linearizable      bool
+	session           *sessionState
+}
+
+// sessionState holds the token of a session, shared by the copies of the client made after it started.
+type sessionState struct {
+	mu    sync.Mutex
+	token session.Token
+}
+
+// get returns the encoded token of the session, empty for a client outside a session.
+func (s *sessionState) get() string {
+	if s == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token.String()
+}
+
+// update merges the token returned by a write into the session. The writes of a session may run concurrently,
+// so a token never replaces the one of another write.
+func (s *sessionState) update(encoded string) {
+	token, err := session.ParseToken(encoded)
+	if s == nil || err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = s.token.Merge(token)
+}
+
+type options struct {
+	transport  string
+	timeout    time.Duration
+	httpClient *http.Client
+	tlsConfig  *tls.Config
+	headers    map[string]string
+}
+
+// Option configures a Client.
+type Option func(*options)
+
+// WithTransport selects the "http" or "grpc" transport. By default, the transport_protocol of the cluster config is used.
+func WithTransport(transport string) Option {
+	return func(o *options) {
+		o.transport = strings.ToLower(transport)
+	}
+}
+
+// WithTimeout sets the timeout of a single attempt against one replica. It defaults to 2 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithHTTPClient sets the http.Client used by the HTTP transport.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithTLSConfig connects to the nodes over TLS. A client passed to WithHTTPClient must set up TLS itself.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+// WithAPIKey authenticates the requests with an API key.
+func WithAPIKey(apiKey string) Option {
+	return func(o *options) {
+		o.headers["x-api-key"] = apiKey
+	}
+}
+
+// WithBearerToken authenticates the requests with a JWT.
+func WithBearerToken(token string) Option {
+	return func(o *options) {
+		o.headers["authorization"] = "Bearer " + token
+	}
+}
+
+// New creates a client for the cluster described by cfg.
+func New(cfg config.Config, opts ...Option) (*Client, error) {
+	o := options{
+		transport: strings.ToLower(cfg.TransportProtocol),
+		timeout:   2 * time.Second,
+		headers:   make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if len(cfg.Shards) == 0 {
+		return nil, errors.New("the cluster config has no shards")
+	}
+
+	var t transport
+	switch o.transport {
+	case HTTPTransport, "":
+		t = newHTTPTransport(o.httpClient, o.tlsConfig, o.headers)
+	case GRPCTransport:
+		t = newGRPCTransport(o.tlsConfig, o.headers)
+	default:
+		return nil, fmt.Errorf("unsupported transport %q. Allowed: http/grpc", o.transport)
+	}
+
+	replicationFactor := cfg.ReplicationFactor
+	if replicationFactor < 1 {
+		replicationFactor = 1
+	}
+
+	return &Client{
+		cfg:               cfg,
+		sharder:           sharding.NewConsistentHasher(cfg),
+		transport:         t,
+		replicationFactor: replicationFactor,
+		timeout:           o.timeout,
+	}, nil
+}
+
+// NewFromFile creates a client for the cluster described by a sharding config file.
+func NewFromFile(filename string, opts ...Option) (*Client, error) {
+	cfg, err := config.ParseFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(cfg, opts...)
+}
+
+// Namespace returns a client for the keys of the namespace. It shares the connections of c,
+// so closing either of them closes both. An empty name is the default namespace. It fails with ErrUnknownNamespace
+// for a namespace the cluster config does not define.
+func (c *Client) Namespace(name string) (*Client, error) {
+	ns, ok := c.cfg.GetNamespace(name)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownNamespace, name)
+	}
+
+	scoped := *c
+	scoped.namespace = name
+	scoped.replicationFactor = max(ns.ReplicationFactor, 1)
+	return &scoped, nil
+}
+
+// WriteMode returns a client whose writes wait for what the mode names: "one", "quorum", "all", "async" or "any".
+// An empty mode waits for the consistency level of the namespace. It shares the connections of c, like Namespace.
+func (c *Client) WriteMode(mode string) *Client {
+	scoped := *c
+	scoped.mode = mode
+	return &scoped
+}
+
+// Linearizable returns a client whose reads see every write that completed before them, by ordering a barrier
+// on the key through the consensus module ahead of reading. The reads are slower, and need a cluster with the
+// consensus replication. It shares the connections of c, like Namespace.
+func (c *Client) Linearizable() *Client {
+	scoped := *c
+	scoped.linearizable = true
+	return &scoped
+}
+
+// Session returns a client whose reads see the writes made through it, whatever node coordinates them, by sending
+// the session token of its writes with every request. A non-empty token continues the session it was taken from
+// with SessionToken. The client shares the connections of c, like Namespace.
+func (c *Client) Session(token string) (*Client, error) {
+	parsed, err := session.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := *c
+	scoped.session = &sessionState{token: parsed}
+	return &scoped, nil
+}
+
+// SessionToken returns the token of the session of the client, empty outside a session.
+func (c *Client) SessionToken() string {
+	return c.session.get()
+}
+
+// Close releases the connections held by the client.
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+// Get returns the value of the key, or ErrNotFound.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	var found bool
+
+	err := c.withReplicas(ctx, key, func(ctx context.Context, addr string) (err error) {
+		value, found, err = c.transport.get(ctx, addr, c.namespace, c.session.get(), key, c.linearizable)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+// Set writes the value of the key. It succeeds once the consistency level of the namespace, or what the write mode
+// of the client waits for, is reached.
+func (c *Client) Set(ctx context.Context, key string, value []byte) error {
+	return c.withReplicas(ctx, key, func(ctx context.Context, addr string) error {
+		token, err := c.transport.set(ctx, addr, c.namespace, c.mode, c.session.get(), key, value)
+		if err == nil {
+			c.session.update(token)
+		}
+		return err
+	})
+}
+
+// Delete removes the key. Deleting a missing key is not an error.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.withReplicas(ctx, key, func(ctx context.Context, addr string) error {
+		token, err := c.transport.delete(ctx, addr, c.namespace, c.mode, c.session.get(), key)
+		if err == nil {
+			c.session.update(token)
+		}
+		return err
+	})
+}
+
+// MGet gets the keys in parallel and returns the ones that exist, in the order they were requested.
+func (c *Client) MGet(ctx context.Context, keys ...string) ([]KeyValue, error) {
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			values[i], errs[i] = c.Get(ctx, key)
+		}(i, key)
+	}
+	wg.Wait()
+
+	result := make([]KeyValue, 0, len(keys))
+	for i, key := range keys {
+		if errors.Is(errs[i], ErrNotFound) {
+			continue
+		}
+		if errs[i] != nil {
+			return nil, fmt.Errorf("get %q: %w", key, errs[i])
+		}
+		result = append(result, KeyValue{Key: key, Value: values[i]})
+	}
+
+	return result, nil
+}
+
+// Scan returns up to limit keys starting with prefix, in key order. A limit of 0 returns all of them.
+// The node receiving the scan merges the keys of all shards.
+func (c *Client) Scan(ctx context.Context, prefix string, limit int) ([]KeyValue, error) {
+	var items []KeyValue
+	var lastErr error
+
+	for _, shard := range c.cfg.Shards {
+		attemptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		items, lastErr = c.transport.scan(attemptCtx, shard.Address, c.namespace, prefix, limit)
+		cancel()
+
+		if lastErr == nil {
+			return items, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if rejected(lastErr) {
+			return nil, lastErr
+		}
+	}
+
+	return nil, lastErr
+}
+
+// withReplicas calls do against the replicas of the key in ring order until one succeeds.
+func (c *Client) withReplicas(ctx context.Context, key string, do func(ctx context.Context, addr string) error) error {
+	replicas, err := c.sharder.GetNReplicas(key, c.replicationFactor)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, replica := range replicas {
+		addr, ok := c.address(replica)
+		if !ok {
+			continue
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		lastErr = do(attemptCtx, addr)
+		cancel()
+
+		if lastErr == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// every replica checks the same credentials and quotas, so retrying would not help
+		if rejected(lastErr) {
+			return lastErr
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no address for the replicas %v of key %q", replicas, key)
+	}
+	return lastErr
+}
+
+func rejected(err error) bool {
+	return errors.Is(err, ErrUnauthenticated) || errors.Is(err, ErrForbidden) || errors.Is(err, ErrQuotaExceeded)
+}
+
+func (c *Client) address(shardIdx int) (string, bool) {
+	for _, shard := range c.cfg.Shards {
+		if shard.Idx == shardIdx {
+			return shard.Address, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,338 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/EliriaT/distributed-store/client"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/session"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeNode answers the JSON node API from an in memory map, or fails every request when down.
+type fakeNode struct {
+	mu     sync.Mutex
+	values map[string]string
+	down   bool
+	calls  int
+	// mode is the write mode of the last write, session the session token of the last request, and linearizable
+	// the option of the last read
+	mode         string
+	session      string
+	linearizable string
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.calls++
+	if n.down {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// the keys of other namespaces are stored as namespace/key
+	ns := r.URL.Query().Get("namespace")
+	key := r.URL.Query().Get("key")
+	if ns != "" {
+		key = ns + "/" + key
+	}
+	if strings.HasPrefix(key, "secret:") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if strings.HasPrefix(key, "slow:") {
+		w.WriteHeader(http.StatusGatewayTimeout)
+		json.NewEncoder(w).Encode(map[string]any{"error": "context deadline exceeded"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	n.session = r.URL.Query().Get("session")
+
+	switch r.URL.Path {
+	case "/get":
+		n.linearizable = r.URL.Query().Get("linearizable")
+		value, ok := n.values[key]
+		json.NewEncoder(w).Encode(map[string]any{"key": key, "value": value, "found": ok})
+	case "/set":
+		n.mode = r.URL.Query().Get("mode")
+		n.values[key] = r.URL.Query().Get("value")
+		// every write moves the mark of the node in the session token
+		token := session.Token{0: {Position: uint64(n.calls)}}
+		json.NewEncoder(w).Encode(map[string]any{"replicated_on": []int{0}, "session": token.String()})
+	case "/delete":
+		n.mode = r.URL.Query().Get("mode")
+		delete(n.values, key)
+		json.NewEncoder(w).Encode(map[string]any{"replicated_on": []int{0}})
+	case "/scan":
+		var items []map[string]any
+		for k, v := range n.values {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				items = append(items, map[string]any{"key": k, "value": []byte(v)})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"items": items})
+	case "/stats", "/purge", "/repair", "/rebalance":
+		json.NewEncoder(w).Encode(map[string]any{"keys": len(n.values)})
+	}
+}
+
+func createCluster(t *testing.T, nodes ...*fakeNode) *client.Client {
+	t.Helper()
+
+	cfg := config.Config{
+		ReplicationFactor: len(nodes),
+		ConsistencyLevel:  1,
+		TransportProtocol: "http",
+		Namespaces:        []config.Namespace{{Name: "cache"}},
+	}
+
+	names := []string{"Chisinau", "Balti", "Orhei"}
+	for i, node := range nodes {
+		ts := httptest.NewServer(node)
+		t.Cleanup(ts.Close)
+
+		cfg.Shards = append(cfg.Shards, config.Shard{
+			Idx:     i,
+			Name:    names[i],
+			Address: strings.TrimPrefix(ts.URL, "http://"),
+		})
+	}
+
+	c, err := client.New(cfg)
+	if err != nil {
+		t.Fatalf("Could not create the client: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestClientGetSetDelete(t *testing.T) {
+	c := createCluster(t, &fakeNode{values: map[string]string{}})
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "utm", []byte("fcim")); err != nil {
+		t.Fatalf("Could not set the key: %v", err)
+	}
+
+	value, err := c.Get(ctx, "utm")
+	if err != nil {
+		t.Fatalf("Could not get the key: %v", err)
+	}
+	if string(value) != "fcim" {
+		t.Errorf("Unexpected value: got %q, want %q", value, "fcim")
+	}
+
+	if err = c.Delete(ctx, "utm"); err != nil {
+		t.Fatalf("Could not delete the key: %v", err)
+	}
+
+	if _, err = c.Get(ctx, "utm"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Unexpected error after delete: got %v, want %v", err, client.ErrNotFound)
+	}
+}
+
+func TestClientRetriesOtherReplicas(t *testing.T) {
+	values := map[string]string{"utm": "fcim"}
+	first := &fakeNode{values: values, down: true}
+	second := &fakeNode{values: values, down: true}
+	c := createCluster(t, first, second)
+
+	// whichever replica is tried first, one of them is down
+	first.down = false
+	value, err := c.Get(context.Background(), "utm")
+	if err != nil {
+		t.Fatalf("Get should have been retried on the healthy replica: %v", err)
+	}
+	if string(value) != "fcim" {
+		t.Errorf("Unexpected value: got %q, want %q", value, "fcim")
+	}
+
+	first.down = true
+	if _, err = c.Get(context.Background(), "utm"); err == nil {
+		t.Errorf("Get should fail when every replica is down")
+	}
+}
+
+func TestClientMGetAndScan(t *testing.T) {
+	c := createCluster(t, &fakeNode{values: map[string]string{"user:1": "a", "user:2": "b", "city:1": "c"}})
+	ctx := context.Background()
+
+	got, err := c.MGet(ctx, "user:2", "missing", "user:1")
+	if err != nil {
+		t.Fatalf("Could not mget: %v", err)
+	}
+	if len(got) != 2 || got[0].Key != "user:2" || got[1].Key != "user:1" {
+		t.Errorf("Unexpected mget result: %v", got)
+	}
+
+	items, err := c.Scan(ctx, "user:", 0)
+	if err != nil {
+		t.Fatalf("Could not scan: %v", err)
+	}
+	if len(items) != 2 {
+		t.Errorf("Unexpected scan result: got %d items, want %d", len(items), 2)
+	}
+}
+
+func TestClientStatusAndRun(t *testing.T) {
+	healthy := &fakeNode{values: map[string]string{"utm": "fcim"}}
+	c := createCluster(t, healthy, &fakeNode{values: map[string]string{}, down: true})
+	ctx := context.Background()
+
+	statuses := c.Status(ctx)
+	if len(statuses) != 2 {
+		t.Fatalf("Unexpected number of statuses: got %d, want %d", len(statuses), 2)
+	}
+	if !statuses[0].Reachable || statuses[0].Keys != 1 {
+		t.Errorf("Unexpected status of the healthy node: %+v", statuses[0])
+	}
+	if statuses[1].Reachable || statuses[1].Error == "" {
+		t.Errorf("Unexpected status of the node that is down: %+v", statuses[1])
+	}
+
+	results, err := c.Run(ctx, client.OperationRepair, 0)
+	if err != nil {
+		t.Fatalf("Could not run repair: %v", err)
+	}
+	if len(results) != 1 || results[0].Shard != 0 || results[0].Error != "" {
+		t.Errorf("Unexpected repair results: %+v", results)
+	}
+
+	if _, err = c.Run(ctx, "format"); err == nil {
+		t.Errorf("Running an unknown operation should fail")
+	}
+}
+
+func TestClientDoesNotRetryDeniedRequests(t *testing.T) {
+	first := &fakeNode{values: map[string]string{}}
+	second := &fakeNode{values: map[string]string{}}
+	c := createCluster(t, first, second)
+
+	if _, err := c.Get(context.Background(), "secret:1"); !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("Unexpected error: got %v, want %v", err, client.ErrForbidden)
+	}
+	if calls := first.calls + second.calls; calls != 1 {
+		t.Errorf("A denied request should not be retried: got %d calls, want %d", calls, 1)
+	}
+}
+
+func TestClientDeadlineExceeded(t *testing.T) {
+	c := createCluster(t, &fakeNode{values: map[string]string{}})
+
+	if _, err := c.Get(context.Background(), "slow:1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error: got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClientNamespace(t *testing.T) {
+	c := createCluster(t, &fakeNode{values: map[string]string{}})
+	cache, err := c.Namespace("cache")
+	if err != nil {
+		t.Fatalf("Could not scope the client to the namespace: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := c.Namespace("unknown"); !errors.Is(err, client.ErrUnknownNamespace) {
+		t.Errorf("Unexpected error for an unknown namespace: got %v, want %v", err, client.ErrUnknownNamespace)
+	}
+
+	if err := cache.Set(ctx, "utm", []byte("cached")); err != nil {
+		t.Fatalf("Could not set the key: %v", err)
+	}
+
+	if _, err := c.Get(ctx, "utm"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("The key of the cache namespace should not be in the default namespace, got %v", err)
+	}
+
+	value, err := cache.Get(ctx, "utm")
+	if err != nil {
+		t.Fatalf("Could not get the key: %v", err)
+	}
+	if string(value) != "cached" {
+		t.Errorf("Unexpected value: got %q, want %q", value, "cached")
+	}
+}
+
+func TestClientWriteMode(t *testing.T) {
+	node := &fakeNode{values: map[string]string{}}
+	c := createCluster(t, node)
+	ctx := context.Background()
+
+	if err := c.WriteMode("any").Set(ctx, "utm", []byte("fcim")); err != nil {
+		t.Fatalf("Could not set the key: %v", err)
+	}
+	if node.mode != "any" {
+		t.Errorf("The set was sent with mode %q, want %q", node.mode, "any")
+	}
+
+	if err := c.Delete(ctx, "utm"); err != nil {
+		t.Fatalf("Could not delete the key: %v", err)
+	}
+	if node.mode != "" {
+		t.Errorf("The write mode leaked into the parent client: %q", node.mode)
+	}
+}
+
+func TestClientSession(t *testing.T) {
+	node := &fakeNode{values: map[string]string{}}
+	c := createCluster(t, node)
+	ctx := context.Background()
+
+	s, err := c.Session("")
+	if err != nil {
+		t.Fatalf("Could not start a session: %v", err)
+	}
+	if err := s.Set(ctx, "utm", []byte("fcim")); err != nil {
+		t.Fatalf("Could not set the key: %v", err)
+	}
+
+	token := s.SessionToken()
+	if token == "" {
+		t.Fatalf("The write did not return a session token")
+	}
+	if _, err := s.Get(ctx, "utm"); err != nil {
+		t.Fatalf("Could not get the key: %v", err)
+	}
+	if node.session != token {
+		t.Errorf("The read was sent with session %q, want %q", node.session, token)
+	}
+
+	resumed, err := c.Session(token)
+	if err != nil || resumed.SessionToken() != token {
+		t.Errorf("The resumed session has token %q, %v, want %q", resumed.SessionToken(), err, token)
+	}
+	if _, err := c.Get(ctx, "utm"); err != nil || node.session != "" {
+		t.Errorf("A client outside the session sent the session %q, %v", node.session, err)
+	}
+	if _, err := c.Session("not a token"); err == nil {
+		t.Errorf("A malformed session token was accepted")
+	}
+}
+
+func TestClientLinearizable(t *testing.T) {
+	node := &fakeNode{values: map[string]string{"utm": "fcim"}}
+	c := createCluster(t, node)
+	ctx := context.Background()
+
+	if value, err := c.Linearizable().Get(ctx, "utm"); err != nil || string(value) != "fcim" {
+		t.Fatalf("Linearizable get = %q, %v", value, err)
+	}
+	if node.linearizable != "true" {
+		t.Errorf("The read was sent with linearizable %q, want %q", node.linearizable, "true")
+	}
+
+	if _, err := c.Get(ctx, "utm"); err != nil {
+		t.Fatalf("Could not get the key: %v", err)
+	}
+	if node.linearizable != "" {
+		t.Errorf("The linearizable option leaked into the parent client: %q", node.linearizable)
+	}
+}
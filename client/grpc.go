@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/coordinator/grpc/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+)
+
+type grpcTransport struct {
+	mu      sync.Mutex
+	conns   map[string]*grpc.ClientConn
+	creds   credentials.TransportCredentials
+	headers headerCredentials
+}
+
+func newGRPCTransport(tlsConfig *tls.Config, headers map[string]string) *grpcTransport {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	return &grpcTransport{conns: make(map[string]*grpc.ClientConn), creds: creds, headers: headers}
+}
+
+// headerCredentials sends the API key or token as metadata of every call.
+type headerCredentials map[string]string
+
+func (h headerCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return h, nil
+}
+
+// RequireTransportSecurity is false so that clusters without TLS can still authenticate the callers.
+func (h headerCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// statusError wraps the Unauthenticated, PermissionDenied, ResourceExhausted and DeadlineExceeded statuses into
+// ErrUnauthenticated, ErrForbidden, ErrQuotaExceeded and context.DeadlineExceeded.
+func statusError(err error) error {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %s", context.DeadlineExceeded, status.Convert(err).Message())
+	case codes.Unauthenticated:
+		return fmt.Errorf("%w: %s", ErrUnauthenticated, status.Convert(err).Message())
+	case codes.PermissionDenied:
+		return fmt.Errorf("%w: %s", ErrForbidden, status.Convert(err).Message())
+	case codes.ResourceExhausted:
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, status.Convert(err).Message())
+	}
+	return err
+}
+
+// node returns a client for the node, reusing one long lived connection per address.
+func (t *grpcTransport) node(addr string) (proto.NodeServiceClient, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conn, ok := t.conns[addr]
+	if !ok {
+		var err error
+		conn, err = grpc.NewClient(addr, grpc.WithTransportCredentials(t.creds), grpc.WithPerRPCCredentials(t.headers),
+			grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				return statusError(invoker(ctx, method, req, reply, cc, opts...))
+			}))
+		if err != nil {
+			return nil, err
+		}
+		t.conns[addr] = conn
+	}
+
+	return proto.NewNodeServiceClient(conn), nil
+}
+
+func (t *grpcTransport) get(ctx context.Context, addr, namespace, session, key string, linearizable bool) ([]byte, bool, error) {
+	node, err := t.node(addr)
+	if err != nil {
+		return nil, false, err
+	}
+
+	response, err := node.Get(ctx, &proto.GetRequest{Key: key, Namespace: namespace, Session: session, Linearizable: linearizable})
+	if status.Code(err) == codes.NotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return []byte(response.Value), true, nil
+}
+
+func (t *grpcTransport) set(ctx context.Context, addr, namespace, mode, session, key string, value []byte) (string, error) {
+	node, err := t.node(addr)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := node.Set(ctx, &proto.SetRequest{Key: key, Value: string(value), Namespace: namespace, Mode: mode, Session: session})
+	if err != nil {
+		return "", err
+	}
+	return response.Session, nil
+}
+
+func (t *grpcTransport) delete(ctx context.Context, addr, namespace, mode, session, key string) (string, error) {
+	node, err := t.node(addr)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := node.Delete(ctx, &proto.DeleteRequest{Key: key, Namespace: namespace, Mode: mode, Session: session})
+	if err != nil {
+		return "", err
+	}
+	return response.Session, nil
+}
+
+func (t *grpcTransport) scan(ctx context.Context, addr, namespace, prefix string, limit int) ([]KeyValue, error) {
+	node, err := t.node(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := node.Scan(ctx, &proto.ScanRequest{Prefix: prefix, Limit: int32(limit), Namespace: namespace})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	var items []KeyValue
+	for {
+		item, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, statusError(err)
+		}
+		items = append(items, KeyValue{Key: item.Key, Value: item.Value})
+	}
+}
+
+func (t *grpcTransport) stats(ctx context.Context, addr string) (int, error) {
+	node, err := t.node(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := node.Stats(ctx, &proto.Empty{})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(response.Keys), nil
+}
+
+func (t *grpcTransport) admin(ctx context.Context, addr string, operation string) (int, error) {
+	node, err := t.node(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	var response *proto.StatusResponse
+	switch operation {
+	case OperationPurge:
+		response, err = node.DeleteExtraKeys(ctx, &proto.Empty{})
+	case OperationRepair:
+		response, err = node.Repair(ctx, &proto.Empty{})
+	case OperationRebalance:
+		response, err = node.Rebalance(ctx, &proto.Empty{})
+	default:
+		return 0, fmt.Errorf("unknown operation %q", operation)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return int(response.Keys), nil
+}
+
+func (t *grpcTransport) logLevel(ctx context.Context, addr, level string) (string, error) {
+	node, err := t.node(addr)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := node.LogLevel(ctx, &proto.LogLevelRequest{Level: level})
+	if err != nil {
+		return "", err
+	}
+
+	return response.Level, nil
+}
+
+func (t *grpcTransport) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var err error
+	for addr, conn := range t.conns {
+		err = errors.Join(err, conn.Close())
+		delete(t.conns, addr)
+	}
+	return err
+}
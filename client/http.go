@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getResponse, writeResponse and scanResponse mirror the JSON bodies of the node HTTP API.
+type getResponse struct {
+	Value string `json:"value"`
+	Found bool   `json:"found"`
+}
+
+type writeResponse struct {
+	ReplicatedOn []int  `json:"replicated_on"`
+	Session      string `json:"session"`
+}
+
+type scanResponse struct {
+	Items []KeyValue `json:"items"`
+	Error string     `json:"error"`
+}
+
+type adminResponse struct {
+	Keys int `json:"keys"`
+}
+
+type logLevelResponse struct {
+	Level string `json:"level"`
+}
+
+type httpTransport struct {
+	client  *http.Client
+	scheme  string
+	headers map[string]string
+}
+
+func newHTTPTransport(client *http.Client, tlsConfig *tls.Config, headers map[string]string) *httpTransport {
+	if client == nil {
+		client = &http.Client{
+			Transport: &http.Transport{
+				IdleConnTimeout:     60 * time.Second,
+				MaxIdleConns:        100,
+				MaxIdleConnsPerHost: 100,
+				TLSClientConfig:     tlsConfig,
+			},
+		}
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
+	return &httpTransport{client: client, scheme: scheme, headers: headers}
+}
+
+func (t *httpTransport) get(ctx context.Context, addr, namespace, session, key string, linearizable bool) ([]byte, bool, error) {
+	query := url.Values{"key": {key}, "namespace": {namespace}, "session": {session}}
+	if linearizable {
+		query.Set("linearizable", "true")
+	}
+
+	var response getResponse
+	if err := t.do(ctx, addr, "/get", query, &response); err != nil {
+		return nil, false, err
+	}
+
+	return []byte(response.Value), response.Found, nil
+}
+
+func (t *httpTransport) set(ctx context.Context, addr, namespace, mode, session, key string, value []byte) (string, error) {
+	var response writeResponse
+	err := t.do(ctx, addr, "/set", url.Values{"key": {key}, "value": {string(value)}, "namespace": {namespace}, "mode": {mode}, "session": {session}}, &response)
+	return response.Session, err
+}
+
+func (t *httpTransport) delete(ctx context.Context, addr, namespace, mode, session, key string) (string, error) {
+	var response writeResponse
+	err := t.do(ctx, addr, "/delete", url.Values{"key": {key}, "namespace": {namespace}, "mode": {mode}, "session": {session}}, &response)
+	return response.Session, err
+}
+
+func (t *httpTransport) scan(ctx context.Context, addr, namespace, prefix string, limit int) ([]KeyValue, error) {
+	var response scanResponse
+	err := t.do(ctx, addr, "/scan", url.Values{"prefix": {prefix}, "limit": {strconv.Itoa(limit)}, "namespace": {namespace}}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Error != "" {
+		return nil, fmt.Errorf("scan on %s: %s", addr, response.Error)
+	}
+	return response.Items, nil
+}
+
+func (t *httpTransport) stats(ctx context.Context, addr string) (int, error) {
+	var response adminResponse
+	err := t.do(ctx, addr, "/stats", url.Values{}, &response)
+	return response.Keys, err
+}
+
+func (t *httpTransport) admin(ctx context.Context, addr string, operation string) (int, error) {
+	var response adminResponse
+	err := t.do(ctx, addr, "/"+operation, url.Values{}, &response)
+	return response.Keys, err
+}
+
+func (t *httpTransport) logLevel(ctx context.Context, addr, level string) (string, error) {
+	var response logLevelResponse
+	err := t.do(ctx, addr, "/loglevel", url.Values{"level": {level}}, &response)
+	return response.Level, err
+}
+
+func (t *httpTransport) close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// do sends a request asking for a JSON response and decodes it into out. Every non 200 status is an error.
+func (t *httpTransport) do(ctx context.Context, addr, path string, query url.Values, out any) error {
+	target := url.URL{Scheme: t.scheme, Host: addr, Path: path, RawQuery: query.Encode()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(body, &failure)
+
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			return fmt.Errorf("%s on %s: %w", path, addr, ErrUnauthenticated)
+		case http.StatusForbidden:
+			return fmt.Errorf("%s on %s: %w", path, addr, ErrForbidden)
+		case http.StatusTooManyRequests:
+			return fmt.Errorf("%s on %s: %w: %s", path, addr, ErrQuotaExceeded, strings.TrimSpace(string(body)))
+		case http.StatusGatewayTimeout:
+			return fmt.Errorf("%s on %s: %w: %s", path, addr, context.DeadlineExceeded, failure.Error)
+		}
+		return fmt.Errorf("%s on %s: status %d: %s", path, addr, resp.StatusCode, failure.Error)
+	}
+
+	return json.Unmarshal(body, out)
+}
@@ -28,11 +28,11 @@ export default function () {
     client.connect(randomItem(nodes), {
         plaintext: true,
     });
-    const data = { key: key, coordinator: true };
+    const data = { key: key };
 
     let getRes = client.invoke('commands.NodeService/Get', data, {  tags: { name: 'GetRequest'} } );
     check(getRes, {
-        'status is OK': (r) => r && r.status === grpc.StatusOK,
+        'status is OK or NotFound': (r) => r && (r.status === grpc.StatusOK || r.status === grpc.StatusNotFound),
     }) || grpcErrors.add(1);
 
     client.close();
@@ -29,7 +29,7 @@ export default function () {
     client.connect(randomItem(nodes), {
         plaintext: true,
     });
-    const data = { key: key, value: value, coordinator: true };
+    const data = { key: key, value: value };
 
     let getRes = client.invoke('commands.NodeService/Set', data, {  tags: { name: 'SetRequest'} } );
     check(getRes, {
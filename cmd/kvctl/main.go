@@ -0,0 +1,316 @@
+// Command kvctl reads and writes keys and runs maintenance operations against a distributed store cluster.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/EliriaT/distributed-store/client"
+	"github.com/EliriaT/distributed-store/config"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	configFile   = flag.String("config-file", "sharding.toml", "Config file describing the cluster")
+	transport    = flag.String("transport", "", "Transport to use: http or grpc. Defaults to the transport_protocol of the config")
+	output       = flag.String("output", "table", "Output format: table or json")
+	timeout      = flag.Duration("timeout", 2*time.Second, "Timeout of a single request to one node")
+	limit        = flag.Int("limit", 0, "Maximum number of keys returned by scan and watch, 0 means no limit")
+	shard        = flag.Int("shard", -1, "Run purge, repair, rebalance or loglevel only on this shard, -1 means every shard")
+	interval     = flag.Duration("interval", time.Second, "How often watch polls for changes")
+	caFile       = flag.String("ca-file", "", "CA certificate used to verify the nodes. Setting it connects over TLS")
+	certFile     = flag.String("cert-file", "", "Client certificate, for nodes that require one")
+	keyFile      = flag.String("key-file", "", "Key of the client certificate")
+	apiKey       = flag.String("api-key", os.Getenv("KVCTL_API_KEY"), "API key to authenticate with. Defaults to $KVCTL_API_KEY")
+	token        = flag.String("token", os.Getenv("KVCTL_TOKEN"), "JWT to authenticate with. Defaults to $KVCTL_TOKEN")
+	namespace    = flag.String("namespace", "", "Namespace of the keys read and written by get, set, del, scan and watch")
+	mode         = flag.String("mode", "", "Write mode of set and del: one, quorum, all, async or any. Defaults to the consistency level of the namespace")
+	linearizable = flag.Bool("linearizable", false, "Make get see every write completed before it, through a consensus barrier")
+)
+
+const usage = `Usage: kvctl [flags] <command> [args]
+
+Commands:
+  get <key>              print the value of a key
+  set <key> <value>      write a key
+  del <key>              delete a key
+  scan [prefix]          list keys starting with prefix
+  watch [prefix]         print changes of keys starting with prefix until interrupted
+  status                 show reachability, latency and key count of every node
+  topology               show the shards, replication factor and consistency level
+  keys                   show the number of keys stored on every shard
+  purge                  delete keys a shard does not own
+  repair                 push keys to the other replicas that may have missed them
+  rebalance              move keys to the shards that own them now
+  loglevel [level]       show the log level of every node, or change it to debug, info, warn or error
+
+Flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := []client.Option{client.WithTimeout(*timeout)}
+	if *transport != "" {
+		opts = append(opts, client.WithTransport(*transport))
+	}
+
+	if *apiKey != "" {
+		opts = append(opts, client.WithAPIKey(*apiKey))
+	}
+	if *token != "" {
+		opts = append(opts, client.WithBearerToken(*token))
+	}
+
+	if *caFile != "" || *certFile != "" {
+		tlsConfig, err := loadTLSConfig()
+		if err != nil {
+			log.Fatalf("Could not load the TLS files: %v", err)
+		}
+		opts = append(opts, client.WithTLSConfig(tlsConfig))
+	}
+
+	c, err := client.NewFromFile(*configFile, opts...)
+	if err != nil {
+		log.Fatalf("Could not create the client: %v", err)
+	}
+	defer c.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if c, err = c.Namespace(*namespace); err != nil {
+		log.Fatalf("Could not use the namespace: %v", err)
+	}
+	c = c.WriteMode(*mode)
+	if *linearizable {
+		c = c.Linearizable()
+	}
+	if err = run(ctx, c, flag.Arg(0), flag.Args()[1:]); err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+}
+
+func run(ctx context.Context, c *client.Client, command string, args []string) error {
+	switch command {
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("expected <key>")
+		}
+		value, err := c.Get(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return printRows([]string{"KEY", "VALUE"}, []client.KeyValue{{Key: args[0], Value: value}}, func(kv client.KeyValue) []string {
+			return []string{kv.Key, string(kv.Value)}
+		})
+
+	case "set":
+		if len(args) != 2 {
+			return fmt.Errorf("expected <key> <value>")
+		}
+		return c.Set(ctx, args[0], []byte(args[1]))
+
+	case "del", "delete":
+		if len(args) != 1 {
+			return fmt.Errorf("expected <key>")
+		}
+		return c.Delete(ctx, args[0])
+
+	case "scan":
+		items, err := c.Scan(ctx, optionalArg(args), *limit)
+		if err != nil {
+			return err
+		}
+		return printRows([]string{"KEY", "VALUE"}, items, func(kv client.KeyValue) []string {
+			return []string{kv.Key, string(kv.Value)}
+		})
+
+	case "watch":
+		return watch(ctx, c, optionalArg(args))
+
+	case "status":
+		return printRows([]string{"SHARD", "NAME", "ADDRESS", "REACHABLE", "LATENCY", "ERROR"}, c.Status(ctx), func(s client.NodeStatus) []string {
+			return []string{strconv.Itoa(s.Shard), s.Name, s.Address, strconv.FormatBool(s.Reachable), s.Latency.Round(time.Microsecond).String(), s.Error}
+		})
+
+	case "topology":
+		return printTopology(c)
+
+	case "keys":
+		return printRows([]string{"SHARD", "NAME", "KEYS", "ERROR"}, c.Status(ctx), func(s client.NodeStatus) []string {
+			return []string{strconv.Itoa(s.Shard), s.Name, strconv.Itoa(s.Keys), s.Error}
+		})
+
+	case client.OperationPurge, client.OperationRepair, client.OperationRebalance:
+		var shards []int
+		if *shard >= 0 {
+			shards = append(shards, *shard)
+		}
+
+		results, err := c.Run(ctx, command, shards...)
+		if printErr := printRows([]string{"SHARD", "NAME", "KEYS", "ERROR"}, results, func(r client.OperationResult) []string {
+			return []string{strconv.Itoa(r.Shard), r.Name, strconv.Itoa(r.Keys), r.Error}
+		}); printErr != nil {
+			return printErr
+		}
+		return err
+
+	case "loglevel":
+		var shards []int
+		if *shard >= 0 {
+			shards = append(shards, *shard)
+		}
+
+		results, err := c.LogLevel(ctx, optionalArg(args), shards...)
+		if printErr := printRows([]string{"SHARD", "NAME", "LEVEL", "ERROR"}, results, func(r client.LogLevelResult) []string {
+			return []string{strconv.Itoa(r.Shard), r.Name, r.Level, r.Error}
+		}); printErr != nil {
+			return printErr
+		}
+		return err
+
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command")
+	}
+}
+
+// watch polls the keys under the prefix and prints every key that was added, changed or deleted.
+func watch(ctx context.Context, c *client.Client, prefix string) error {
+	previous := make(map[string]string)
+	first := true
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		items, err := c.Scan(ctx, prefix, *limit)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("watch: %v", err)
+		}
+
+		if err == nil {
+			current := make(map[string]string, len(items))
+			for _, item := range items {
+				current[item.Key] = string(item.Value)
+
+				if old, ok := previous[item.Key]; !first && (!ok || old != string(item.Value)) {
+					printEvent("set", item.Key, string(item.Value))
+				}
+			}
+
+			for key := range previous {
+				if _, ok := current[key]; !ok {
+					printEvent("del", key, "")
+				}
+			}
+
+			previous = current
+			first = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func printEvent(event, key, value string) {
+	if *output == "json" {
+		json.NewEncoder(os.Stdout).Encode(map[string]string{"event": event, "key": key, "value": value})
+		return
+	}
+	fmt.Printf("%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), event, key, value)
+}
+
+func printTopology(c *client.Client) error {
+	cfg := c.Topology()
+
+	if *output == "json" {
+		return writeJSON(os.Stdout, cfg)
+	}
+
+	fmt.Printf("Replication factor: %d\nConsistency level: %d\nTransport: %s\n\n", cfg.ReplicationFactor, cfg.ConsistencyLevel, cfg.TransportProtocol)
+	return printRows([]string{"SHARD", "NAME", "ADDRESS"}, cfg.Shards, func(s config.Shard) []string {
+		return []string{strconv.Itoa(s.Idx), s.Name, s.Address}
+	})
+}
+
+// printRows writes rows as an aligned table, or the rows themselves as JSON.
+func printRows[T any](header []string, rows []T, columns func(T) []string) error {
+	if *output == "json" {
+		if rows == nil {
+			rows = []T{}
+		}
+		return writeJSON(os.Stdout, rows)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(columns(row), "\t"))
+	}
+	return w.Flush()
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// loadTLSConfig trusts the CA of -ca-file, or the system roots without it, and presents the -cert-file certificate if set.
+func loadTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if *caFile != "" {
+		caPEM, err := os.ReadFile(*caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in %s", *caFile)
+		}
+	}
+
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func optionalArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
@@ -3,28 +3,189 @@ package config
 import (
 	"fmt"
 	"github.com/BurntSushi/toml"
+	"github.com/EliriaT/distributed-store/db"
+	"hash/fnv"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
+// DefaultNamespace is the keyspace of the requests that do not name one.
+const DefaultNamespace = "default"
+
+var namespaceName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 // Shard is a node responsible for a set of keys.
+// Clients use Address, while replicas talk to each other on InternalAddress.
 type Shard struct {
-	Idx     int
-	Name    string
-	Address string
+	Idx             int
+	Name            string
+	Address         string
+	InternalAddress string `toml:"internal_address"`
 }
 
 func (m Shard) String() string {
 	return m.Name
 }
 
+// TLS describes the certificates of a node. TLS is disabled when no certificate is configured.
+type TLS struct {
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+	CAFile   string `toml:"ca_file"`
+	// MutualTLS requires the peers to present a certificate signed by the CA on the internal address.
+	MutualTLS bool `toml:"mutual_tls"`
+}
+
+// Enabled reports whether the node serves TLS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Namespace is a keyspace with its own settings. Zero values fall back to the cluster settings.
+type Namespace struct {
+	Name              string
+	ReplicationFactor int `toml:"replication_factor"`
+	ConsistencyLevel  int `toml:"consistency_level"`
+	// TTL is how long the keys written in the namespace live. Zero keeps them forever.
+	TTL time.Duration `toml:"ttl"`
+	// MaxKeys limits the keys a node stores in the namespace. Zero means no limit.
+	MaxKeys int `toml:"max_keys"`
+	// MaxBytes limits the bytes of the keys and values a node stores in the namespace. Zero means no limit.
+	MaxBytes int64 `toml:"max_bytes"`
+	// MaxValueSize limits the size of a single value in bytes. Zero means no limit.
+	MaxValueSize int `toml:"max_value_size"`
+	// RateLimit is the number of requests per second the cluster serves for the namespace, split evenly
+	// between the nodes. Burst is the number of requests above the rate the cluster accepts at once.
+	// Zero means no limit.
+	RateLimit float64 `toml:"rate_limit"`
+	Burst     int     `toml:"burst"`
+}
+
+// Principal is a user or a service of the cluster. It authenticates with one of its API keys,
+// or with a JWT signed with the jwt_secret whose subject is its name.
+type Principal struct {
+	Name    string
+	APIKeys []string `toml:"api_keys"`
+	// Read and Write list the key prefixes the principal may read and write. An empty prefix matches every key.
+	Read  []string
+	Write []string
+	// Admin allows the purge, repair, rebalance and stats operations.
+	Admin bool
+	// Namespaces lists the namespaces the principal may use. An empty list allows all of them.
+	Namespaces []string
+	// RateLimit and Burst limit the requests of the principal like the ones of a namespace.
+	RateLimit float64 `toml:"rate_limit"`
+	Burst     int     `toml:"burst"`
+}
+
+// Auth describes the principals allowed to use the public API. Authentication is disabled when no principal is configured.
+type Auth struct {
+	JWTSecret  string      `toml:"jwt_secret"`
+	Principals []Principal `toml:"principals"`
+}
+
+// Enabled reports whether requests must be authenticated.
+func (a Auth) Enabled() bool {
+	return len(a.Principals) > 0
+}
+
+// Tracing selects where the spans of a node are exported. Tracing is disabled when no exporter is configured.
+type Tracing struct {
+	// Exporter is "otlp", sending the spans to an OTLP gRPC endpoint, or "file", writing them as JSON lines.
+	Exporter string
+	// Endpoint is the host and port of the OTLP collector.
+	Endpoint string
+	// Insecure sends the spans to the collector without TLS.
+	Insecure bool
+	// File is the path the file exporter appends the spans to.
+	File string
+	// SampleRatio is the fraction of the traces started by the node that are kept, all of them when 0.
+	// Requests coming from a peer follow the decision of the coordinator.
+	SampleRatio float64 `toml:"sample_ratio"`
+}
+
+// Enabled reports whether the node exports spans.
+func (t Tracing) Enabled() bool {
+	return t.Exporter != ""
+}
+
+// Logging sets up the logs of a node.
+type Logging struct {
+	// Level is the lowest level logged: "debug", "info", "warn" or "error". It is "info" when unset
+	// and can be changed at runtime.
+	Level string
+	// Format is "text" or "json".
+	Format string
+	// RedactValues logs the length of the values instead of the values.
+	RedactValues bool `toml:"redact_values"`
+	// SampleEvery keeps only one of every SampleEvery per key debug logs with the same message,
+	// all of them when 0 or 1.
+	SampleEvery int `toml:"sample_every"`
+}
+
+// FailureDetector tunes the gossip telling the nodes which of their peers are alive.
+type FailureDetector struct {
+	// Interval is how often a node sends its heartbeats to its peers, 500ms when unset.
+	Interval time.Duration
+	// PhiThreshold is the suspicion level above which a peer is suspected dead, 8 when unset.
+	// Lower values detect failures sooner, with more false suspicions.
+	PhiThreshold float64 `toml:"phi_threshold"`
+}
+
+// Default per-operation timeouts of the calls to the replicas.
+const (
+	DefaultReadTimeout  = time.Second
+	DefaultWriteTimeout = time.Second
+	DefaultScanTimeout  = 5 * time.Second
+)
+
+// Timeouts bound the calls of a coordinator to one replica, per operation. The deadline of the client
+// applies too, whichever comes first.
+type Timeouts struct {
+	// Read bounds a get, 1s when unset.
+	Read time.Duration
+	// Write bounds a set or a delete, including the hinted, repair and rebalance writes, 1s when unset.
+	Write time.Duration
+	// Scan bounds a scan, 5s when unset.
+	Scan time.Duration
+}
+
+// WithDefaults returns the timeouts with the unset ones set to their defaults.
+func (t Timeouts) WithDefaults() Timeouts {
+	if t.Read == 0 {
+		t.Read = DefaultReadTimeout
+	}
+	if t.Write == 0 {
+		t.Write = DefaultWriteTimeout
+	}
+	if t.Scan == 0 {
+		t.Scan = DefaultScanTimeout
+	}
+	return t
+}
+
 // Config describes the sharding config.
 type Config struct {
 	Shards            []Shard
-	ReplicationFactor int    `toml:"replication_factor"`
-	ConsistencyLevel  int    `toml:"consistency_level"`
-	TransportProtocol string `toml:"transport_protocol"`
-	StorageModule     string `toml:"storage_module"`
-	MustLog           bool   `toml:"logs"`
+	ReplicationFactor int             `toml:"replication_factor"`
+	ConsistencyLevel  int             `toml:"consistency_level"`
+	TransportProtocol string          `toml:"transport_protocol"`
+	StorageModule     string          `toml:"storage_module"`
+	MustLog           bool            `toml:"logs"`
+	ClusterSecret     string          `toml:"cluster_secret"`
+	TLS               TLS             `toml:"tls"`
+	Auth              Auth            `toml:"auth"`
+	Namespaces        []Namespace     `toml:"namespaces"`
+	Tracing           Tracing         `toml:"tracing"`
+	Logging           Logging         `toml:"logging"`
+	FailureDetector   FailureDetector `toml:"failure_detector"`
+	// DrainTimeout bounds how long a stopping node waits for the requests in flight, 30s when unset.
+	DrainTimeout time.Duration `toml:"drain_timeout"`
+	Timeouts     Timeouts      `toml:"timeouts"`
+	// Storage holds the options of the storage engines, a table per engine name.
+	Storage map[string]db.Options `toml:"storage"`
 }
 
 func (c Config) GetShardIndex(name string) int {
@@ -37,13 +198,75 @@ func (c Config) GetShardIndex(name string) int {
 	return 0
 }
 
+func (c Config) GetShardName(idx int) string {
+	for _, shard := range c.Shards {
+		if shard.Idx == idx {
+			return shard.Name
+		}
+	}
+
+	return ""
+}
+
+// GetNamespace returns the settings of a namespace, with the cluster settings filled in where the namespace has none.
+// An empty name is the default namespace.
+func (c Config) GetNamespace(name string) (Namespace, bool) {
+	if name == "" {
+		name = DefaultNamespace
+	}
+
+	ns := Namespace{Name: name}
+	found := name == DefaultNamespace
+	for _, configured := range c.Namespaces {
+		if configured.Name == name {
+			ns = configured
+			found = true
+		}
+	}
+
+	if ns.ReplicationFactor == 0 {
+		ns.ReplicationFactor = c.ReplicationFactor
+	}
+	if ns.ConsistencyLevel == 0 {
+		ns.ConsistencyLevel = min(c.ConsistencyLevel, ns.ReplicationFactor)
+	}
+
+	return ns, found
+}
+
+// Epoch identifies the topology of the config: the shards, their addresses and the replication settings.
+// Nodes started with different topologies report different epochs.
+func (c Config) Epoch() string {
+	shards := slices.Clone(c.Shards)
+	slices.SortFunc(shards, func(a, b Shard) int { return a.Idx - b.Idx })
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "rf=%d cl=%d", c.ReplicationFactor, c.ConsistencyLevel)
+	for _, shard := range shards {
+		fmt.Fprintf(h, "|%d %s %s %s", shard.Idx, shard.Name, shard.Address, shard.InternalAddress)
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// NamespaceNames returns the default namespace followed by the configured ones.
+func (c Config) NamespaceNames() []string {
+	names := []string{DefaultNamespace}
+	for _, ns := range c.Namespaces {
+		if ns.Name != DefaultNamespace {
+			names = append(names, ns.Name)
+		}
+	}
+	return names
+}
+
 // Shards represents an easier-to-use representation of
 // the sharding config: the shards count, current shard index and
 // the addresses of all other shards too.
 type Shards struct {
-	Count   int
-	CurrIdx int
-	Addrs   map[int]string
+	Count         int
+	CurrIdx       int
+	Addrs         map[int]string
+	InternalAddrs map[int]string
 }
 
 // ParseFile parses the config, validates it and returns it upon success.
@@ -81,8 +304,113 @@ func validateConfiguration(config Config) error {
 		return fmt.Errorf("unsupported value for transport_protocol: %s. Allowed: http/grpc", config.TransportProtocol)
 	}
 
-	if strings.ToLower(config.StorageModule) != "lsm" && strings.ToLower(config.StorageModule) != "btree" {
-		return fmt.Errorf("unsupported value for StorageModule: %s. Allowed: lsm/btree", config.StorageModule)
+	engines := db.Engines()
+	if !slices.Contains(engines, strings.ToLower(config.StorageModule)) {
+		return fmt.Errorf("unsupported value for StorageModule: %s. Allowed: %s", config.StorageModule, strings.Join(engines, "/"))
+	}
+	for engine := range config.Storage {
+		if !slices.Contains(engines, engine) {
+			return fmt.Errorf("unsupported storage engine in the storage section: %s. Allowed: %s", engine, strings.Join(engines, "/"))
+		}
+	}
+
+	if config.TLS.Enabled() && config.TLS.KeyFile == "" {
+		return fmt.Errorf("tls.cert_file is set but tls.key_file is missing")
+	}
+
+	if config.TLS.MutualTLS && (!config.TLS.Enabled() || config.TLS.CAFile == "") {
+		return fmt.Errorf("tls.mutual_tls requires tls.cert_file, tls.key_file and tls.ca_file")
+	}
+
+	switch strings.ToLower(config.Logging.Level) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("unsupported value for logging.level: %s. Allowed: debug/info/warn/error", config.Logging.Level)
+	}
+	switch config.Logging.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unsupported value for logging.format: %s. Allowed: text/json", config.Logging.Format)
+	}
+	if config.Logging.SampleEvery < 0 {
+		return fmt.Errorf("logging.sample_every cannot be negative")
+	}
+
+	if config.FailureDetector.Interval < 0 || config.FailureDetector.PhiThreshold < 0 {
+		return fmt.Errorf("failure_detector.interval and failure_detector.phi_threshold cannot be negative")
+	}
+
+	if config.DrainTimeout < 0 {
+		return fmt.Errorf("drain_timeout cannot be negative")
+	}
+	if config.Timeouts.Read < 0 || config.Timeouts.Write < 0 || config.Timeouts.Scan < 0 {
+		return fmt.Errorf("timeouts.read, timeouts.write and timeouts.scan cannot be negative")
+	}
+
+	switch config.Tracing.Exporter {
+	case "":
+	case "otlp":
+		if config.Tracing.Endpoint == "" {
+			return fmt.Errorf("tracing.exporter otlp requires tracing.endpoint")
+		}
+	case "file":
+		if config.Tracing.File == "" {
+			return fmt.Errorf("tracing.exporter file requires tracing.file")
+		}
+	default:
+		return fmt.Errorf("unsupported value for tracing.exporter: %s. Allowed: otlp/file", config.Tracing.Exporter)
+	}
+	if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio %g must be between 0 and 1", config.Tracing.SampleRatio)
+	}
+
+	namespaces := make(map[string]bool)
+	for _, configured := range config.Namespaces {
+		if !namespaceName.MatchString(configured.Name) || namespaces[configured.Name] {
+			return fmt.Errorf("every namespace needs a unique name made of letters, digits, '-' and '_', got %q", configured.Name)
+		}
+		namespaces[configured.Name] = true
+
+		ns, _ := config.GetNamespace(configured.Name)
+		if ns.ReplicationFactor < 1 || ns.ReplicationFactor > shardsCount {
+			return fmt.Errorf("namespace %q: replication factor %d must be between 1 and the number of shards %d", ns.Name, ns.ReplicationFactor, shardsCount)
+		}
+		if ns.ConsistencyLevel < 1 || ns.ConsistencyLevel > ns.ReplicationFactor {
+			return fmt.Errorf("namespace %q: consistency level %d must be between 1 and the replication factor %d", ns.Name, ns.ConsistencyLevel, ns.ReplicationFactor)
+		}
+		if ns.TTL < 0 || ns.MaxKeys < 0 || ns.MaxBytes < 0 || ns.MaxValueSize < 0 || ns.RateLimit < 0 || ns.Burst < 0 {
+			return fmt.Errorf("namespace %q: ttl, max_keys, max_bytes, max_value_size, rate_limit and burst cannot be negative", ns.Name)
+		}
+	}
+
+	names := make(map[string]bool)
+	apiKeys := make(map[string]bool)
+	for _, principal := range config.Auth.Principals {
+		if principal.Name == "" || names[principal.Name] {
+			return fmt.Errorf("every auth principal needs a unique name, got %q", principal.Name)
+		}
+		names[principal.Name] = true
+
+		if principal.RateLimit < 0 || principal.Burst < 0 {
+			return fmt.Errorf("principal %q: rate_limit and burst cannot be negative", principal.Name)
+		}
+
+		for _, key := range principal.APIKeys {
+			if key == "" || apiKeys[key] {
+				return fmt.Errorf("principal %q has an empty API key or one already used by another principal", principal.Name)
+			}
+			apiKeys[key] = true
+		}
+	}
+
+	for _, shard := range config.Shards {
+		if shard.InternalAddress == "" {
+			return fmt.Errorf("shard %q has no internal_address for the replica traffic", shard.Name)
+		}
+
+		if shard.InternalAddress == shard.Address {
+			return fmt.Errorf("shard %q must serve the internal traffic on a different address than %s", shard.Name, shard.Address)
+		}
 	}
 
 	return nil
@@ -95,6 +423,7 @@ func ParseShards(shards []Shard, currShardName string) (*Shards, error) {
 	shardCount := len(shards)
 	shardIdx := -1
 	addrs := make(map[int]string)
+	internalAddrs := make(map[int]string)
 
 	for _, s := range shards {
 		if _, ok := addrs[s.Idx]; ok {
@@ -102,6 +431,7 @@ func ParseShards(shards []Shard, currShardName string) (*Shards, error) {
 		}
 
 		addrs[s.Idx] = s.Address
+		internalAddrs[s.Idx] = s.InternalAddress
 		if s.Name == currShardName {
 			shardIdx = s.Idx
 		}
@@ -118,8 +448,9 @@ func ParseShards(shards []Shard, currShardName string) (*Shards, error) {
 	}
 
 	return &Shards{
-		Addrs:   addrs,
-		Count:   shardCount,
-		CurrIdx: shardIdx,
+		Addrs:         addrs,
+		InternalAddrs: internalAddrs,
+		Count:         shardCount,
+		CurrIdx:       shardIdx,
 	}, nil
 }
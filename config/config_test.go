@@ -5,6 +5,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func createConfig(t *testing.T, contents string) config.Config {
@@ -39,16 +40,18 @@ func TestConfigParse(t *testing.T) {
 		[[shards]]
 		name = "Orhei"
 		idx = 0
-		address = "localhost:8080"`)
+		address = "localhost:8080"
+		internal_address = "localhost:9080"`)
 
 	want := config.Config{
 		ReplicationFactor: 1,
 		ConsistencyLevel:  1,
 		Shards: []config.Shard{
 			{
-				Name:    "Orhei",
-				Idx:     0,
-				Address: "localhost:8080",
+				Name:            "Orhei",
+				Idx:             0,
+				Address:         "localhost:8080",
+				InternalAddress: "localhost:9080",
 			},
 		},
 	}
@@ -65,10 +68,12 @@ func TestParseShards(t *testing.T) {
 		name = "Orhei"
 		idx = 0
 		address = "localhost:8080"
+		internal_address = "localhost:9080"
 	[[shards]]
 		name = "Chisinau"
 		idx = 1
-		address = "localhost:8081"`)
+		address = "localhost:8081"
+		internal_address = "localhost:9081"`)
 
 	got, err := config.ParseShards(c.Shards, "Chisinau")
 	if err != nil {
@@ -82,9 +87,55 @@ func TestParseShards(t *testing.T) {
 			0: "localhost:8080",
 			1: "localhost:8081",
 		},
+		InternalAddrs: map[int]string{
+			0: "localhost:9080",
+			1: "localhost:9081",
+		},
 	}
 
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("The shards config does match: got: %#v, want: %#v", got, want)
 	}
 }
+
+func TestGetNamespace(t *testing.T) {
+	c := config.Config{
+		ReplicationFactor: 3,
+		ConsistencyLevel:  2,
+		Namespaces: []config.Namespace{
+			{Name: "cache", ReplicationFactor: 1, TTL: time.Minute},
+			{Name: "config", ConsistencyLevel: 3, MaxKeys: 100},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		want  config.Namespace
+		found bool
+	}{
+		{name: "", want: config.Namespace{Name: "default", ReplicationFactor: 3, ConsistencyLevel: 2}, found: true},
+		{name: "cache", want: config.Namespace{Name: "cache", ReplicationFactor: 1, ConsistencyLevel: 1, TTL: time.Minute}, found: true},
+		{name: "config", want: config.Namespace{Name: "config", ReplicationFactor: 3, ConsistencyLevel: 3, MaxKeys: 100}, found: true},
+		{name: "missing", want: config.Namespace{Name: "missing", ReplicationFactor: 3, ConsistencyLevel: 2}, found: false},
+	}
+
+	for _, tt := range tests {
+		got, found := c.GetNamespace(tt.name)
+		if got != tt.want || found != tt.found {
+			t.Errorf("GetNamespace(%q) = %+v, %v, want %+v, %v", tt.name, got, found, tt.want, tt.found)
+		}
+	}
+
+	if names := c.NamespaceNames(); !reflect.DeepEqual(names, []string{"default", "cache", "config"}) {
+		t.Errorf("Unexpected namespace names: %v", names)
+	}
+}
+
+func TestTimeoutsWithDefaults(t *testing.T) {
+	got := config.Timeouts{Read: 200 * time.Millisecond}.WithDefaults()
+	want := config.Timeouts{Read: 200 * time.Millisecond, Write: config.DefaultWriteTimeout, Scan: config.DefaultScanTimeout}
+
+	if got != want {
+		t.Errorf("WithDefaults() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,256 @@
+// Package auth authenticates the callers of the public API and checks their access to key prefixes.
+// Callers present an API key or a JWT, both validated locally against the principals of the sharding config.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// APIKeyHeader carries an API key. JWTs are sent in the Authorization header as bearer tokens.
+const APIKeyHeader = "X-API-Key"
+
+// Access is an operation a principal may be allowed to do.
+type Access string
+
+const (
+	Read  Access = "read"
+	Write Access = "write"
+	Admin Access = "admin"
+)
+
+var (
+	ErrUnauthenticated = errors.New("missing or invalid credentials")
+	ErrForbidden       = errors.New("access denied")
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Name       string
+	read       []string
+	write      []string
+	admin      bool
+	namespaces []string
+}
+
+// Can reports whether the principal may do the operation on the key. Admin operations ignore the key.
+func (p *Principal) Can(access Access, key string) bool {
+	switch access {
+	case Read:
+		return matches(p.read, key)
+	case Write:
+		return matches(p.write, key)
+	case Admin:
+		return p.admin
+	}
+	return false
+}
+
+// CanUse reports whether the principal may use the namespace.
+func (p *Principal) CanUse(namespace string) bool {
+	return len(p.namespaces) == 0 || slices.Contains(p.namespaces, namespace)
+}
+
+func matches(prefixes []string, key string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator validates the credentials of the requests against the configured principals.
+type Authenticator struct {
+	principals map[string]*Principal
+	apiKeys    map[string]*Principal
+	jwtSecret  []byte
+}
+
+// New creates an authenticator for the principals of the config. It accepts every request when auth is disabled.
+func New(cfg config.Auth) *Authenticator {
+	a := &Authenticator{
+		principals: make(map[string]*Principal),
+		apiKeys:    make(map[string]*Principal),
+		jwtSecret:  []byte(cfg.JWTSecret),
+	}
+
+	for _, p := range cfg.Principals {
+		principal := &Principal{Name: p.Name, read: p.Read, write: p.Write, admin: p.Admin, namespaces: p.Namespaces}
+		a.principals[p.Name] = principal
+		for _, key := range p.APIKeys {
+			a.apiKeys[key] = principal
+		}
+	}
+
+	return a
+}
+
+// Enabled reports whether the requests must be authenticated.
+func (a *Authenticator) Enabled() bool {
+	return len(a.principals) > 0
+}
+
+// Authenticate returns the principal identified by an API key or by the Authorization header value "Bearer <jwt>".
+func (a *Authenticator) Authenticate(apiKey, authorization string) (*Principal, error) {
+	if apiKey != "" {
+		for key, principal := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+				return principal, nil
+			}
+		}
+		return nil, ErrUnauthenticated
+	}
+
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || len(a.jwtSecret) == 0 {
+		return nil, ErrUnauthenticated
+	}
+
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (any, error) {
+		return a.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	subject, err := parsed.Claims.GetSubject()
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	principal, ok := a.principals[subject]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown principal %q", ErrUnauthenticated, subject)
+	}
+	return principal, nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the principal.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of the request, if it was authenticated.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok
+}
+
+// Allowed reports whether the principal of the context may do the operation on the key.
+// Requests without a principal are allowed, as they were not authenticated because auth is disabled.
+func Allowed(ctx context.Context, access Access, key string) bool {
+	p, ok := FromContext(ctx)
+	return !ok || p.Can(access, key)
+}
+
+// Check is like Allowed, but returns ErrForbidden and logs the denial.
+func Check(ctx context.Context, access Access, key string) error {
+	if Allowed(ctx, access, key) {
+		return nil
+	}
+
+	p, _ := FromContext(ctx)
+	slog.WarnContext(ctx, "Denied access to a key", "access", access, "key", key, "principal", p.Name)
+	return ErrForbidden
+}
+
+// CheckNamespace returns ErrForbidden and logs the denial when the principal of the context may not use the namespace.
+func CheckNamespace(ctx context.Context, namespace string) error {
+	p, ok := FromContext(ctx)
+	if !ok || p.CanUse(namespace) {
+		return nil
+	}
+
+	slog.WarnContext(ctx, "Denied a namespace", "namespace", namespace, "principal", p.Name)
+	return ErrForbidden
+}
+
+// Middleware authenticates the HTTP requests and rejects the ones with missing or invalid credentials.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	if !a.Enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r.Header.Get(APIKeyHeader), r.Header.Get("Authorization"))
+		if err != nil {
+			slog.WarnContext(r.Context(), "Rejected a request", "path", r.URL.Path, "remote", r.RemoteAddr, "error", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+	})
+}
+
+// healthService is the standard gRPC health service, which probes call without credentials.
+const healthService = "/grpc.health.v1.Health/"
+
+// ServerOptions returns the interceptors authenticating the gRPC calls. The health checks are not authenticated.
+func (a *Authenticator) ServerOptions() []grpc.ServerOption {
+	if !a.Enabled() {
+		return nil
+	}
+
+	authenticate := func(ctx context.Context, method string) (context.Context, error) {
+		if strings.HasPrefix(method, healthService) {
+			return ctx, nil
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		p, err := a.Authenticate(first(md, strings.ToLower(APIKeyHeader)), first(md, "authorization"))
+		if err != nil {
+			slog.WarnContext(ctx, "Rejected a call", "method", method, "error", err)
+			return nil, status.Error(codes.Unauthenticated, ErrUnauthenticated.Error())
+		}
+		return NewContext(ctx, p), nil
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := authenticate(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authenticate(ss.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		}),
+	}
+}
+
+// serverStream replaces the context of a stream with the one carrying the principal.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var cfg = config.Auth{
+	JWTSecret: "jwt-secret",
+	Principals: []config.Principal{
+		{Name: "billing", APIKeys: []string{"billing-key"}, Read: []string{"billing:", "users:"}, Write: []string{"billing:"}},
+		{Name: "ops", APIKeys: []string{"ops-key"}, Admin: true},
+	},
+}
+
+func token(t *testing.T, secret, subject string, expiresAt time.Time) string {
+	t.Helper()
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Could not sign the token: %v", err)
+	}
+	return "Bearer " + signed
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := auth.New(cfg)
+	hour := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		apiKey        string
+		authorization string
+		principal     string
+	}{
+		{name: "api key", apiKey: "billing-key", principal: "billing"},
+		{name: "jwt", authorization: token(t, "jwt-secret", "ops", hour), principal: "ops"},
+		{name: "unknown api key", apiKey: "guess"},
+		{name: "no credentials"},
+		{name: "jwt of another secret", authorization: token(t, "other", "ops", hour)},
+		{name: "expired jwt", authorization: token(t, "jwt-secret", "ops", time.Now().Add(-time.Hour))},
+		{name: "jwt of an unknown principal", authorization: token(t, "jwt-secret", "intruder", hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := a.Authenticate(tt.apiKey, tt.authorization)
+
+			if tt.principal == "" {
+				if !errors.Is(err, auth.ErrUnauthenticated) {
+					t.Errorf("Unexpected error: got %v, want %v", err, auth.ErrUnauthenticated)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Could not authenticate: %v", err)
+			}
+			if p.Name != tt.principal {
+				t.Errorf("Unexpected principal: got %q, want %q", p.Name, tt.principal)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	a := auth.New(cfg)
+	billing, _ := a.Authenticate("billing-key", "")
+	ops, _ := a.Authenticate("ops-key", "")
+
+	tests := []struct {
+		principal *auth.Principal
+		access    auth.Access
+		key       string
+		allowed   bool
+	}{
+		{billing, auth.Read, "users:1", true},
+		{billing, auth.Write, "billing:1", true},
+		{billing, auth.Write, "users:1", false},
+		{billing, auth.Read, "orders:1", false},
+		{billing, auth.Admin, "", false},
+		{ops, auth.Admin, "", true},
+		{ops, auth.Read, "users:1", false},
+	}
+
+	for _, tt := range tests {
+		err := auth.Check(auth.NewContext(context.Background(), tt.principal), tt.access, tt.key)
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s %s on %q: got %v, want allowed = %v", tt.principal.Name, tt.access, tt.key, err, tt.allowed)
+		}
+	}
+
+	if err := auth.Check(context.Background(), auth.Write, "users:1"); err != nil {
+		t.Errorf("Requests without a principal should be allowed: %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := auth.New(cfg).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := auth.FromContext(r.Context()); !ok || p.Name != "billing" {
+			t.Errorf("The principal is missing from the request context")
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/get?key=billing:1", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status without credentials: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	req.Header.Set(auth.APIKeyHeader, "billing-key")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Unexpected status with an API key: got %d, want %d", rec.Code, http.StatusOK)
+	}
+}
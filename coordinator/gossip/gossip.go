@@ -0,0 +1,297 @@
+// Package gossip tells which peers of a node are alive. Every node increments its own heartbeat and sends the
+// heartbeats it knows to its peers, which merge them into theirs, so a node learns about a peer even through
+// the others. A heartbeat counts within the generation of the node, the time its process started, so that the
+// heartbeats of a restarted node, counting again from 0, replace the ones of its previous run. A phi accrual
+// failure detector turns the arrival times of the heartbeats of a peer into a suspicion level, and the peer is
+// suspected dead once the level crosses the threshold.
+package gossip
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/metrics"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultInterval is how often a node gossips when the config sets no interval.
+	DefaultInterval = 500 * time.Millisecond
+	// DefaultPhiThreshold is the suspicion level above which a peer is suspected dead when the config sets none.
+	// 8 means the detector is wrong about one time in 10^8.
+	DefaultPhiThreshold = 8.0
+	// window is the number of heartbeat intervals kept per peer.
+	window = 100
+)
+
+// ErrSuspected fails the requests to a peer suspected dead without sending them.
+var ErrSuspected = errors.New("replica suspected dead")
+
+// Heartbeat is a heartbeat of a node: the count of its gossip rounds in its generation.
+type Heartbeat struct {
+	Generation int64 `json:"generation"`
+	Counter    int64 `json:"counter"`
+}
+
+// Newer reports whether the heartbeat comes after other: in a later generation, or later in the same one.
+func (h Heartbeat) Newer(other Heartbeat) bool {
+	if h.Generation != other.Generation {
+		return h.Generation > other.Generation
+	}
+	return h.Counter > other.Counter
+}
+
+// Heartbeats maps a shard to the last heartbeat known of it.
+type Heartbeats map[int]Heartbeat
+
+// Send gossips the heartbeats known by the node to a peer and returns the heartbeats known by the peer.
+type Send func(ctx context.Context, shard int, heartbeats Heartbeats) (Heartbeats, error)
+
+// PeerView is what a node knows about one of its peers.
+type PeerView struct {
+	Shard     int     `json:"shard"`
+	Alive     bool    `json:"alive"`
+	Phi       float64 `json:"phi"`
+	Heartbeat int64   `json:"heartbeat"`
+	// PendingHints is the number of writes the node keeps for the peer until it is back.
+	PendingHints int `json:"pending_hints"`
+}
+
+type member struct {
+	heartbeat Heartbeat
+	// last is when the heartbeat last increased, and intervals the time between the last increases
+	last      time.Time
+	intervals []time.Duration
+	suspected bool
+}
+
+// Detector keeps the heartbeats of the peers of the current shard and tells which of them are alive.
+type Detector struct {
+	mu        sync.Mutex
+	self      int
+	heartbeat Heartbeat
+	interval  time.Duration
+	threshold float64
+	members   map[int]*member
+	now       func() time.Time
+}
+
+// New creates the detector of the current shard, watching every other shard of the config.
+// The peers count as alive until they miss their first heartbeats.
+func New(cfg config.Config, self int) *Detector {
+	return newDetector(cfg, self, time.Now)
+}
+
+func newDetector(cfg config.Config, self int, now func() time.Time) *Detector {
+	d := &Detector{
+		self:      self,
+		heartbeat: Heartbeat{Generation: now().UnixNano()},
+		interval:  cfg.FailureDetector.Interval,
+		threshold: cfg.FailureDetector.PhiThreshold,
+		members:   make(map[int]*member),
+		now:       now,
+	}
+	if d.interval == 0 {
+		d.interval = DefaultInterval
+	}
+	if d.threshold == 0 {
+		d.threshold = DefaultPhiThreshold
+	}
+
+	for _, shard := range cfg.Shards {
+		if shard.Idx != self {
+			// the first expected interval is the gossip interval
+			d.members[shard.Idx] = &member{last: now(), intervals: []time.Duration{d.interval}}
+		}
+	}
+	return d
+}
+
+// Interval returns how often the node gossips.
+func (d *Detector) Interval() time.Duration {
+	return d.interval
+}
+
+// Heartbeats returns the heartbeats the node knows, its own included.
+func (d *Detector) Heartbeats() Heartbeats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	heartbeats := Heartbeats{d.self: d.heartbeat}
+	for shard, m := range d.members {
+		heartbeats[shard] = m.heartbeat
+	}
+	return heartbeats
+}
+
+// Merge records the heartbeats gossiped by a peer. A heartbeat newer than the known one is a sign of life.
+// A heartbeat of a new generation starts the history of the peer again, as the node restarted.
+func (d *Detector) Merge(heartbeats Heartbeats) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for shard, heartbeat := range heartbeats {
+		m, ok := d.members[shard]
+		if !ok || !heartbeat.Newer(m.heartbeat) {
+			continue
+		}
+
+		if heartbeat.Generation != m.heartbeat.Generation {
+			m.heartbeat = heartbeat
+			m.intervals = []time.Duration{d.interval}
+			m.last = now
+			continue
+		}
+
+		m.heartbeat = heartbeat
+		m.intervals = append(m.intervals, now.Sub(m.last))
+		if len(m.intervals) > window {
+			m.intervals = m.intervals[len(m.intervals)-window:]
+		}
+		m.last = now
+	}
+}
+
+// Exchange merges the heartbeats gossiped by a peer and returns the ones the node knows, to answer the peer.
+func (d *Detector) Exchange(heartbeats Heartbeats) Heartbeats {
+	d.Merge(heartbeats)
+	return d.Heartbeats()
+}
+
+// Alive reports whether the shard is not suspected dead. The current shard and unknown shards are alive.
+func (d *Detector) Alive(shard int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m, ok := d.members[shard]
+	return !ok || d.phi(m) < d.threshold
+}
+
+// Targets returns the shards that are not suspected dead, keeping their order. When all of them are suspected,
+// it returns all of them, as the detector may be the one that is cut off.
+func (d *Detector) Targets(shards []int) []int {
+	alive := make([]int, 0, len(shards))
+	for _, shard := range shards {
+		if d.Alive(shard) {
+			alive = append(alive, shard)
+		}
+	}
+	if len(alive) == 0 {
+		return shards
+	}
+	return alive
+}
+
+// View returns what the node knows about its peers, in shard order.
+func (d *Detector) View() []PeerView {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	view := make([]PeerView, 0, len(d.members))
+	for shard, m := range d.members {
+		phi := d.phi(m)
+		view = append(view, PeerView{Shard: shard, Alive: phi < d.threshold, Phi: phi, Heartbeat: m.heartbeat.Counter})
+	}
+	sort.Slice(view, func(i, j int) bool { return view[i].Shard < view[j].Shard })
+	return view
+}
+
+// Run gossips with every peer each interval until ctx is done.
+func (d *Detector) Run(ctx context.Context, send Send) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.Lock()
+		d.heartbeat.Counter++
+		d.mu.Unlock()
+
+		heartbeats := d.Heartbeats()
+		var wg sync.WaitGroup
+		for shard := range heartbeats {
+			if shard == d.self {
+				continue
+			}
+
+			wg.Add(1)
+			go func(shard int) {
+				defer wg.Done()
+
+				sendCtx, cancel := context.WithTimeout(ctx, d.interval)
+				defer cancel()
+
+				// a peer that cannot be reached is noticed by its missing heartbeats
+				if received, err := send(sendCtx, shard, heartbeats); err == nil {
+					d.Merge(received)
+				}
+			}(shard)
+		}
+		wg.Wait()
+
+		d.update()
+	}
+}
+
+// update logs the peers that became suspected or came back, and records the suspicion levels.
+func (d *Detector) update() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for shard, m := range d.members {
+		phi := d.phi(m)
+		metrics.SetPeerPhi(shard, phi)
+
+		suspected := phi >= d.threshold
+		if suspected == m.suspected {
+			continue
+		}
+		m.suspected = suspected
+
+		if suspected {
+			slog.Warn("Suspecting a peer is dead", "peer", shard, "phi", phi, "silent", d.now().Sub(m.last))
+		} else {
+			slog.Info("A suspected peer is alive again", "peer", shard)
+		}
+	}
+}
+
+// phi returns the suspicion level of the member: -log10 of the probability that its next heartbeat comes even later
+// than now, with the intervals between its heartbeats taken as normally distributed.
+func (d *Detector) phi(m *member) float64 {
+	var mean float64
+	for _, interval := range m.intervals {
+		mean += float64(interval)
+	}
+	mean /= float64(len(m.intervals))
+
+	var variance float64
+	for _, interval := range m.intervals {
+		variance += (float64(interval) - mean) * (float64(interval) - mean)
+	}
+	variance /= float64(len(m.intervals))
+
+	// a peer with very regular heartbeats would otherwise be suspected on the smallest delay
+	stdDev := max(math.Sqrt(variance), float64(d.interval)/4)
+
+	// logistic approximation of the normal cumulative distribution, 1 - F(elapsed) = e / (1 + e)
+	elapsed := float64(d.now().Sub(m.last))
+	y := (elapsed - mean) / stdDev
+	exponent := y * (1.5976 + 0.070566*y*y)
+	if elapsed > mean {
+		// computed from the exponent, as e is 0 for long silences
+		return exponent/math.Ln10 + math.Log10(1+math.Exp(-exponent))
+	}
+	e := math.Exp(-exponent)
+	return -math.Log10(1 - 1/(1+e))
+}
@@ -0,0 +1,89 @@
+package gossip_test
+
+import (
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/gossip"
+	"testing"
+	"time"
+)
+
+var cfg = config.Config{
+	Shards: []config.Shard{
+		{Idx: 0, Name: "Chisinau"},
+		{Idx: 1, Name: "Balti"},
+		{Idx: 2, Name: "Orhei"},
+	},
+	FailureDetector: config.FailureDetector{Interval: 10 * time.Millisecond},
+}
+
+func TestDetector(t *testing.T) {
+	d := gossip.New(cfg, 0)
+	if !d.Alive(1) || !d.Alive(2) {
+		t.Fatalf("The peers are suspected before missing a heartbeat")
+	}
+
+	// Orhei is heard of only through Balti
+	for i := int64(1); i <= 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+		d.Merge(gossip.Heartbeats{1: {Generation: 1, Counter: i}, 2: {Generation: 1, Counter: i}})
+	}
+	time.Sleep(200 * time.Millisecond)
+	if d.Alive(1) || d.Alive(2) {
+		t.Errorf("The peers are not suspected after 20 missed heartbeats")
+	}
+	if targets := d.Targets([]int{0, 1, 2}); len(targets) != 1 || targets[0] != 0 {
+		t.Errorf("Targets = %v, want only the current shard", targets)
+	}
+	if targets := d.Targets([]int{1, 2}); len(targets) != 2 {
+		t.Errorf("Targets = %v, want all shards when all are suspected", targets)
+	}
+
+	received := d.Exchange(gossip.Heartbeats{1: {Generation: 1, Counter: 6}, 2: {Generation: 1, Counter: 5}})
+	if received[1].Counter != 6 || received[2].Counter != 5 {
+		t.Errorf("Exchange answered %v", received)
+	}
+	if !d.Alive(1) || d.Alive(2) {
+		t.Errorf("Only the peer with a newer heartbeat should be alive: 1 %v, 2 %v", d.Alive(1), d.Alive(2))
+	}
+
+	view := d.View()
+	if len(view) != 2 || view[0].Shard != 1 || !view[0].Alive || view[1].Alive || view[1].Heartbeat != 5 {
+		t.Errorf("Unexpected view: %+v", view)
+	}
+}
+
+func TestDetectorRestart(t *testing.T) {
+	d := gossip.New(cfg, 0)
+
+	for i := int64(1); i <= 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+		d.Merge(gossip.Heartbeats{1: {Generation: 1, Counter: 50 + i}})
+	}
+	time.Sleep(200 * time.Millisecond)
+	if d.Alive(1) {
+		t.Fatalf("The peer is not suspected after 20 missed heartbeats")
+	}
+
+	// Balti restarted, its heartbeats count again from 0
+	d.Merge(gossip.Heartbeats{1: {Generation: 2, Counter: 1}})
+	if !d.Alive(1) {
+		t.Errorf("The restarted peer should be alive after its first heartbeat")
+	}
+	if heartbeat := d.Heartbeats()[1]; heartbeat != (gossip.Heartbeat{Generation: 2, Counter: 1}) {
+		t.Errorf("Unexpected heartbeat after the restart: %+v", heartbeat)
+	}
+
+	// the heartbeats of the previous run still gossiped by other peers are older
+	d.Merge(gossip.Heartbeats{1: {Generation: 1, Counter: 60}})
+	if heartbeat := d.Heartbeats()[1]; heartbeat != (gossip.Heartbeat{Generation: 2, Counter: 1}) {
+		t.Errorf("A heartbeat of the previous generation replaced the new one: %+v", heartbeat)
+	}
+
+	for i := int64(2); i <= 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+		d.Merge(gossip.Heartbeats{1: {Generation: 2, Counter: i}})
+	}
+	if !d.Alive(1) || d.Heartbeats()[1].Counter != 5 {
+		t.Errorf("The restarted peer should be alive with its new heartbeats: %+v", d.View())
+	}
+}
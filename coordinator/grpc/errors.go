@@ -0,0 +1,140 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/coordinator/auth"
+	"github.com/EliriaT/distributed-store/coordinator/quota"
+	"github.com/EliriaT/distributed-store/coordinator/session"
+	"github.com/EliriaT/distributed-store/replication"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"strconv"
+	"strings"
+)
+
+const errorDomain = "distributed-store"
+
+// withDetails attaches details to a status, falling back to the bare status if they cannot be encoded.
+func withDetails(st *status.Status, details ...protoadapt.MessageV1) error {
+	detailed, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// notFoundError is returned when the key does not exist on the replica that answered.
+func notFoundError(key string) error {
+	return withDetails(status.Newf(codes.NotFound, "key %q not found", key), &errdetails.ResourceInfo{
+		ResourceType: "key",
+		ResourceName: key,
+	})
+}
+
+// unavailableError is returned when fewer replicas than the consistency level acknowledged a request.
+func unavailableError(key string, replicatedOn []int32, consistencyLevel int, cause error) error {
+	shards := make([]string, len(replicatedOn))
+	for i, shard := range replicatedOn {
+		shards[i] = strconv.Itoa(int(shard))
+	}
+
+	return withDetails(status.Newf(codes.Unavailable, "key %q reached %d of %d required replicas: %v", key, len(replicatedOn), consistencyLevel, cause), &errdetails.ErrorInfo{
+		Reason: "CONSISTENCY_LEVEL_NOT_REACHED",
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"key":               key,
+			"replicated_on":     strings.Join(shards, ","),
+			"consistency_level": strconv.Itoa(consistencyLevel),
+		},
+	})
+}
+
+// placementError is returned when the ring cannot give the replicas of a key, for example
+// because the replication factor is larger than the number of shards.
+func placementError(key string, replicationFactor int, cause error) error {
+	return withDetails(status.Newf(codes.FailedPrecondition, "could not place key %q on %d replicas: %v", key, replicationFactor, cause), &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{
+			Type:        "PLACEMENT",
+			Subject:     key,
+			Description: fmt.Sprintf("the ring has no %d replicas for the key: %v", replicationFactor, cause),
+		}},
+	})
+}
+
+// contextError converts the end of the context of the call to DeadlineExceeded or Canceled.
+func contextError(err error) error {
+	return status.FromContextError(err).Err()
+}
+
+// sessionToken decodes the session token of a request, returning InvalidArgument when it is malformed.
+func sessionToken(encoded string) (session.Token, error) {
+	token, err := session.ParseToken(encoded)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return token, nil
+}
+
+// writeMode parses the write mode of a request, returning InvalidArgument when it is unknown.
+func writeMode(name string) (replication.WriteMode, error) {
+	mode, err := replication.ParseWriteMode(name)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	return mode, nil
+}
+
+// internalError is returned when the local database fails.
+func internalError(format string, args ...any) error {
+	return status.Errorf(codes.Internal, format, args...)
+}
+
+// authorize returns PermissionDenied when the caller may not do the operation on one of the keys.
+func authorize(ctx context.Context, access auth.Access, keys ...string) error {
+	for _, key := range keys {
+		if err := auth.Check(ctx, access, key); err != nil {
+			return withDetails(status.Newf(codes.PermissionDenied, "%s on key %q is not allowed", access, key), &errdetails.ErrorInfo{
+				Reason:   "ACCESS_DENIED",
+				Domain:   errorDomain,
+				Metadata: map[string]string{"key": key, "access": string(access)},
+			})
+		}
+	}
+	return nil
+}
+
+// overQuota reports whether the error is a quota of the coordinator or of a replica exceeded.
+func overQuota(err error) bool {
+	var exceeded *quota.Exceeded
+	return errors.As(err, &exceeded) || status.Code(err) == codes.ResourceExhausted
+}
+
+// quotaError converts a request over a quota to ResourceExhausted, telling rate limited callers when to retry.
+// The ResourceExhausted errors of the replicas are returned as they are.
+func quotaError(err error) error {
+	if status.Code(err) == codes.ResourceExhausted {
+		return err
+	}
+
+	var exceeded *quota.Exceeded
+	if !errors.As(err, &exceeded) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	details := []protoadapt.MessageV1{&errdetails.QuotaFailure{
+		Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     exceeded.Subject,
+			Description: exceeded.Description,
+		}},
+	}}
+	if exceeded.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(exceeded.RetryAfter)})
+	}
+
+	return withDetails(status.Newf(codes.ResourceExhausted, "quota exceeded: %v", err), details...)
+}
@@ -0,0 +1,154 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/EliriaT/distributed-store/coordinator/gossip"
+	"github.com/EliriaT/distributed-store/coordinator/grpc/proto"
+	"github.com/EliriaT/distributed-store/coordinator/session"
+	"github.com/EliriaT/distributed-store/namespace"
+	"github.com/EliriaT/distributed-store/replication"
+	"log/slog"
+	"time"
+)
+
+// RunFailureDetector gossips the heartbeats of the node with its peers and replays the hints of the peers that are
+// alive, until ctx is done. The peers must be added before.
+func (g *GrpcServer) RunFailureDetector(ctx context.Context) {
+	go g.detector.Run(ctx, g.gossip)
+
+	ticker := time.NewTicker(g.detector.Interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		g.replayHints(ctx)
+	}
+}
+
+// replayHints replays the hints of the peers that are alive.
+func (g *GrpcServer) replayHints(ctx context.Context) {
+	for shard := range g.PeerConnections {
+		if g.hints.Pending(shard) == 0 || !g.detector.Alive(shard) {
+			continue
+		}
+
+		replayed, err := g.hints.Replay(ctx, shard, func(hint replication.Hint) error {
+			return g.replay(ctx, shard, hint)
+		})
+		slog.InfoContext(ctx, "Replayed hints", "replica", shard, "replayed", replayed, "pending", g.hints.Pending(shard), "error", err)
+	}
+}
+
+// ExchangeHeartbeats merges the heartbeats gossiped by a peer and returns the ones the node knows.
+func (g *GrpcServer) ExchangeHeartbeats(heartbeats gossip.Heartbeats) gossip.Heartbeats {
+	return g.detector.Exchange(heartbeats)
+}
+
+// MergeWatermarks records how far the replicas caught up with the writes coordinated by a peer.
+func (g *GrpcServer) MergeWatermarks(coordinator int, watermarks session.Watermarks) {
+	g.sessions.Merge(coordinator, watermarks)
+}
+
+// Barrier waits until the writes of the key ordered by the consensus module before a new barrier executed locally.
+func (g *GrpcServer) Barrier(ctx context.Context, namespace, key string) error {
+	return g.replicator.Barrier(ctx, namespace, key)
+}
+
+// CheckWrite checks a write a peer sends against the storage limits of the namespace on this replica.
+func (g *GrpcServer) CheckWrite(ns *namespace.Namespace, key string, value []byte) error {
+	return g.quotas.CheckWrite(ns, key, value)
+}
+
+// peerViews returns what the failure detector knows about the peers, with the hints kept for them.
+func (g *GrpcServer) peerViews() []gossip.PeerView {
+	views := g.detector.View()
+	for i := range views {
+		views[i].PendingHints = g.hints.Pending(views[i].Shard)
+	}
+	return views
+}
+
+// gossip sends the heartbeats the node knows to a peer, with the watermarks of its writes, and returns the heartbeats
+// the peer knows.
+func (g *GrpcServer) gossip(ctx context.Context, shard int, known gossip.Heartbeats) (gossip.Heartbeats, error) {
+	peer, ok := g.PeerConnections[shard]
+	if !ok {
+		return nil, fmt.Errorf("no connection to shard %d", shard)
+	}
+
+	message := heartbeatsProto(known)
+	message.From = int32(g.shards.CurrIdx)
+	message.Watermarks = make(map[int32]uint64)
+	for replica, watermark := range g.sessions.Watermarks() {
+		message.Watermarks[int32(replica)] = watermark
+	}
+
+	response, err := peer.Gossip(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	return heartbeats(response), nil
+}
+
+// writeReplica sends a write to a replica with write. The writes to the replicas suspected dead fail right away,
+// and they are kept as hints with the failed writes, to be replayed once the replica is alive again. A write that
+// succeeds drops the older hint of its key, so that its replay does not bring the older value back. The error of
+// a write kept as a hint wraps replication.ErrHinted. at is the position of the write, kept with the hint. A write the
+// replica refused for its quota is not kept, it would be refused again.
+func (g *GrpcServer) writeReplica(ctx context.Context, shard int, at uint64, hint replication.Hint, write func(ctx context.Context) error) error {
+	keep := func(err error) bool { return !overQuota(err) }
+	return g.hints.Write(ctx, shard, hint, at, keep, func(ctx context.Context) error {
+		if !g.detector.Alive(shard) {
+			return gossip.ErrSuspected
+		}
+		err := write(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to write on a replica", "key", hint.Key, "delete", hint.Delete, "replica", shard, "error", err)
+		}
+		return err
+	})
+}
+
+// replay writes a hint on the replica it was kept for. A hint the replica refuses for its quota is dropped.
+func (g *GrpcServer) replay(ctx context.Context, shard int, hint replication.Hint) error {
+	ctx, cancelFunc := context.WithTimeout(ctx, g.timeouts.Write)
+	defer cancelFunc()
+
+	var err error
+	if hint.Delete {
+		_, err = g.PeerConnections[shard].Delete(ctx, &proto.DeleteRequest{Key: hint.Key, Namespace: hint.Namespace})
+	} else {
+		_, err = g.PeerConnections[shard].Set(ctx, &proto.SetRequest{Key: hint.Key, Value: string(hint.Value), Namespace: hint.Namespace})
+	}
+
+	if overQuota(err) {
+		slog.WarnContext(ctx, "Dropped a hint over the quota of the replica", "key", hint.Key, "replica", shard, "error", err)
+		return nil
+	}
+	return err
+}
+
+func heartbeatsProto(known gossip.Heartbeats) *proto.GossipMessage {
+	message := &proto.GossipMessage{
+		Heartbeats:  make(map[int32]int64, len(known)),
+		Generations: make(map[int32]int64, len(known)),
+	}
+	for shard, heartbeat := range known {
+		message.Heartbeats[int32(shard)] = heartbeat.Counter
+		message.Generations[int32(shard)] = heartbeat.Generation
+	}
+	return message
+}
+
+func heartbeats(message *proto.GossipMessage) gossip.Heartbeats {
+	received := make(gossip.Heartbeats, len(message.Heartbeats))
+	for shard, counter := range message.Heartbeats {
+		received[int(shard)] = gossip.Heartbeat{Generation: message.Generations[shard], Counter: counter}
+	}
+	return received
+}
@@ -2,253 +2,781 @@ package grpc
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/auth"
+	"github.com/EliriaT/distributed-store/coordinator/gossip"
 	"github.com/EliriaT/distributed-store/coordinator/grpc/proto"
+	"github.com/EliriaT/distributed-store/coordinator/latency"
+	"github.com/EliriaT/distributed-store/coordinator/quota"
+	"github.com/EliriaT/distributed-store/coordinator/session"
 	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/logging"
+	"github.com/EliriaT/distributed-store/metrics"
+	"github.com/EliriaT/distributed-store/namespace"
 	"github.com/EliriaT/distributed-store/replication"
 	"github.com/EliriaT/distributed-store/sharding"
-	"github.com/gookit/slog"
+	conalglog "github.com/gookit/slog"
 	"github.com/madalv/conalg/caesar"
-	"log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
 	"slices"
+	"sort"
 	"sync"
-	"time"
+	"sync/atomic"
 )
 
 // GrpcServer uses grpc for node communication.
 type GrpcServer struct {
-	db                db.Database
-	shards            *config.Shards
-	sharder           sharding.Sharder
-	replicator        *replication.OrderedReplicator
-	replicationFactor int
-	consistencyLevel  int
-	PeerConnections   map[int]proto.NodeServiceClient
+	namespaces      *namespace.Registry
+	shards          *config.Shards
+	sharder         sharding.Sharder
+	replicator      *replication.OrderedReplicator
+	detector        *gossip.Detector
+	latency         *latency.Tracker
+	hints           *replication.Hints
+	sessions        *session.Tracker
+	quotas          *quota.Limiter
+	name            string
+	cfg             config.Config
+	timeouts        config.Timeouts
+	PeerConnections map[int]proto.InternalServiceClient
+	peerConns       map[int]*grpc.ClientConn
+	// draining is set once the node stops, and fanouts tracks the writes to the replicas still running
+	draining atomic.Bool
+	fanouts  replication.Fanouts
 	proto.UnimplementedNodeServiceServer
 }
 
-func NewServer(db db.Database, shards *config.Shards, cfg config.Config, envPath string) *GrpcServer {
-	replicator := replication.NewOrderedReplicator(db, shards, cfg)
-	conalg := caesar.InitConalgModule(replicator, envPath, slog.FatalLevel, false)
+func NewServer(namespaces *namespace.Registry, shards *config.Shards, cfg config.Config, envPath string) *GrpcServer {
+	replicator := replication.NewOrderedReplicator(namespaces, shards, cfg)
+	conalg := caesar.InitConalgModule(replicator, envPath, conalglog.FatalLevel, false)
 	replicator.SetConalgModule(conalg)
+	hints := replication.NewHints()
 
 	return &GrpcServer{
-		db:                db,
-		shards:            shards,
-		sharder:           sharding.NewConsistentHasher(cfg),
-		replicationFactor: cfg.ReplicationFactor,
-		consistencyLevel:  cfg.ConsistencyLevel,
-		replicator:        replicator,
-		PeerConnections:   make(map[int]proto.NodeServiceClient),
+		namespaces:      namespaces,
+		shards:          shards,
+		sharder:         sharding.NewConsistentHasher(cfg),
+		replicator:      replicator,
+		detector:        gossip.New(cfg, shards.CurrIdx),
+		latency:         latency.NewTracker(),
+		hints:           hints,
+		sessions:        session.NewTracker(shards.CurrIdx, shards.Count, hints.Oldest),
+		quotas:          quota.New(cfg),
+		name:            cfg.GetShardName(shards.CurrIdx),
+		cfg:             cfg,
+		timeouts:        cfg.Timeouts.WithDefaults(),
+		PeerConnections: make(map[int]proto.InternalServiceClient),
+		peerConns:       make(map[int]*grpc.ClientConn),
 	}
 }
 
-func (g *GrpcServer) Get(ctx context.Context, getCommand *proto.GetRequest) (response *proto.GetResponse, err error) {
-	if getCommand.Coordinator == false {
-		if g.shards.CurrIdx != 0 {
-			time.Sleep(time.Minute)
+// AddPeer registers the long-lived connection to a peer node.
+func (g *GrpcServer) AddPeer(idx int, conn *grpc.ClientConn) {
+	g.peerConns[idx] = conn
+	g.PeerConnections[idx] = proto.NewInternalServiceClient(conn)
+	metrics.WatchPeer(idx, conn)
+}
+
+func (g *GrpcServer) Get(ctx context.Context, getCommand *proto.GetRequest) (*proto.GetResponse, error) {
+	if err := authorize(ctx, auth.Read, getCommand.Key); err != nil {
+		return nil, err
+	}
+
+	ns, err := g.namespace(ctx, getCommand.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := sessionToken(getCommand.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	value, found, err := g.get(ctx, ns, readOptions{session: token, linearizable: getCommand.Linearizable}, getCommand.Key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, notFoundError(getCommand.Key)
+	}
+
+	return &proto.GetResponse{Value: string(value), Session: token.String()}, nil
+}
+
+func (g *GrpcServer) Exists(ctx context.Context, existsCommand *proto.ExistsRequest) (*proto.ExistsResponse, error) {
+	if err := authorize(ctx, auth.Read, existsCommand.Key); err != nil {
+		return nil, err
+	}
+
+	ns, err := g.namespace(ctx, existsCommand.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := sessionToken(existsCommand.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	_, found, err := g.get(ctx, ns, readOptions{session: token, linearizable: existsCommand.Linearizable}, existsCommand.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.ExistsResponse{Exists: found}, nil
+}
+
+func (g *GrpcServer) MGet(ctx context.Context, mgetCommand *proto.MGetRequest) (*proto.MGetResponse, error) {
+	if err := authorize(ctx, auth.Read, mgetCommand.Keys...); err != nil {
+		return nil, err
+	}
+
+	ns, err := g.namespace(ctx, mgetCommand.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := sessionToken(mgetCommand.Session)
+	if err != nil {
+		return nil, err
+	}
+	options := readOptions{session: token, linearizable: mgetCommand.Linearizable}
+
+	type result struct {
+		value []byte
+		found bool
+		err   error
+	}
+
+	results := make([]result, len(mgetCommand.Keys))
+
+	var wg sync.WaitGroup
+	for i, key := range mgetCommand.Keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			results[i].value, results[i].found, results[i].err = g.get(ctx, ns, options, key)
+		}(i, key)
+	}
+	wg.Wait()
+
+	response := &proto.MGetResponse{}
+	for i, key := range mgetCommand.Keys {
+		if results[i].err != nil {
+			return nil, results[i].err
 		}
-		value, err := g.db.GetKey(getCommand.Key)
-		if err != nil {
-			return &proto.GetResponse{
-				Status: 500,
-				Error:  fmt.Sprintf("Failed to write to db the key %s, error: %v", getCommand.Key, err),
-			}, err
 
+		if results[i].found {
+			response.Items = append(response.Items, &proto.KeyValue{Key: key, Value: results[i].value})
+		} else {
+			response.Missing = append(response.Missing, key)
 		}
-		return &proto.GetResponse{
-			Status: 200,
-			Value:  string(value),
-			Error:  "",
-		}, nil
 	}
 
-	shards, err := g.sharder.GetNReplicas(getCommand.Key, g.replicationFactor)
+	return response, nil
+}
+
+// readOptions choose the replicas a read goes to.
+type readOptions struct {
+	// session is the session token of the read, and linearizable asks for a consensus barrier before reading
+	session      session.Token
+	linearizable bool
+}
+
+// get reads the key from the local database when the node is a replica, and from the fastest replica that answers
+// otherwise, hedging the slow ones. With a session token, only the replicas that caught up with it are read.
+func (g *GrpcServer) get(ctx context.Context, ns *namespace.Namespace, options readOptions, key string) (value []byte, found bool, err error) {
+	shards, err := g.sharder.GetNReplicas(key, ns.ReplicationFactor)
 	if err != nil {
-		return &proto.GetResponse{
-			Status: 500,
-			Error:  fmt.Sprintf("Failed to get %d replicas for key %s", g.replicationFactor, getCommand.Key),
-		}, err
+		return nil, false, placementError(key, ns.ReplicationFactor, err)
 	}
 
-	var value []byte
+	waitCtx, cancel := context.WithTimeout(ctx, g.timeouts.Read)
+	shards, err = g.sessions.Wait(waitCtx, shards, options.session)
+	cancel()
+	if err != nil {
+		metrics.ConsistencyMiss(metrics.GRPC, "get")
+		return nil, false, contextError(err)
+	}
+
+	if options.linearizable {
+		return g.linearizableGet(ctx, ns, key, shards)
+	}
 
 	if slices.Contains(shards, g.shards.CurrIdx) {
-		value, err = g.db.GetKey(getCommand.Key)
+		value, err = ns.DB.GetKey(key)
 
 		if err == nil {
-			log.Printf("Get processed on coordinator node %d, key = %s, value = %s", g.shards.CurrIdx, getCommand.Key, string(value))
-			return &proto.GetResponse{
-				Status: 200,
-				Value:  string(value),
-				Error:  "",
-			}, nil
+			logging.Sampled(ctx, "Get processed on the coordinator", "key", key, logging.Value(string(value)))
+			return value, value != nil, nil
 		}
 	}
 
-	for _, shard := range shards {
-		getCommand.Coordinator = false
+	peers := make([]int, 0, len(shards))
+	for _, shard := range g.detector.Targets(shards) {
+		if shard != g.shards.CurrIdx {
+			peers = append(peers, shard)
+		}
+	}
 
-		ctx2, cancelFunc := context.WithTimeout(context.Background(), time.Second)
+	// a key that is not found comes back as a nil response
+	response, replica, err := latency.Hedged(ctx, g.latency, peers, func(ctx context.Context, shard int) (*proto.GetResponse, error) {
+		ctx, cancelFunc := context.WithTimeout(ctx, g.timeouts.Read)
 		defer cancelFunc()
 
-		response, err = g.PeerConnections[shard].Get(ctx2, getCommand)
-		if err != nil {
-			continue
+		response, err := g.PeerConnections[shard].Get(ctx, &proto.GetRequest{Key: key, Namespace: ns.Name})
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
 		}
+		return response, err
+	})
+	if err == nil {
+		if response == nil {
+			return nil, false, nil
+		}
+		logging.Sampled(ctx, "Get processed on a replica", "replica", replica, "key", key, logging.Value(response.Value))
+		return []byte(response.Value), true, nil
+	}
+
+	metrics.ConsistencyMiss(metrics.GRPC, "get")
+	if ctx.Err() != nil {
+		return nil, false, contextError(ctx.Err())
+	}
+	return nil, false, status.Errorf(codes.Unavailable, "failed to get key %s from all replicas %v", key, shards)
+}
 
-		log.Printf("Get processed on shard node %d, key = %s, value = %s", shard, getCommand.Key, string(value))
-		return &proto.GetResponse{
-			Status: 200,
-			Value:  response.Value,
-			Error:  "",
-		}, nil
+// linearizableGet reads the key on a replica once a barrier on the key, ordered by the consensus module after the
+// earlier writes of the key, executed there. The coordinator reads its own database when it is a replica, and asks
+// the other replicas one after the other, from the fastest, until one answers.
+func (g *GrpcServer) linearizableGet(ctx context.Context, ns *namespace.Namespace, key string, shards []int) (value []byte, found bool, err error) {
+	order := g.latency.Order(g.detector.Targets(shards))
+	if slices.Contains(order, g.shards.CurrIdx) {
+		order = append([]int{g.shards.CurrIdx}, slices.DeleteFunc(order, func(shard int) bool { return shard == g.shards.CurrIdx })...)
 	}
 
-	return &proto.GetResponse{
-		Status: 424,
-		Value:  fmt.Sprintf("Failed to get succesfully key %s from all replicas, status: %d, error: %v", getCommand.Key, 424, err),
-		Error:  "",
-	}, nil
+	for _, shard := range order {
+		attemptCtx, cancel := context.WithTimeout(ctx, g.timeouts.Read)
+		if shard == g.shards.CurrIdx {
+			if err = g.replicator.Barrier(attemptCtx, ns.Name, key); err == nil {
+				value, err = ns.DB.GetKey(key)
+				found = value != nil
+			}
+		} else {
+			var response *proto.GetResponse
+			response, err = g.PeerConnections[shard].Get(attemptCtx, &proto.GetRequest{Key: key, Namespace: ns.Name, Linearizable: true})
+			switch {
+			case status.Code(err) == codes.NotFound:
+				value, found, err = nil, false, nil
+			case err == nil:
+				value, found = []byte(response.Value), true
+			}
+		}
+		cancel()
+
+		if err == nil {
+			logging.Sampled(ctx, "Linearizable get processed", "replica", shard, "key", key, logging.Value(string(value)))
+			return value, found, nil
+		}
+		slog.WarnContext(ctx, "Failed a linearizable get", "replica", shard, "key", key, "error", err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(order) == 0 {
+		err = latency.ErrNoReplica
+	}
+
+	metrics.ConsistencyMiss(metrics.GRPC, "get")
+	if ctx.Err() != nil {
+		return nil, false, contextError(ctx.Err())
+	}
+	return nil, false, status.Errorf(codes.Unavailable, "failed a linearizable get of key %s on all replicas %v: %v", key, shards, err)
 }
 
-func (g *GrpcServer) Set(ctx context.Context, setCommand *proto.SetRequest) (response *proto.SetResponse, err error) {
-	key := setCommand.Key
-	value := setCommand.Value
+func (g *GrpcServer) Set(ctx context.Context, setCommand *proto.SetRequest) (*proto.SetResponse, error) {
+	if err := authorize(ctx, auth.Write, setCommand.Key); err != nil {
+		return nil, err
+	}
+
+	ns, err := g.namespace(ctx, setCommand.Namespace)
+	if err != nil {
+		return nil, err
+	}
 
-	if setCommand.Coordinator == false {
-		if g.shards.CurrIdx != 0 {
-			time.Sleep(time.Minute)
+	mode, err := writeMode(setCommand.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := sessionToken(setCommand.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	result, token, err := g.set(ctx, ns, mode, token, setCommand.Key, []byte(setCommand.Value))
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.SetResponse{ReplicatedOn: result.ReplicatedOn, Durability: result.Durability, HintedOn: result.HintedOn, Session: token.String()}, nil
+}
+
+func (g *GrpcServer) MSet(ctx context.Context, msetCommand *proto.MSetRequest) (*proto.MSetResponse, error) {
+	for _, item := range msetCommand.Items {
+		if err := authorize(ctx, auth.Write, item.Key); err != nil {
+			return nil, err
 		}
+	}
+
+	ns, err := g.namespace(ctx, msetCommand.Namespace)
+	if err != nil {
+		return nil, err
+	}
 
-		err = g.db.SetKey(key, []byte(value))
+	mode, err := writeMode(msetCommand.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := sessionToken(msetCommand.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*proto.WriteResult, len(msetCommand.Items))
+	tokens := make([]session.Token, len(msetCommand.Items))
+	errs := make([]error, len(msetCommand.Items))
+
+	var wg sync.WaitGroup
+	for i, item := range msetCommand.Items {
+		wg.Add(1)
+		go func(i int, item *proto.KeyValue) {
+			defer wg.Done()
+
+			results[i], tokens[i], errs[i] = g.set(ctx, ns, mode, token, item.Key, item.Value)
+		}(i, item)
+	}
+	wg.Wait()
+
+	// the first failed key decides the status, the other keys may still have been written
+	for i, err := range errs {
 		if err != nil {
-			return &proto.SetResponse{
-				Status: 500,
-				Error:  fmt.Sprintf("Failed to write to db the key %s, error: %v", key, err),
-			}, err
+			return nil, err
 		}
+		token = token.Merge(tokens[i])
+	}
+
+	return &proto.MSetResponse{Results: results, Session: token.String()}, nil
+}
 
-		return &proto.SetResponse{
-			Status: 200,
-			Error:  "",
-		}, nil
+// set writes the key on its replicas, and returns the session token including the write.
+func (g *GrpcServer) set(ctx context.Context, ns *namespace.Namespace, mode replication.WriteMode, token session.Token, key string, value []byte) (*proto.WriteResult, session.Token, error) {
+	if err := g.quotas.CheckValue(ns, value); err != nil {
+		return nil, nil, quotaError(err)
 	}
 
 	// Add to the order replicator the set command
-	g.replicator.Replicate(key, value)
+	g.replicator.Replicate(ctx, ns.Name, key, value)
 
-	shards, err := g.sharder.GetNReplicas(key, g.replicationFactor)
+	shards, err := g.sharder.GetNReplicas(key, ns.ReplicationFactor)
 	if err != nil {
-		return &proto.SetResponse{
-			Status: 500,
-			Error:  fmt.Sprintf("Failed to get %d replicas for key %s", g.replicationFactor, key),
-		}, err
+		return nil, nil, placementError(key, ns.ReplicationFactor, err)
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(g.consistencyLevel)
-	errCh := make(chan error, g.replicationFactor)
-	successCh := make(chan int, g.replicationFactor)
-	successCounter := 0
-	errorCounter := 0
+	acks := mode.Acks(ns.ReplicationFactor, ns.ConsistencyLevel).Coordinated(slices.Contains(shards, g.shards.CurrIdx))
+	at := g.sessions.Begin(shards)
+	replicatedOn, hintedOn, err := g.replicate(ctx, acks, at, shards, func(ctx context.Context, shard int) error {
+		if shard == g.shards.CurrIdx {
+			if err := g.quotas.CheckWrite(ns, key, value); err != nil {
+				return err
+			}
+			return ns.DB.SetKey(key, value)
+		}
 
-	for i, shard := range shards {
-		var closure func(shard int, errCh chan<- error)
+		return g.writeReplica(ctx, shard, at, replication.Hint{Namespace: ns.Name, Key: key, Value: value}, func(ctx context.Context) error {
+			ctx2, cancelFunc := context.WithTimeout(ctx, g.timeouts.Write)
+			defer cancelFunc()
+
+			_, err := g.PeerConnections[shard].Set(ctx2, &proto.SetRequest{Key: key, Value: string(value), Namespace: ns.Name})
+			return err
+		})
+	})
+
+	result, err := g.acknowledged(ctx, "set", acks, key, replicatedOn, hintedOn, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, g.sessions.Token(token, at), nil
+}
+
+// acknowledged checks what a write reached against its acknowledgements, and returns the result reported to the client.
+func (g *GrpcServer) acknowledged(ctx context.Context, operation string, acks replication.Acks, key string, replicatedOn, hintedOn []int32, err error) (*proto.WriteResult, error) {
+	durability := acks.Durability(len(replicatedOn), len(hintedOn), err)
+
+	if durability == replication.DurabilityFailed {
+		metrics.ConsistencyMiss(metrics.GRPC, operation)
+		switch {
+		case ctx.Err() != nil:
+			return nil, contextError(ctx.Err())
+		case overQuota(err):
+			return nil, quotaError(err)
+		case acks.Local:
+			return nil, internalError("could not write key %q on the coordinator: %v", key, err)
+		}
+		return nil, unavailableError(key, replicatedOn, acks.Replicas, err)
+	}
+
+	return &proto.WriteResult{Key: key, ReplicatedOn: replicatedOn, Durability: durability, HintedOn: hintedOn}, nil
+}
+
+func (g *GrpcServer) Delete(ctx context.Context, deleteCommand *proto.DeleteRequest) (*proto.SetResponse, error) {
+	if err := authorize(ctx, auth.Write, deleteCommand.Key); err != nil {
+		return nil, err
+	}
+
+	key := deleteCommand.Key
 
+	ns, err := g.namespace(ctx, deleteCommand.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := writeMode(deleteCommand.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := sessionToken(deleteCommand.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	g.replicator.ReplicateDelete(ctx, ns.Name, key)
+
+	shards, err := g.sharder.GetNReplicas(key, ns.ReplicationFactor)
+	if err != nil {
+		return nil, placementError(key, ns.ReplicationFactor, err)
+	}
+
+	acks := mode.Acks(ns.ReplicationFactor, ns.ConsistencyLevel).Coordinated(slices.Contains(shards, g.shards.CurrIdx))
+	at := g.sessions.Begin(shards)
+	replicatedOn, hintedOn, err := g.replicate(ctx, acks, at, shards, func(ctx context.Context, shard int) error {
 		if shard == g.shards.CurrIdx {
-			closure = func(shard int, errCh chan<- error) {
-				err = g.db.SetKey(key, []byte(value))
-				if err != nil {
-					errCh <- err
-					return
-				}
-				successCh <- shard
-			}
+			return ns.DB.DeleteKey(key)
+		}
+
+		return g.writeReplica(ctx, shard, at, replication.Hint{Namespace: ns.Name, Key: key, Delete: true}, func(ctx context.Context) error {
+			ctx2, cancelFunc := context.WithTimeout(ctx, g.timeouts.Write)
+			defer cancelFunc()
+
+			_, err := g.PeerConnections[shard].Delete(ctx2, &proto.DeleteRequest{Key: key, Namespace: ns.Name})
+			return err
+		})
+	})
+
+	result, err := g.acknowledged(ctx, "delete", acks, key, replicatedOn, hintedOn, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.SetResponse{ReplicatedOn: result.ReplicatedOn, Durability: result.Durability, HintedOn: result.HintedOn, Session: g.sessions.Token(token, at).String()}, nil
+}
+
+// Scan streams the keys starting with a prefix in key order. It merges the keys of all shards,
+// keeping from every shard only the keys it is a replica for.
+func (g *GrpcServer) Scan(scanCommand *proto.ScanRequest, stream proto.NodeService_ScanServer) error {
+	ns, err := g.namespace(stream.Context(), scanCommand.Namespace)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string][]byte)
+	var scanErr error
+
+	for shard := 0; shard < g.shards.Count; shard++ {
+		var items []db.KeyValue
+		var err error
+
+		if shard == g.shards.CurrIdx {
+			items, err = ns.DB.Scan(scanCommand.Prefix, 0)
+		} else if !g.detector.Alive(shard) {
+			err = gossip.ErrSuspected
 		} else {
-			closure = func(shard int, errCh chan<- error) {
-				setCommand.Coordinator = false
-
-				ctx2, cancelFunc := context.WithTimeout(context.Background(), time.Second)
-				defer cancelFunc()
-
-				_, err = g.PeerConnections[shard].Set(ctx2, setCommand)
-				if err != nil {
-					errCh <- err
-					return
-				}
-				successCh <- shard
+			items, err = g.scanPeer(stream.Context(), shard, ns.Name, scanCommand.Prefix)
+		}
+
+		if err != nil {
+			slog.WarnContext(stream.Context(), "Failed to scan", "prefix", scanCommand.Prefix, "replica", shard, "error", err)
+			scanErr = err
+			continue
+		}
+
+		for _, item := range items {
+			// the keys the caller may not read are left out
+			if !auth.Allowed(stream.Context(), auth.Read, item.Key) {
+				continue
+			}
+
+			replicas, err := g.sharder.GetNReplicas(item.Key, ns.ReplicationFactor)
+			if err == nil && slices.Contains(replicas, shard) {
+				merged[item.Key] = item.Value
 			}
 		}
+	}
 
-		if i < g.consistencyLevel {
-			go func(shard int, errCh chan<- error) {
-				closure(shard, errCh)
-				defer wg.Done()
-			}(shard, errCh)
-		} else {
-			go closure(shard, errCh)
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if scanCommand.Limit > 0 && len(keys) > int(scanCommand.Limit) {
+		keys = keys[:scanCommand.Limit]
+	}
+
+	for _, key := range keys {
+		if err := stream.Send(&proto.KeyValue{Key: key, Value: merged[key]}); err != nil {
+			return err
 		}
 	}
 
-	wg.Wait()
+	if scanErr != nil {
+		if err := stream.Context().Err(); err != nil {
+			return contextError(err)
+		}
+		return status.Errorf(codes.Unavailable, "scan is incomplete, some shards could not be scanned: %v", scanErr)
+	}
+	return nil
+}
 
-	replicatedOn := make([]int32, 0)
+func (g *GrpcServer) scanPeer(ctx context.Context, shard int, namespace, prefix string) ([]db.KeyValue, error) {
+	ctx2, cancelFunc := context.WithTimeout(ctx, g.timeouts.Scan)
+	defer cancelFunc()
 
-outerLoop:
+	stream, err := g.PeerConnections[shard].Scan(ctx2, &proto.ScanRequest{Prefix: prefix, Namespace: namespace})
+	if err != nil {
+		return nil, err
+	}
+
+	var items []db.KeyValue
 	for {
-		select {
-		case replicatedShard := <-successCh:
-			replicatedOn = append(replicatedOn, int32(replicatedShard))
-			successCounter++
-			if successCounter == g.consistencyLevel {
-				break outerLoop
-			}
+		item, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, db.KeyValue{Key: item.Key, Value: item.Value})
+	}
+}
 
-			if errorCounter+successCounter >= g.replicationFactor {
-				break outerLoop
-			}
-		default:
-			<-errCh
-			errorCounter++
-			if errorCounter+successCounter >= g.replicationFactor {
-				break outerLoop
-			}
+// replicate sends a write to every replica shard with replication.Fanouts.Replicate. at is the position of the
+// write, Begun for the shards. Every replica that stored the write or got a hint kept for it is Done with it, and
+// the others Missed it.
+func (g *GrpcServer) replicate(ctx context.Context, acks replication.Acks, at uint64, shards []int, write func(ctx context.Context, shard int) error) (replicatedOn, hintedOn []int32, err error) {
+	replicated, hinted, err := g.fanouts.Replicate(ctx, acks, g.shards.CurrIdx, shards, write, func(shard int, err error) {
+		g.ended(shard, at, err)
+	})
+	return shardIndexes(replicated), shardIndexes(hinted), err
+}
+
+// ended records the result of a write on a replica.
+func (g *GrpcServer) ended(shard int, at uint64, err error) {
+	if err == nil || errors.Is(err, replication.ErrHinted) {
+		g.sessions.Done(shard, at)
+	} else {
+		g.sessions.Missed(shard, at)
+	}
+	metrics.ObserveReplicaRequest(metrics.GRPC, err)
+}
+
+// shardIndexes returns the indexes of the shards as sent in the responses.
+func shardIndexes(shards []int) []int32 {
+	if shards == nil {
+		return nil
+	}
+	indexes := make([]int32, len(shards))
+	for i, shard := range shards {
+		indexes[i] = int32(shard)
+	}
+	return indexes
+}
+
+func (g *GrpcServer) Topology(ctx context.Context, _ *proto.Empty) (*proto.TopologyResponse, error) {
+	response := &proto.TopologyResponse{
+		ReplicationFactor: int32(g.cfg.ReplicationFactor),
+		ConsistencyLevel:  int32(g.cfg.ConsistencyLevel),
+	}
+
+	for _, shard := range g.cfg.Shards {
+		response.Shards = append(response.Shards, &proto.Shard{
+			Idx:     int32(shard.Idx),
+			Name:    shard.Name,
+			Address: shard.Address,
+		})
+	}
+
+	return response, nil
+}
+
+// Health reports which peers the node currently has a ready connection to.
+func (g *GrpcServer) Health(ctx context.Context, _ *proto.Empty) (*proto.HealthResponse, error) {
+	response := &proto.HealthResponse{
+		Shard: int32(g.shards.CurrIdx),
+		Name:  g.name,
+	}
+
+	for idx, conn := range g.peerConns {
+		state := conn.GetState()
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
+
+		if state == connectivity.Ready || state == connectivity.Idle {
+			response.Reachable = append(response.Reachable, int32(idx))
+		} else {
+			response.Unreachable = append(response.Unreachable, int32(idx))
 		}
 	}
 
-	status := 200
-	if err != nil && len(replicatedOn) != g.consistencyLevel {
-		status = 424
+	slices.Sort(response.Reachable)
+	slices.Sort(response.Unreachable)
+
+	return response, nil
+}
+
+func (g *GrpcServer) DeleteExtraKeys(ctx context.Context, _ *proto.Empty) (*proto.StatusResponse, error) {
+	if err := authorize(ctx, auth.Admin, ""); err != nil {
+		return nil, err
+	}
+
+	for _, ns := range g.namespaces.All() {
+		err := ns.DB.DeleteExtraKeys(func(key string) bool {
+			return g.sharder.Index(key) != g.shards.CurrIdx
+		})
+		if err != nil {
+			return nil, internalError("failed to delete extra keys of namespace %s, error: %v", ns.Name, err)
+		}
+	}
+
+	return &proto.StatusResponse{}, nil
+}
+
+func (g *GrpcServer) Repair(ctx context.Context, _ *proto.Empty) (*proto.StatusResponse, error) {
+	if err := authorize(ctx, auth.Admin, ""); err != nil {
+		return nil, err
 	}
 
-	errorMessage := ""
+	var repaired int
+	var err error
+	for _, ns := range g.namespaces.All() {
+		nsRepaired, nsErr := replication.Repair(ns.DB, g.sharder, g.shards, ns.ReplicationFactor, g.push(ctx, ns))
+		repaired += nsRepaired
+		if nsErr != nil {
+			err = nsErr
+		}
+	}
+	slog.InfoContext(ctx, "Repair done", "pushed", repaired, "error", err)
 	if err != nil {
-		errorMessage = fmt.Sprintf("While replicating encounted error: %v", err)
+		return nil, status.Errorf(codes.Unavailable, "repair pushed %d keys, error: %v", repaired, err)
 	}
 
-	return &proto.SetResponse{
-		Status:       int32(status),
-		ReplicatedOn: replicatedOn,
-		Error:        errorMessage,
-	}, nil
+	return &proto.StatusResponse{Keys: int64(repaired)}, nil
 }
 
-func (g *GrpcServer) DeleteExtraKeys(ctx context.Context, _ *proto.Empty) (*proto.StatusResponse, error) {
-	err := g.db.DeleteExtraKeys(func(key string) bool {
-		return g.sharder.Index(key) != g.shards.CurrIdx
-	})
+func (g *GrpcServer) Rebalance(ctx context.Context, _ *proto.Empty) (*proto.StatusResponse, error) {
+	if err := authorize(ctx, auth.Admin, ""); err != nil {
+		return nil, err
+	}
 
-	status := 200
-	errorMessage := ""
+	var moved int
+	var err error
+	for _, ns := range g.namespaces.All() {
+		nsMoved, nsErr := replication.Rebalance(ns.DB, g.sharder, g.shards, ns.ReplicationFactor, g.push(ctx, ns))
+		moved += nsMoved
+		if nsErr != nil {
+			err = nsErr
+		}
+	}
+	slog.InfoContext(ctx, "Rebalance done", "moved", moved, "error", err)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "rebalance moved %d keys, error: %v", moved, err)
+	}
+
+	return &proto.StatusResponse{Keys: int64(moved)}, nil
+}
+
+func (g *GrpcServer) Stats(ctx context.Context, _ *proto.Empty) (*proto.StatsResponse, error) {
+	if err := authorize(ctx, auth.Admin, ""); err != nil {
+		return nil, err
+	}
+
+	response := &proto.StatsResponse{
+		Shard:      int32(g.shards.CurrIdx),
+		Name:       g.name,
+		Namespaces: make(map[string]int64),
+	}
+
+	for _, ns := range g.namespaces.All() {
+		keys, err := ns.DB.KeyCount()
+		if err != nil {
+			return nil, internalError("failed to count keys of namespace %s, error: %v", ns.Name, err)
+		}
+		response.Namespaces[ns.Name] = int64(keys)
+		response.Keys += int64(keys)
+	}
+
+	return response, nil
+}
+
+func (g *GrpcServer) LogLevel(ctx context.Context, request *proto.LogLevelRequest) (*proto.LogLevelResponse, error) {
+	if err := authorize(ctx, auth.Admin, ""); err != nil {
+		return nil, err
+	}
+
+	if request.Level != "" {
+		if err := logging.SetLevel(request.Level); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		slog.InfoContext(ctx, "Changed the log level", "level", logging.Level().String())
+	}
+
+	return &proto.LogLevelResponse{Level: logging.Level().String()}, nil
+}
+
+// namespace returns the namespace of a request, if it exists and the caller may use it.
+func (g *GrpcServer) namespace(ctx context.Context, name string) (*namespace.Namespace, error) {
+	ns, err := g.namespaces.Get(name)
 	if err != nil {
-		status = 500
-		errorMessage = fmt.Sprintf("Failed to delete extra keys, error: %v", err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if auth.CheckNamespace(ctx, ns.Name) != nil {
+		return nil, status.Errorf(codes.PermissionDenied, "namespace %q is not allowed", ns.Name)
+	}
+
+	if err := g.quotas.Allow(ctx, ns.Name); err != nil {
+		return nil, quotaError(err)
 	}
 
-	return &proto.StatusResponse{
-		Status: int32(status),
-		Error:  errorMessage,
-	}, err
+	return ns, nil
+}
+
+// push returns a function writing the keys of the namespace on a replica shard, without further replication.
+func (g *GrpcServer) push(ctx context.Context, ns *namespace.Namespace) replication.Push {
+	return func(shard int, item db.KeyValue) error {
+		ctx, cancelFunc := context.WithTimeout(ctx, g.timeouts.Write)
+		defer cancelFunc()
+
+		_, err := g.PeerConnections[shard].Set(ctx, &proto.SetRequest{Key: item.Key, Value: string(item.Value), Namespace: ns.Name})
+		return err
+	}
 }
@@ -0,0 +1,112 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/EliriaT/distributed-store/coordinator/auth"
+	"github.com/EliriaT/distributed-store/coordinator/gossip"
+	"github.com/EliriaT/distributed-store/coordinator/grpc/proto"
+	"github.com/EliriaT/distributed-store/coordinator/health"
+	"time"
+)
+
+// NodeStatus returns what the current shard reports about itself.
+func (g *GrpcServer) NodeStatus() health.NodeStatus {
+	pending, lag := g.replicator.Lag()
+	return health.NodeStatus{
+		Shard:           g.shards.CurrIdx,
+		Name:            g.name,
+		Epoch:           g.cfg.Epoch(),
+		PendingCommands: pending,
+		ReplicationLag:  lag,
+		Peers:           g.peerViews(),
+	}
+}
+
+// cluster asks every peer for its status on the internal connection.
+func (g *GrpcServer) cluster(ctx context.Context) []health.ShardStatus {
+	return health.Cluster(ctx, g.cfg, g.NodeStatus(), func(ctx context.Context, shard int) (health.NodeStatus, error) {
+		peer, ok := g.PeerConnections[shard]
+		if !ok {
+			return health.NodeStatus{}, fmt.Errorf("no connection to shard %d", shard)
+		}
+
+		response, err := peer.Status(ctx, &proto.Empty{})
+		if err != nil {
+			return health.NodeStatus{}, err
+		}
+		return nodeStatus(response), nil
+	})
+}
+
+// ReadinessChecks returns the conditions for the node to serve requests: the node is not stopping, the databases
+// are open, the consensus module runs and enough shards are reachable for the consistency level of the default
+// namespace.
+func (g *GrpcServer) ReadinessChecks() []health.Check {
+	return []health.Check{
+		health.Draining(g.draining.Load),
+		health.Databases(g.namespaces),
+		health.Consensus(g.replicator.Ready),
+		health.Peers(g.cfg, g.cluster),
+	}
+}
+
+// ClusterStatus reports the reachability, latency, topology epoch and replication lag of every shard.
+func (g *GrpcServer) ClusterStatus(ctx context.Context, _ *proto.Empty) (*proto.ClusterStatusResponse, error) {
+	if err := authorize(ctx, auth.Admin, ""); err != nil {
+		return nil, err
+	}
+
+	response := &proto.ClusterStatusResponse{Coordinator: int32(g.shards.CurrIdx), Epoch: g.cfg.Epoch()}
+	for _, shard := range g.cluster(ctx) {
+		response.Shards = append(response.Shards, &proto.ShardStatus{
+			Node:          nodeStatusProto(shard.NodeStatus),
+			Address:       shard.Address,
+			Reachable:     shard.Reachable,
+			LatencyMicros: shard.Latency.Microseconds(),
+			Error:         shard.Error,
+		})
+	}
+
+	return response, nil
+}
+
+func nodeStatusProto(status health.NodeStatus) *proto.NodeStatus {
+	response := &proto.NodeStatus{
+		Shard:                int32(status.Shard),
+		Name:                 status.Name,
+		Epoch:                status.Epoch,
+		PendingCommands:      int64(status.PendingCommands),
+		ReplicationLagMillis: status.ReplicationLag.Milliseconds(),
+	}
+	for _, peer := range status.Peers {
+		response.Peers = append(response.Peers, &proto.PeerView{
+			Shard:        int32(peer.Shard),
+			Alive:        peer.Alive,
+			Phi:          peer.Phi,
+			Heartbeat:    peer.Heartbeat,
+			PendingHints: int64(peer.PendingHints),
+		})
+	}
+	return response
+}
+
+func nodeStatus(status *proto.NodeStatus) health.NodeStatus {
+	node := health.NodeStatus{
+		Shard:           int(status.Shard),
+		Name:            status.Name,
+		Epoch:           status.Epoch,
+		PendingCommands: int(status.PendingCommands),
+		ReplicationLag:  time.Duration(status.ReplicationLagMillis) * time.Millisecond,
+	}
+	for _, peer := range status.Peers {
+		node.Peers = append(node.Peers, gossip.PeerView{
+			Shard:        int(peer.Shard),
+			Alive:        peer.Alive,
+			Phi:          peer.Phi,
+			Heartbeat:    peer.Heartbeat,
+			PendingHints: int(peer.PendingHints),
+		})
+	}
+	return node
+}
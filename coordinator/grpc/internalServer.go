@@ -0,0 +1,153 @@
+package grpc
+
+import (
+	"context"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/gossip"
+	"github.com/EliriaT/distributed-store/coordinator/grpc/proto"
+	"github.com/EliriaT/distributed-store/coordinator/health"
+	"github.com/EliriaT/distributed-store/coordinator/session"
+	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/logging"
+	"github.com/EliriaT/distributed-store/namespace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// InternalServer serves the replica to replica calls. Every call acts only on the local database.
+type InternalServer struct {
+	namespaces *namespace.Registry
+	shards     *config.Shards
+	node       Node
+	proto.UnimplementedInternalServiceServer
+}
+
+// Node is the coordinator of the current shard, as seen by the peers.
+type Node interface {
+	NodeStatus() health.NodeStatus
+	ExchangeHeartbeats(heartbeats gossip.Heartbeats) gossip.Heartbeats
+	MergeWatermarks(coordinator int, watermarks session.Watermarks)
+	Barrier(ctx context.Context, namespace, key string) error
+	// CheckWrite checks a write against the storage limits of the namespace on this replica.
+	CheckWrite(ns *namespace.Namespace, key string, value []byte) error
+}
+
+// NewInternalServer creates the server of the internal calls. node reports the state of the current shard to its peers.
+func NewInternalServer(namespaces *namespace.Registry, shards *config.Shards, node Node) *InternalServer {
+	return &InternalServer{namespaces: namespaces, shards: shards, node: node}
+}
+
+// Status reports the status of the current shard to a peer.
+func (i *InternalServer) Status(ctx context.Context, _ *proto.Empty) (*proto.NodeStatus, error) {
+	return nodeStatusProto(i.node.NodeStatus()), nil
+}
+
+// Gossip merges the heartbeats and watermarks gossiped by a peer and answers with the heartbeats the node knows.
+func (i *InternalServer) Gossip(ctx context.Context, message *proto.GossipMessage) (*proto.GossipMessage, error) {
+	if len(message.Watermarks) > 0 {
+		watermarks := make(session.Watermarks, len(message.Watermarks))
+		for replica, watermark := range message.Watermarks {
+			watermarks[int(replica)] = watermark
+		}
+		i.node.MergeWatermarks(int(message.From), watermarks)
+	}
+	return heartbeatsProto(i.node.ExchangeHeartbeats(heartbeats(message))), nil
+}
+
+// db returns the local database of a namespace. The peer already checked the access of the caller.
+func (i *InternalServer) db(name string) (db.Database, error) {
+	ns, err := i.namespace(name)
+	if err != nil {
+		return nil, err
+	}
+	return ns.DB, nil
+}
+
+// namespace returns a local namespace.
+func (i *InternalServer) namespace(name string) (*namespace.Namespace, error) {
+	ns, err := i.namespaces.Get(name)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return ns, nil
+}
+
+func (i *InternalServer) Get(ctx context.Context, getCommand *proto.GetRequest) (*proto.GetResponse, error) {
+	database, err := i.db(getCommand.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// a linearizable read waits for a barrier on the key, so that the writes of the key ordered before it executed
+	if getCommand.Linearizable {
+		if err := i.node.Barrier(ctx, getCommand.Namespace, getCommand.Key); err != nil {
+			if ctx.Err() != nil {
+				return nil, contextError(ctx.Err())
+			}
+			return nil, status.Errorf(codes.Unavailable, "failed a barrier on key %s: %v", getCommand.Key, err)
+		}
+	}
+
+	value, err := database.GetKey(getCommand.Key)
+	if err != nil {
+		return nil, internalError("failed to read from db the key %s, error: %v", getCommand.Key, err)
+	}
+	if value == nil {
+		return nil, notFoundError(getCommand.Key)
+	}
+
+	return &proto.GetResponse{Value: string(value)}, nil
+}
+
+// Set writes a key, refusing with ResourceExhausted a write over the storage limits of the namespace on this replica.
+func (i *InternalServer) Set(ctx context.Context, setCommand *proto.SetRequest) (*proto.SetResponse, error) {
+	ns, err := i.namespace(setCommand.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.node.CheckWrite(ns, setCommand.Key, []byte(setCommand.Value)); err != nil {
+		return nil, quotaError(err)
+	}
+
+	err = ns.DB.SetKey(setCommand.Key, []byte(setCommand.Value))
+	logging.Sampled(ctx, "Replicated on a replica", "key", setCommand.Key, logging.Value(setCommand.Value), "error", err)
+	if err != nil {
+		return nil, internalError("failed to write to db the key %s, error: %v", setCommand.Key, err)
+	}
+
+	return &proto.SetResponse{ReplicatedOn: []int32{int32(i.shards.CurrIdx)}}, nil
+}
+
+func (i *InternalServer) Delete(ctx context.Context, deleteCommand *proto.DeleteRequest) (*proto.SetResponse, error) {
+	database, err := i.db(deleteCommand.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.DeleteKey(deleteCommand.Key)
+	if err != nil {
+		return nil, internalError("failed to delete from db the key %s, error: %v", deleteCommand.Key, err)
+	}
+
+	return &proto.SetResponse{ReplicatedOn: []int32{int32(i.shards.CurrIdx)}}, nil
+}
+
+func (i *InternalServer) Scan(scanCommand *proto.ScanRequest, stream proto.InternalService_ScanServer) error {
+	database, err := i.db(scanCommand.Namespace)
+	if err != nil {
+		return err
+	}
+
+	items, err := database.Scan(scanCommand.Prefix, int(scanCommand.Limit))
+	if err != nil {
+		return internalError("failed to scan the prefix %s, error: %v", scanCommand.Prefix, err)
+	}
+
+	for _, item := range items {
+		if err = stream.Send(&proto.KeyValue{Key: item.Key, Value: item.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
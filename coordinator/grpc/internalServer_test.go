@@ -0,0 +1,203 @@
+package grpc_test
+
+import (
+	"context"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/gossip"
+	grpcCoordinator "github.com/EliriaT/distributed-store/coordinator/grpc"
+	"github.com/EliriaT/distributed-store/coordinator/grpc/proto"
+	"github.com/EliriaT/distributed-store/coordinator/health"
+	"github.com/EliriaT/distributed-store/coordinator/quota"
+	"github.com/EliriaT/distributed-store/coordinator/session"
+	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/namespace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// node reports a fixed status and knows only its own heartbeat.
+type node struct{}
+
+func (node) NodeStatus() health.NodeStatus {
+	return health.NodeStatus{
+		Name:            "Chisinau",
+		Epoch:           "e1",
+		PendingCommands: 3,
+		ReplicationLag:  1500 * time.Millisecond,
+		Peers:           []gossip.PeerView{{Shard: 1, Alive: true, Phi: 0.5, Heartbeat: 7, PendingHints: 2}},
+	}
+}
+
+func (node) ExchangeHeartbeats(heartbeats gossip.Heartbeats) gossip.Heartbeats {
+	return gossip.Heartbeats{0: {Generation: 9, Counter: 42}}
+}
+
+func (node) MergeWatermarks(coordinator int, watermarks session.Watermarks) {}
+
+func (node) Barrier(ctx context.Context, namespace, key string) error { return nil }
+
+// CheckWrite refuses the values named "full", as a replica over its storage limits.
+func (node) CheckWrite(ns *namespace.Namespace, key string, value []byte) error {
+	if string(value) == "full" {
+		return &quota.Exceeded{Subject: "namespace:" + ns.Name, Description: "namespace is full: 2 of 2 keys"}
+	}
+	return nil
+}
+
+func createInternalClient(t *testing.T) proto.InternalServiceClient {
+	t.Helper()
+
+	f, err := os.CreateTemp(os.TempDir(), "kvdb")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	name := f.Name()
+	f.Close()
+	t.Cleanup(func() { os.Remove(name) })
+
+	database, closeFunc, err := db.NewBoltDatabase(name, db.BoltOptions{})
+	if err != nil {
+		t.Fatalf("Could not create a new database: %v", err)
+	}
+	t.Cleanup(func() { closeFunc() })
+
+	namespaces, err := namespace.NewRegistry(database, config.Config{
+		ReplicationFactor: 1,
+		ConsistencyLevel:  1,
+		Namespaces:        []config.Namespace{{Name: "cache"}},
+	})
+	if err != nil {
+		t.Fatalf("Could not open the namespaces: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	proto.RegisterInternalServiceServer(s, grpcCoordinator.NewInternalServer(namespaces, &config.Shards{Count: 1, CurrIdx: 0}, node{}))
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Could not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return proto.NewInternalServiceClient(conn)
+}
+
+func TestInternalStatus(t *testing.T) {
+	c := createInternalClient(t)
+
+	response, err := c.Status(context.Background(), &proto.Empty{})
+	if err != nil {
+		t.Fatalf("Could not get the status: %v", err)
+	}
+	if response.Name != "Chisinau" || response.Epoch != "e1" || response.PendingCommands != 3 || response.ReplicationLagMillis != 1500 {
+		t.Errorf("Unexpected status: %v", response)
+	}
+	if len(response.Peers) != 1 || response.Peers[0].Shard != 1 || !response.Peers[0].Alive || response.Peers[0].PendingHints != 2 {
+		t.Errorf("Unexpected peer views: %v", response.Peers)
+	}
+}
+
+func TestInternalGossip(t *testing.T) {
+	c := createInternalClient(t)
+
+	response, err := c.Gossip(context.Background(), &proto.GossipMessage{Heartbeats: map[int32]int64{1: 3}, Generations: map[int32]int64{1: 8}})
+	if err != nil {
+		t.Fatalf("Could not gossip: %v", err)
+	}
+	if response.Heartbeats[0] != 42 || response.Generations[0] != 9 {
+		t.Errorf("Unexpected heartbeats: %v", response.Heartbeats)
+	}
+}
+
+func TestInternalGetSet(t *testing.T) {
+	c := createInternalClient(t)
+	ctx := context.Background()
+
+	if _, err := c.Set(ctx, &proto.SetRequest{Key: "utm", Value: "fcim"}); err != nil {
+		t.Fatalf("Could not set the key: %v", err)
+	}
+
+	response, err := c.Get(ctx, &proto.GetRequest{Key: "utm"})
+	if err != nil {
+		t.Fatalf("Could not get the key: %v", err)
+	}
+	if response.Value != "fcim" {
+		t.Errorf("Unexpected value: got %q, want %q", response.Value, "fcim")
+	}
+}
+
+func TestInternalGetNotFound(t *testing.T) {
+	c := createInternalClient(t)
+
+	_, err := c.Get(context.Background(), &proto.GetRequest{Key: "missing"})
+	st := status.Convert(err)
+	if st.Code() != codes.NotFound {
+		t.Fatalf("Unexpected code: got %v, want %v", st.Code(), codes.NotFound)
+	}
+
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("Unexpected number of details: got %d, want 1", len(details))
+	}
+	if info, ok := details[0].(*errdetails.ResourceInfo); !ok || info.ResourceName != "missing" {
+		t.Errorf("Unexpected details: %v", details[0])
+	}
+}
+
+func TestInternalNamespaces(t *testing.T) {
+	c := createInternalClient(t)
+	ctx := context.Background()
+
+	if _, err := c.Set(ctx, &proto.SetRequest{Key: "utm", Value: "cached", Namespace: "cache"}); err != nil {
+		t.Fatalf("Could not set the key: %v", err)
+	}
+
+	if _, err := c.Get(ctx, &proto.GetRequest{Key: "utm"}); status.Code(err) != codes.NotFound {
+		t.Errorf("The key of the cache namespace should not be in the default namespace, got %v", err)
+	}
+
+	response, err := c.Get(ctx, &proto.GetRequest{Key: "utm", Namespace: "cache"})
+	if err != nil {
+		t.Fatalf("Could not get the key: %v", err)
+	}
+	if response.Value != "cached" {
+		t.Errorf("Unexpected value: got %q, want %q", response.Value, "cached")
+	}
+
+	if _, err = c.Get(ctx, &proto.GetRequest{Key: "utm", Namespace: "missing"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected code for an unknown namespace: got %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+}
+
+func TestInternalSetOverQuota(t *testing.T) {
+	c := createInternalClient(t)
+	ctx := context.Background()
+
+	_, err := c.Set(ctx, &proto.SetRequest{Key: "utm", Value: "full", Namespace: "cache"})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("Unexpected code: got %v, want %v", st.Code(), codes.ResourceExhausted)
+	}
+	if details := st.Details(); len(details) != 1 {
+		t.Errorf("Unexpected details: %v", details)
+	} else if failure, ok := details[0].(*errdetails.QuotaFailure); !ok || failure.Violations[0].Subject != "namespace:cache" {
+		t.Errorf("Unexpected details: %v", details[0])
+	}
+
+	if _, err := c.Get(ctx, &proto.GetRequest{Key: "utm", Namespace: "cache"}); status.Code(err) != codes.NotFound {
+		t.Errorf("The refused write should not be stored, got %v", err)
+	}
+}
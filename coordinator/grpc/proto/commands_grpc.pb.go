@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
 // versions:
-// - protoc-gen-go-grpc v1.2.0
+// - protoc-gen-go-grpc v1.3.0
 // - protoc             v3.12.4
 // source: coordinator/grpc/proto/commands.proto
 
@@ -18,13 +18,43 @@ import (
 // Requires gRPC-Go v1.32.0 or later.
 const _ = grpc.SupportPackageIsVersion7
 
+const (
+	NodeService_Get_FullMethodName             = "/commands.NodeService/Get"
+	NodeService_Set_FullMethodName             = "/commands.NodeService/Set"
+	NodeService_Delete_FullMethodName          = "/commands.NodeService/Delete"
+	NodeService_Exists_FullMethodName          = "/commands.NodeService/Exists"
+	NodeService_MGet_FullMethodName            = "/commands.NodeService/MGet"
+	NodeService_MSet_FullMethodName            = "/commands.NodeService/MSet"
+	NodeService_Scan_FullMethodName            = "/commands.NodeService/Scan"
+	NodeService_Topology_FullMethodName        = "/commands.NodeService/Topology"
+	NodeService_Health_FullMethodName          = "/commands.NodeService/Health"
+	NodeService_DeleteExtraKeys_FullMethodName = "/commands.NodeService/DeleteExtraKeys"
+	NodeService_Repair_FullMethodName          = "/commands.NodeService/Repair"
+	NodeService_Rebalance_FullMethodName       = "/commands.NodeService/Rebalance"
+	NodeService_Stats_FullMethodName           = "/commands.NodeService/Stats"
+	NodeService_LogLevel_FullMethodName        = "/commands.NodeService/LogLevel"
+	NodeService_ClusterStatus_FullMethodName   = "/commands.NodeService/ClusterStatus"
+)
+
 // NodeServiceClient is the client API for NodeService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type NodeServiceClient interface {
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	Exists(ctx context.Context, in *ExistsRequest, opts ...grpc.CallOption) (*ExistsResponse, error)
+	MGet(ctx context.Context, in *MGetRequest, opts ...grpc.CallOption) (*MGetResponse, error)
+	MSet(ctx context.Context, in *MSetRequest, opts ...grpc.CallOption) (*MSetResponse, error)
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (NodeService_ScanClient, error)
+	Topology(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*TopologyResponse, error)
+	Health(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*HealthResponse, error)
 	DeleteExtraKeys(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatusResponse, error)
+	Repair(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatusResponse, error)
+	Rebalance(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatusResponse, error)
+	Stats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatsResponse, error)
+	LogLevel(ctx context.Context, in *LogLevelRequest, opts ...grpc.CallOption) (*LogLevelResponse, error)
+	ClusterStatus(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ClusterStatusResponse, error)
 }
 
 type nodeServiceClient struct {
@@ -37,7 +67,7 @@ func NewNodeServiceClient(cc grpc.ClientConnInterface) NodeServiceClient {
 
 func (c *nodeServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
 	out := new(GetResponse)
-	err := c.cc.Invoke(ctx, "/commands.NodeService/Get", in, out, opts...)
+	err := c.cc.Invoke(ctx, NodeService_Get_FullMethodName, in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +76,93 @@ func (c *nodeServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grp
 
 func (c *nodeServiceClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
 	out := new(SetResponse)
-	err := c.cc.Invoke(ctx, "/commands.NodeService/Set", in, out, opts...)
+	err := c.cc.Invoke(ctx, NodeService_Set_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, NodeService_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) Exists(ctx context.Context, in *ExistsRequest, opts ...grpc.CallOption) (*ExistsResponse, error) {
+	out := new(ExistsResponse)
+	err := c.cc.Invoke(ctx, NodeService_Exists_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) MGet(ctx context.Context, in *MGetRequest, opts ...grpc.CallOption) (*MGetResponse, error) {
+	out := new(MGetResponse)
+	err := c.cc.Invoke(ctx, NodeService_MGet_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) MSet(ctx context.Context, in *MSetRequest, opts ...grpc.CallOption) (*MSetResponse, error) {
+	out := new(MSetResponse)
+	err := c.cc.Invoke(ctx, NodeService_MSet_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (NodeService_ScanClient, error) {
+	stream, err := c.cc.NewStream(ctx, &NodeService_ServiceDesc.Streams[0], NodeService_Scan_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &nodeServiceScanClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type NodeService_ScanClient interface {
+	Recv() (*KeyValue, error)
+	grpc.ClientStream
+}
+
+type nodeServiceScanClient struct {
+	grpc.ClientStream
+}
+
+func (x *nodeServiceScanClient) Recv() (*KeyValue, error) {
+	m := new(KeyValue)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *nodeServiceClient) Topology(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*TopologyResponse, error) {
+	out := new(TopologyResponse)
+	err := c.cc.Invoke(ctx, NodeService_Topology_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) Health(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*HealthResponse, error) {
+	out := new(HealthResponse)
+	err := c.cc.Invoke(ctx, NodeService_Health_FullMethodName, in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +171,52 @@ func (c *nodeServiceClient) Set(ctx context.Context, in *SetRequest, opts ...grp
 
 func (c *nodeServiceClient) DeleteExtraKeys(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatusResponse, error) {
 	out := new(StatusResponse)
-	err := c.cc.Invoke(ctx, "/commands.NodeService/DeleteExtraKeys", in, out, opts...)
+	err := c.cc.Invoke(ctx, NodeService_DeleteExtraKeys_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) Repair(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatusResponse, error) {
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, NodeService_Repair_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) Rebalance(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatusResponse, error) {
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, NodeService_Rebalance_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) Stats(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, NodeService_Stats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) LogLevel(ctx context.Context, in *LogLevelRequest, opts ...grpc.CallOption) (*LogLevelResponse, error) {
+	out := new(LogLevelResponse)
+	err := c.cc.Invoke(ctx, NodeService_LogLevel_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeServiceClient) ClusterStatus(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ClusterStatusResponse, error) {
+	out := new(ClusterStatusResponse)
+	err := c.cc.Invoke(ctx, NodeService_ClusterStatus_FullMethodName, in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +229,19 @@ func (c *nodeServiceClient) DeleteExtraKeys(ctx context.Context, in *Empty, opts
 type NodeServiceServer interface {
 	Get(context.Context, *GetRequest) (*GetResponse, error)
 	Set(context.Context, *SetRequest) (*SetResponse, error)
+	Delete(context.Context, *DeleteRequest) (*SetResponse, error)
+	Exists(context.Context, *ExistsRequest) (*ExistsResponse, error)
+	MGet(context.Context, *MGetRequest) (*MGetResponse, error)
+	MSet(context.Context, *MSetRequest) (*MSetResponse, error)
+	Scan(*ScanRequest, NodeService_ScanServer) error
+	Topology(context.Context, *Empty) (*TopologyResponse, error)
+	Health(context.Context, *Empty) (*HealthResponse, error)
 	DeleteExtraKeys(context.Context, *Empty) (*StatusResponse, error)
+	Repair(context.Context, *Empty) (*StatusResponse, error)
+	Rebalance(context.Context, *Empty) (*StatusResponse, error)
+	Stats(context.Context, *Empty) (*StatsResponse, error)
+	LogLevel(context.Context, *LogLevelRequest) (*LogLevelResponse, error)
+	ClusterStatus(context.Context, *Empty) (*ClusterStatusResponse, error)
 }
 
 // UnimplementedNodeServiceServer should be embedded to have forward compatible implementations.
@@ -81,9 +254,45 @@ func (UnimplementedNodeServiceServer) Get(context.Context, *GetRequest) (*GetRes
 func (UnimplementedNodeServiceServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
 }
+func (UnimplementedNodeServiceServer) Delete(context.Context, *DeleteRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedNodeServiceServer) Exists(context.Context, *ExistsRequest) (*ExistsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Exists not implemented")
+}
+func (UnimplementedNodeServiceServer) MGet(context.Context, *MGetRequest) (*MGetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MGet not implemented")
+}
+func (UnimplementedNodeServiceServer) MSet(context.Context, *MSetRequest) (*MSetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MSet not implemented")
+}
+func (UnimplementedNodeServiceServer) Scan(*ScanRequest, NodeService_ScanServer) error {
+	return status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedNodeServiceServer) Topology(context.Context, *Empty) (*TopologyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Topology not implemented")
+}
+func (UnimplementedNodeServiceServer) Health(context.Context, *Empty) (*HealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
 func (UnimplementedNodeServiceServer) DeleteExtraKeys(context.Context, *Empty) (*StatusResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteExtraKeys not implemented")
 }
+func (UnimplementedNodeServiceServer) Repair(context.Context, *Empty) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Repair not implemented")
+}
+func (UnimplementedNodeServiceServer) Rebalance(context.Context, *Empty) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rebalance not implemented")
+}
+func (UnimplementedNodeServiceServer) Stats(context.Context, *Empty) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedNodeServiceServer) LogLevel(context.Context, *LogLevelRequest) (*LogLevelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LogLevel not implemented")
+}
+func (UnimplementedNodeServiceServer) ClusterStatus(context.Context, *Empty) (*ClusterStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClusterStatus not implemented")
+}
 
 // UnsafeNodeServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to NodeServiceServer will
@@ -106,7 +315,7 @@ func _NodeService_Get_Handler(srv interface{}, ctx context.Context, dec func(int
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/commands.NodeService/Get",
+		FullMethod: NodeService_Get_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return srv.(NodeServiceServer).Get(ctx, req.(*GetRequest))
@@ -124,7 +333,7 @@ func _NodeService_Set_Handler(srv interface{}, ctx context.Context, dec func(int
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/commands.NodeService/Set",
+		FullMethod: NodeService_Set_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return srv.(NodeServiceServer).Set(ctx, req.(*SetRequest))
@@ -132,6 +341,135 @@ func _NodeService_Set_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _NodeService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_Exists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExistsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).Exists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_Exists_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).Exists(ctx, req.(*ExistsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_MGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).MGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_MGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).MGet(ctx, req.(*MGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_MSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).MSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_MSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).MSet(ctx, req.(*MSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_Scan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NodeServiceServer).Scan(m, &nodeServiceScanServer{stream})
+}
+
+type NodeService_ScanServer interface {
+	Send(*KeyValue) error
+	grpc.ServerStream
+}
+
+type nodeServiceScanServer struct {
+	grpc.ServerStream
+}
+
+func (x *nodeServiceScanServer) Send(m *KeyValue) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _NodeService_Topology_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).Topology(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_Topology_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).Topology(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_Health_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).Health(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _NodeService_DeleteExtraKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Empty)
 	if err := dec(in); err != nil {
@@ -142,7 +480,7 @@ func _NodeService_DeleteExtraKeys_Handler(srv interface{}, ctx context.Context,
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/commands.NodeService/DeleteExtraKeys",
+		FullMethod: NodeService_DeleteExtraKeys_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
 		return srv.(NodeServiceServer).DeleteExtraKeys(ctx, req.(*Empty))
@@ -150,6 +488,96 @@ func _NodeService_DeleteExtraKeys_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _NodeService_Repair_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).Repair(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_Repair_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).Repair(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_Rebalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).Rebalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_Rebalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).Rebalance(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).Stats(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_LogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogLevelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).LogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_LogLevel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).LogLevel(ctx, req.(*LogLevelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NodeService_ClusterStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NodeServiceServer).ClusterStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NodeService_ClusterStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NodeServiceServer).ClusterStatus(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // NodeService_ServiceDesc is the grpc.ServiceDesc for NodeService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -165,11 +593,362 @@ var NodeService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Set",
 			Handler:    _NodeService_Set_Handler,
 		},
+		{
+			MethodName: "Delete",
+			Handler:    _NodeService_Delete_Handler,
+		},
+		{
+			MethodName: "Exists",
+			Handler:    _NodeService_Exists_Handler,
+		},
+		{
+			MethodName: "MGet",
+			Handler:    _NodeService_MGet_Handler,
+		},
+		{
+			MethodName: "MSet",
+			Handler:    _NodeService_MSet_Handler,
+		},
+		{
+			MethodName: "Topology",
+			Handler:    _NodeService_Topology_Handler,
+		},
+		{
+			MethodName: "Health",
+			Handler:    _NodeService_Health_Handler,
+		},
 		{
 			MethodName: "DeleteExtraKeys",
 			Handler:    _NodeService_DeleteExtraKeys_Handler,
 		},
+		{
+			MethodName: "Repair",
+			Handler:    _NodeService_Repair_Handler,
+		},
+		{
+			MethodName: "Rebalance",
+			Handler:    _NodeService_Rebalance_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _NodeService_Stats_Handler,
+		},
+		{
+			MethodName: "LogLevel",
+			Handler:    _NodeService_LogLevel_Handler,
+		},
+		{
+			MethodName: "ClusterStatus",
+			Handler:    _NodeService_ClusterStatus_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Scan",
+			Handler:       _NodeService_Scan_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "coordinator/grpc/proto/commands.proto",
+}
+
+const (
+	InternalService_Get_FullMethodName    = "/commands.InternalService/Get"
+	InternalService_Set_FullMethodName    = "/commands.InternalService/Set"
+	InternalService_Delete_FullMethodName = "/commands.InternalService/Delete"
+	InternalService_Scan_FullMethodName   = "/commands.InternalService/Scan"
+	InternalService_Status_FullMethodName = "/commands.InternalService/Status"
+	InternalService_Gossip_FullMethodName = "/commands.InternalService/Gossip"
+)
+
+// InternalServiceClient is the client API for InternalService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type InternalServiceClient interface {
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (InternalService_ScanClient, error)
+	Status(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*NodeStatus, error)
+	Gossip(ctx context.Context, in *GossipMessage, opts ...grpc.CallOption) (*GossipMessage, error)
+}
+
+type internalServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewInternalServiceClient(cc grpc.ClientConnInterface) InternalServiceClient {
+	return &internalServiceClient{cc}
+}
+
+func (c *internalServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, InternalService_Get_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *internalServiceClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, InternalService_Set_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *internalServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, InternalService_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *internalServiceClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (InternalService_ScanClient, error) {
+	stream, err := c.cc.NewStream(ctx, &InternalService_ServiceDesc.Streams[0], InternalService_Scan_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &internalServiceScanClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type InternalService_ScanClient interface {
+	Recv() (*KeyValue, error)
+	grpc.ClientStream
+}
+
+type internalServiceScanClient struct {
+	grpc.ClientStream
+}
+
+func (x *internalServiceScanClient) Recv() (*KeyValue, error) {
+	m := new(KeyValue)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *internalServiceClient) Status(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*NodeStatus, error) {
+	out := new(NodeStatus)
+	err := c.cc.Invoke(ctx, InternalService_Status_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *internalServiceClient) Gossip(ctx context.Context, in *GossipMessage, opts ...grpc.CallOption) (*GossipMessage, error) {
+	out := new(GossipMessage)
+	err := c.cc.Invoke(ctx, InternalService_Gossip_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// InternalServiceServer is the server API for InternalService service.
+// All implementations should embed UnimplementedInternalServiceServer
+// for forward compatibility
+type InternalServiceServer interface {
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	Delete(context.Context, *DeleteRequest) (*SetResponse, error)
+	Scan(*ScanRequest, InternalService_ScanServer) error
+	Status(context.Context, *Empty) (*NodeStatus, error)
+	Gossip(context.Context, *GossipMessage) (*GossipMessage, error)
+}
+
+// UnimplementedInternalServiceServer should be embedded to have forward compatible implementations.
+type UnimplementedInternalServiceServer struct {
+}
+
+func (UnimplementedInternalServiceServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedInternalServiceServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedInternalServiceServer) Delete(context.Context, *DeleteRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedInternalServiceServer) Scan(*ScanRequest, InternalService_ScanServer) error {
+	return status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedInternalServiceServer) Status(context.Context, *Empty) (*NodeStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedInternalServiceServer) Gossip(context.Context, *GossipMessage) (*GossipMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Gossip not implemented")
+}
+
+// UnsafeInternalServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to InternalServiceServer will
+// result in compilation errors.
+type UnsafeInternalServiceServer interface {
+	mustEmbedUnimplementedInternalServiceServer()
+}
+
+func RegisterInternalServiceServer(s grpc.ServiceRegistrar, srv InternalServiceServer) {
+	s.RegisterService(&InternalService_ServiceDesc, srv)
+}
+
+func _InternalService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InternalService_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InternalService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InternalService_Scan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(InternalServiceServer).Scan(m, &internalServiceScanServer{stream})
+}
+
+type InternalService_ScanServer interface {
+	Send(*KeyValue) error
+	grpc.ServerStream
+}
+
+type internalServiceScanServer struct {
+	grpc.ServerStream
+}
+
+func (x *internalServiceScanServer) Send(m *KeyValue) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _InternalService_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).Status(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _InternalService_Gossip_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GossipMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InternalServiceServer).Gossip(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: InternalService_Gossip_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InternalServiceServer).Gossip(ctx, req.(*GossipMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// InternalService_ServiceDesc is the grpc.ServiceDesc for InternalService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var InternalService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "commands.InternalService",
+	HandlerType: (*InternalServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _InternalService_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _InternalService_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _InternalService_Delete_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _InternalService_Status_Handler,
+		},
+		{
+			MethodName: "Gossip",
+			Handler:    _InternalService_Gossip_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Scan",
+			Handler:       _InternalService_Scan_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "coordinator/grpc/proto/commands.proto",
 }
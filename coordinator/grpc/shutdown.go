@@ -0,0 +1,41 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Drain makes the readiness checks fail, so that no new calls are routed to the node while it stops.
+func (g *GrpcServer) Drain() {
+	g.draining.Store(true)
+}
+
+// Shutdown waits for the writes to the replicas still running, replays the hints to the replicas that are alive and
+// writes the queued ordered commands. The writes starting after it is called fail with replication.ErrStopping, and
+// the hints not replayed are lost, as they are kept in memory only. Stop serving the public address first, and close
+// the peer connections after. It returns ctx.Err() when ctx is done first.
+func (g *GrpcServer) Shutdown(ctx context.Context) error {
+	g.Drain()
+
+	err := g.fanouts.Close(ctx)
+	if err == nil {
+		g.replayHints(ctx)
+	}
+	if lost := g.pendingHints(); lost > 0 {
+		slog.WarnContext(ctx, "Lost the hints not replayed before stopping", "hints", lost)
+	}
+	if err != nil {
+		return fmt.Errorf("waiting for the replica writes: %w", err)
+	}
+	return g.replicator.Close(ctx)
+}
+
+// pendingHints returns the number of hints kept for all the peers.
+func (g *GrpcServer) pendingHints() int {
+	pending := 0
+	for shard := range g.PeerConnections {
+		pending += g.hints.Pending(shard)
+	}
+	return pending
+}
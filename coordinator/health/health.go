@@ -0,0 +1,225 @@
+// Package health tells whether a node is alive and ready to serve, and reports the status of every shard of the cluster.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/gossip"
+	"github.com/EliriaT/distributed-store/namespace"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeKey is read from every namespace to check that its database is open.
+const probeKey = "__readyz"
+
+// ProbeTimeout bounds the status call to one shard.
+const ProbeTimeout = time.Second
+
+// NodeStatus is what a node reports about itself to the other shards.
+type NodeStatus struct {
+	Shard int    `json:"shard"`
+	Name  string `json:"name"`
+	Epoch string `json:"epoch"`
+	// PendingCommands is the number of ordered commands the node queued but did not write yet,
+	// and ReplicationLag how long the oldest of them waits.
+	PendingCommands int           `json:"pending_commands"`
+	ReplicationLag  time.Duration `json:"replication_lag"`
+	// Peers is what the failure detector of the node knows about the other shards.
+	Peers []gossip.PeerView `json:"peers"`
+}
+
+// ShardStatus is the status of one shard, as seen by the node that probed it.
+type ShardStatus struct {
+	NodeStatus
+	Address   string        `json:"address"`
+	Reachable bool          `json:"reachable"`
+	Latency   time.Duration `json:"latency"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Probe asks a shard for its status.
+type Probe func(ctx context.Context, shard int) (NodeStatus, error)
+
+// Cluster probes every shard of the config but the current one concurrently, and returns the statuses in shard order.
+// The current shard is reported from self.
+func Cluster(ctx context.Context, cfg config.Config, self NodeStatus, probe Probe) []ShardStatus {
+	statuses := make([]ShardStatus, len(cfg.Shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range cfg.Shards {
+		statuses[i] = ShardStatus{NodeStatus: NodeStatus{Shard: shard.Idx, Name: shard.Name}, Address: shard.Address}
+		if shard.Idx == self.Shard {
+			statuses[i].NodeStatus = self
+			statuses[i].Reachable = true
+			continue
+		}
+
+		wg.Add(1)
+		go func(status *ShardStatus) {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+			defer cancel()
+
+			start := time.Now()
+			node, err := probe(probeCtx, status.Shard)
+			status.Latency = time.Since(start)
+			if err != nil {
+				status.Error = err.Error()
+				return
+			}
+			status.NodeStatus = node
+			status.Reachable = true
+		}(&statuses[i])
+	}
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Shard < statuses[j].Shard })
+	return statuses
+}
+
+// ErrDegraded marks the error of a check reported without failing readiness.
+var ErrDegraded = errors.New("degraded")
+
+// Check is one condition of readiness. It returns why the node is not ready, or nil, or an error wrapping
+// ErrDegraded for a condition reported without failing readiness.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Report is the outcome of the readiness checks.
+type Report struct {
+	Ready bool `json:"ready"`
+	// Checks holds "ok" or the error of every check, degraded ones included.
+	Checks map[string]string `json:"checks"`
+}
+
+// Run runs the checks one after the other. The node is ready when all of them pass or are only degraded.
+func Run(ctx context.Context, checks []Check) Report {
+	report := Report{Ready: true, Checks: make(map[string]string, len(checks))}
+	for _, check := range checks {
+		if err := check.Check(ctx); err != nil {
+			report.Ready = report.Ready && errors.Is(err, ErrDegraded)
+			report.Checks[check.Name] = err.Error()
+			continue
+		}
+		report.Checks[check.Name] = "ok"
+	}
+	return report
+}
+
+// Draining fails once the node is stopping, so that no new requests are routed to it.
+func Draining(draining func() bool) Check {
+	return Check{Name: "draining", Check: func(ctx context.Context) error {
+		if draining() {
+			return errors.New("draining")
+		}
+		return nil
+	}}
+}
+
+// Databases checks that the database of every namespace can be read.
+func Databases(namespaces *namespace.Registry) Check {
+	return Check{Name: "database", Check: func(ctx context.Context) error {
+		for _, ns := range namespaces.All() {
+			if _, err := ns.DB.GetKey(probeKey); err != nil {
+				return fmt.Errorf("namespace %s: %w", ns.Name, err)
+			}
+		}
+		return nil
+	}}
+}
+
+// Consensus checks that the consensus module ordering the writes is running.
+func Consensus(ready func() error) Check {
+	return Check{Name: "consensus", Check: func(ctx context.Context) error {
+		return ready()
+	}}
+}
+
+// Peers checks that the node reaches enough shards, itself included, to meet the consistency level of the default
+// namespace. The other namespaces whose consistency level cannot be met are reported as degraded, as a namespace
+// asking for every replica would otherwise take the whole cluster out of service with one node down.
+func Peers(cfg config.Config, cluster func(ctx context.Context) []ShardStatus) Check {
+	return Check{Name: "peers", Check: func(ctx context.Context) error {
+		statuses := cluster(ctx)
+
+		reachable := 0
+		for _, status := range statuses {
+			if status.Reachable {
+				reachable++
+			}
+		}
+
+		if defaults, _ := cfg.GetNamespace(config.DefaultNamespace); reachable < defaults.ConsistencyLevel {
+			return fmt.Errorf("%d of %d shards reachable, not enough for consistency level %d", reachable, len(statuses), defaults.ConsistencyLevel)
+		}
+
+		var failed []string
+		for _, name := range cfg.NamespaceNames() {
+			ns, _ := cfg.GetNamespace(name)
+			if reachable < ns.ConsistencyLevel {
+				failed = append(failed, fmt.Sprintf("%s (consistency level %d)", name, ns.ConsistencyLevel))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%w: %d of %d shards reachable, not enough for namespaces %s", ErrDegraded, reachable, len(statuses), strings.Join(failed, ", "))
+		}
+		return nil
+	}}
+}
+
+// LiveHandler answers 200 as long as the process serves HTTP.
+func LiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "ok\n")
+}
+
+// ReadyHandler answers 200 when all the checks pass and 503 otherwise, with the report as JSON.
+func ReadyHandler(checks []Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := Run(r.Context(), checks)
+
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// Watch keeps the serving status of the gRPC health service in sync with the readiness of the node, checking it
+// every interval until ctx is done. The status applies to the whole server and to every listed service.
+func Watch(ctx context.Context, server *grpchealth.Server, checks []Check, interval time.Duration, services ...string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if Run(ctx, checks).Ready {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		for _, service := range append([]string{""}, services...) {
+			server.SetServingStatus(service, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
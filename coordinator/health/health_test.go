@@ -0,0 +1,130 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/health"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var cfg = config.Config{
+	ReplicationFactor: 3,
+	ConsistencyLevel:  2,
+	Shards: []config.Shard{
+		{Idx: 2, Name: "Orhei"},
+		{Idx: 0, Name: "Chisinau"},
+		{Idx: 1, Name: "Balti"},
+	},
+}
+
+func TestCluster(t *testing.T) {
+	self := health.NodeStatus{Shard: 0, Name: "Chisinau", Epoch: "e1"}
+	statuses := health.Cluster(context.Background(), cfg, self, func(ctx context.Context, shard int) (health.NodeStatus, error) {
+		if shard == 2 {
+			return health.NodeStatus{}, errors.New("connection refused")
+		}
+		return health.NodeStatus{Shard: shard, Name: "Balti", Epoch: "e1", PendingCommands: 4, ReplicationLag: time.Second}, nil
+	})
+
+	if len(statuses) != 3 {
+		t.Fatalf("Got %d statuses, want 3", len(statuses))
+	}
+	for i, status := range statuses {
+		if status.Shard != i {
+			t.Errorf("Status %d is of shard %d, want shard order", i, status.Shard)
+		}
+	}
+
+	if !statuses[0].Reachable || statuses[0].Epoch != "e1" {
+		t.Errorf("The current shard is not reported from self: %+v", statuses[0])
+	}
+	if !statuses[1].Reachable || statuses[1].PendingCommands != 4 || statuses[1].ReplicationLag != time.Second {
+		t.Errorf("The reachable peer is not reported: %+v", statuses[1])
+	}
+	if statuses[2].Reachable || statuses[2].Error != "connection refused" || statuses[2].Name != "Orhei" {
+		t.Errorf("The unreachable peer is not reported: %+v", statuses[2])
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	reachable := 1
+	peers := health.Peers(cfg, func(ctx context.Context) []health.ShardStatus {
+		statuses := make([]health.ShardStatus, 3)
+		for i := 0; i < reachable; i++ {
+			statuses[i].Reachable = true
+		}
+		return statuses
+	})
+	consensus := health.Consensus(func() error { return nil })
+	handler := health.ReadyHandler([]health.Check{consensus, peers})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Ready with 1 shard for consistency level 2: got %d", rec.Code)
+	}
+
+	var report health.Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Could not decode the report: %v", err)
+	}
+	if report.Ready || report.Checks["consensus"] != "ok" || report.Checks["peers"] == "ok" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	reachable = 2
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Not ready with 2 shards for consistency level 2: got %d, %s", rec.Code, rec.Body)
+	}
+}
+
+func TestPeersNamespaces(t *testing.T) {
+	strict := cfg
+	strict.Namespaces = []config.Namespace{{Name: "ledger", ConsistencyLevel: 3}}
+
+	reachable := 2
+	peers := health.Peers(strict, func(ctx context.Context) []health.ShardStatus {
+		statuses := make([]health.ShardStatus, 3)
+		for i := 0; i < reachable; i++ {
+			statuses[i].Reachable = true
+		}
+		return statuses
+	})
+
+	report := health.Run(context.Background(), []health.Check{peers})
+	if !report.Ready || !strings.HasPrefix(report.Checks["peers"], "degraded") || !strings.Contains(report.Checks["peers"], "ledger (consistency level 3)") {
+		t.Errorf("A namespace of consistency level 3 with 2 shards reachable is not reported as degraded: %+v", report)
+	}
+
+	reachable = 3
+	if report := health.Run(context.Background(), []health.Check{peers}); !report.Ready || report.Checks["peers"] != "ok" {
+		t.Errorf("Not ready with every shard reachable: %+v", report)
+	}
+
+	reachable = 1
+	if report := health.Run(context.Background(), []health.Check{peers}); report.Ready || strings.HasPrefix(report.Checks["peers"], "degraded") {
+		t.Errorf("Ready without a quorum for the default namespace: %+v", report)
+	}
+}
+
+func TestDraining(t *testing.T) {
+	draining := false
+	checks := []health.Check{health.Draining(func() bool { return draining })}
+
+	if report := health.Run(context.Background(), checks); !report.Ready {
+		t.Errorf("Not ready before draining: %+v", report)
+	}
+
+	draining = true
+	if report := health.Run(context.Background(), checks); report.Ready || report.Checks["draining"] != "draining" {
+		t.Errorf("Ready while draining: %+v", report)
+	}
+}
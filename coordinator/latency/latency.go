@@ -0,0 +1,194 @@
+// Package latency tracks how fast the peers answer the reads, so that a read goes to the fastest replica first
+// and a slow replica is hedged by sending the same read to another one.
+package latency
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/metrics"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// alpha is the weight of a new sample in the moving averages.
+	alpha = 0.2
+	// z95 is the number of standard deviations between the mean and the 95th percentile of a normal distribution.
+	z95 = 1.645
+	// DefaultHedgeDelay is how long a read waits for a peer without samples before going to another replica.
+	DefaultHedgeDelay = 20 * time.Millisecond
+	// minHedgeDelay keeps the reads to very fast peers from being hedged every time.
+	minHedgeDelay = time.Millisecond
+	// failurePenalty is the latency recorded for a failed read, so that the failing peers are tried last.
+	failurePenalty = time.Second
+)
+
+// ErrNoReplica fails a read given no shard to read from.
+var ErrNoReplica = errors.New("no replica to read from")
+
+// ewma is an exponentially weighted moving average and variance, in nanoseconds.
+type ewma struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+func (e *ewma) observe(x float64) {
+	if e.samples == 0 {
+		e.mean = x
+	} else {
+		diff := x - e.mean
+		increment := alpha * diff
+		e.mean += increment
+		e.variance = (1 - alpha) * (e.variance + diff*increment)
+	}
+	e.samples++
+}
+
+// Tracker keeps a moving average and variance of the read latency of every peer.
+type Tracker struct {
+	mu    sync.Mutex
+	peers map[int]*ewma
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{peers: make(map[int]*ewma)}
+}
+
+// Observe records the latency of a read answered by the shard.
+func (t *Tracker) Observe(shard int, took time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peer, ok := t.peers[shard]
+	if !ok {
+		peer = &ewma{}
+		t.peers[shard] = peer
+	}
+	peer.observe(float64(took))
+	metrics.SetPeerLatency(shard, time.Duration(peer.mean))
+}
+
+// Failed records a read the shard failed.
+func (t *Tracker) Failed(shard int) {
+	t.Observe(shard, failurePenalty)
+}
+
+// Latency returns the moving average of the read latency of the shard, 0 when it has no samples.
+func (t *Tracker) Latency(shard int) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if peer, ok := t.peers[shard]; ok {
+		return time.Duration(peer.mean)
+	}
+	return 0
+}
+
+// Order returns the shards from the fastest to the slowest. The shards without samples come first, keeping
+// their order, so that they get measured.
+func (t *Tracker) Order(shards []int) []int {
+	ordered := slices.Clone(shards)
+	slices.SortStableFunc(ordered, func(a, b int) int {
+		return int(t.Latency(a) - t.Latency(b))
+	})
+	return ordered
+}
+
+// HedgeDelay returns how long a read waits for the shard before going to another replica too: the 95th percentile
+// of its latency, estimated from the moving average and variance.
+func (t *Tracker) HedgeDelay(shard int) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peer, ok := t.peers[shard]
+	if !ok {
+		return DefaultHedgeDelay
+	}
+	return max(time.Duration(peer.mean+z95*math.Sqrt(peer.variance)), minHedgeDelay)
+}
+
+// Read sends a read to one replica.
+type Read[T any] func(ctx context.Context, shard int) (T, error)
+
+// Hedged sends read to the fastest of the shards. When the shard fails, or does not answer within its hedge delay,
+// the read goes to the next fastest shard too, and so on. The first answer wins and the reads still running are
+// cancelled. It returns the answer with the shard that gave it, or the last error when every shard failed.
+func Hedged[T any](ctx context.Context, t *Tracker, shards []int, read Read[T]) (T, int, error) {
+	var zero T
+	if len(shards) == 0 {
+		return zero, -1, ErrNoReplica
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		value T
+		shard int
+		hedge bool
+		err   error
+	}
+
+	order := t.Order(shards)
+	results := make(chan result, len(order))
+	next, running := 0, 0
+	var hedge <-chan time.Time
+
+	send := func() {
+		shard := order[next]
+		hedged := next > 0
+		next++
+		running++
+
+		go func() {
+			start := time.Now()
+			value, err := read(ctx, shard)
+			took := time.Since(start)
+
+			switch {
+			case err == nil:
+				t.Observe(shard, took)
+			case ctx.Err() != nil:
+				// cancelled as another replica answered first, so it is at least that slow
+				t.Observe(shard, took)
+			default:
+				t.Failed(shard)
+			}
+			results <- result{value: value, shard: shard, hedge: hedged, err: err}
+		}()
+
+		hedge = nil
+		if next < len(order) {
+			hedge = time.After(t.HedgeDelay(shard))
+		}
+	}
+
+	send()
+	var lastErr error
+	for running > 0 {
+		select {
+		case res := <-results:
+			running--
+			if res.err == nil {
+				if next > 1 {
+					metrics.HedgedRead(res.hedge)
+				}
+				return res.value, res.shard, nil
+			}
+
+			lastErr = res.err
+			if next < len(order) {
+				send()
+			}
+		case <-hedge:
+			send()
+		case <-ctx.Done():
+			return zero, -1, ctx.Err()
+		}
+	}
+
+	return zero, -1, lastErr
+}
@@ -0,0 +1,85 @@
+package latency_test
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/coordinator/latency"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOrder(t *testing.T) {
+	tracker := latency.NewTracker()
+	for i := 0; i < 10; i++ {
+		tracker.Observe(1, 50*time.Millisecond)
+		tracker.Observe(2, time.Millisecond)
+	}
+
+	if order := tracker.Order([]int{1, 2, 3}); !slices.Equal(order, []int{3, 2, 1}) {
+		t.Errorf("Order = %v, want the unknown shard first, then from the fastest", order)
+	}
+	if delay := tracker.HedgeDelay(3); delay != latency.DefaultHedgeDelay {
+		t.Errorf("HedgeDelay of an unknown shard = %s, want %s", delay, latency.DefaultHedgeDelay)
+	}
+
+	tracker.Observe(2, 11*time.Millisecond)
+	if delay := tracker.HedgeDelay(2); delay <= tracker.Latency(2) {
+		t.Errorf("HedgeDelay = %s is not above the mean %s of a shard with varying latency", delay, tracker.Latency(2))
+	}
+}
+
+func TestHedged(t *testing.T) {
+	tracker := latency.NewTracker()
+	tracker.Observe(1, time.Millisecond)
+	tracker.Observe(2, 2*time.Millisecond)
+
+	cancelled := make(chan struct{})
+	start := time.Now()
+	value, shard, err := latency.Hedged(context.Background(), tracker, []int{2, 1}, func(ctx context.Context, shard int) (string, error) {
+		if shard == 1 {
+			// garbage collecting
+			<-ctx.Done()
+			close(cancelled)
+			return "", ctx.Err()
+		}
+		return "fcim", nil
+	})
+
+	if err != nil || shard != 2 || value != "fcim" {
+		t.Fatalf("Hedged = %q, %d, %v, want the answer of the hedged shard 2", value, shard, err)
+	}
+	if took := time.Since(start); took > 100*time.Millisecond {
+		t.Errorf("The hedged read took %s", took)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("The slow read was not cancelled")
+	}
+}
+
+func TestHedgedFailures(t *testing.T) {
+	tracker := latency.NewTracker()
+
+	value, shard, err := latency.Hedged(context.Background(), tracker, []int{0, 1}, func(ctx context.Context, shard int) (string, error) {
+		if shard == 0 {
+			return "", errors.New("connection refused")
+		}
+		return "usm", nil
+	})
+	if err != nil || shard != 1 || value != "usm" {
+		t.Errorf("Hedged = %q, %d, %v, want the answer of shard 1", value, shard, err)
+	}
+	if order := tracker.Order([]int{0, 1}); order[0] != 1 {
+		t.Errorf("The failing shard is not tried last: %v", order)
+	}
+
+	refused := errors.New("connection refused")
+	_, _, err = latency.Hedged(context.Background(), tracker, []int{0, 1}, func(ctx context.Context, shard int) (string, error) {
+		return "", refused
+	})
+	if !errors.Is(err, refused) {
+		t.Errorf("Hedged = %v, want the error of the replicas", err)
+	}
+}
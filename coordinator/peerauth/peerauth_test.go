@@ -0,0 +1,43 @@
+package peerauth_test
+
+import (
+	"github.com/EliriaT/distributed-store/coordinator/peerauth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	handler := peerauth.Middleware("s3cret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		secret string
+		want   int
+	}{
+		{secret: "s3cret", want: http.StatusOK},
+		{secret: "wrong", want: http.StatusUnauthorized},
+		{secret: "", want: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/internal/get?key=utm", nil)
+		if test.secret != "" {
+			req.Header.Set(peerauth.Header, test.secret)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.want {
+			t.Errorf("Secret %q: got status %d, want %d", test.secret, rec.Code, test.want)
+		}
+	}
+}
+
+func TestValidWithoutSecret(t *testing.T) {
+	if !peerauth.Valid("", "anything") {
+		t.Errorf("An empty cluster secret should disable the check")
+	}
+}
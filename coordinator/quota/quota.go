@@ -0,0 +1,243 @@
+// Package quota enforces the request rate, storage and value size limits of the namespaces and principals.
+// The rate and value size limits are checked by the coordinator before a request is sent to the replicas, and the
+// storage limits by every replica before it writes, against the keys it stores. Every node keeps its own token
+// buckets, refilled at its share of the cluster rate, so the cluster as a whole roughly keeps to the configured rate
+// when the clients spread their requests over the nodes.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/auth"
+	"github.com/EliriaT/distributed-store/namespace"
+	"golang.org/x/time/rate"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// usageRefresh is how long the storage usage of a namespace read from the database is trusted.
+// In between, the writes accepted by the node are added to it, and it is read again in the background.
+const usageRefresh = 5 * time.Second
+
+// Exceeded is the error of a request over a limit.
+type Exceeded struct {
+	// Subject is what the limit applies to, "namespace:<name>" or "principal:<name>".
+	Subject string
+	// Description describes the limit.
+	Description string
+	// RetryAfter is how long to wait before the request fits a rate limit. It is zero for the other limits.
+	RetryAfter time.Duration
+}
+
+func (e *Exceeded) Error() string {
+	return fmt.Sprintf("%s: %s", e.Subject, e.Description)
+}
+
+type usage struct {
+	keys    int
+	bytes   int64
+	readAt  time.Time
+	reading bool
+}
+
+// Limiter checks the requests against the limits of the sharding config.
+type Limiter struct {
+	namespaces map[string]*rate.Limiter
+	principals map[string]*rate.Limiter
+
+	mu    sync.Mutex
+	usage map[string]*usage
+}
+
+// New returns a limiter for the namespaces and principals of the config. The rates are split evenly between the shards.
+func New(cfg config.Config) *Limiter {
+	nodes := max(len(cfg.Shards), 1)
+
+	l := &Limiter{
+		namespaces: make(map[string]*rate.Limiter),
+		principals: make(map[string]*rate.Limiter),
+		usage:      make(map[string]*usage),
+	}
+
+	for _, name := range cfg.NamespaceNames() {
+		ns, _ := cfg.GetNamespace(name)
+		if ns.RateLimit > 0 {
+			l.namespaces[name] = newBucket(ns.RateLimit, ns.Burst, nodes)
+		}
+	}
+	for _, p := range cfg.Auth.Principals {
+		if p.RateLimit > 0 {
+			l.principals[p.Name] = newBucket(p.RateLimit, p.Burst, nodes)
+		}
+	}
+
+	return l
+}
+
+// newBucket returns a token bucket refilled at the share of one node of the cluster rate.
+// Without a burst the node accepts one second of its rate at once.
+func newBucket(clusterRate float64, clusterBurst, nodes int) *rate.Limiter {
+	perNode := clusterRate / float64(nodes)
+	burst := int(math.Ceil(float64(clusterBurst) / float64(nodes)))
+	if clusterBurst == 0 {
+		burst = int(math.Ceil(perNode))
+	}
+
+	return rate.NewLimiter(rate.Limit(perNode), max(burst, 1))
+}
+
+// Allow takes a token from the buckets of the namespace and of the principal of the request, if they have one.
+// When one of them is empty, no token is taken and an Exceeded error is returned.
+func (l *Limiter) Allow(ctx context.Context, ns string) error {
+	type bucket struct {
+		subject string
+		limiter *rate.Limiter
+	}
+
+	var buckets []bucket
+	if p, ok := auth.FromContext(ctx); ok && l.principals[p.Name] != nil {
+		buckets = append(buckets, bucket{"principal:" + p.Name, l.principals[p.Name]})
+	}
+	if l.namespaces[ns] != nil {
+		buckets = append(buckets, bucket{"namespace:" + ns, l.namespaces[ns]})
+	}
+
+	now := time.Now()
+	var reserved []*rate.Reservation
+	for _, b := range buckets {
+		r := b.limiter.ReserveN(now, 1)
+		if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			for _, taken := range reserved {
+				taken.CancelAt(now)
+			}
+
+			slog.WarnContext(ctx, "Rate limited a request", "subject", b.subject)
+			return &Exceeded{
+				Subject:     b.subject,
+				Description: fmt.Sprintf("rate limit of %g requests per second on this node exceeded", float64(b.limiter.Limit())),
+				RetryAfter:  delay,
+			}
+		}
+		reserved = append(reserved, r)
+	}
+
+	return nil
+}
+
+// CheckValue checks that the value fits the max_value_size limit of the namespace.
+func (l *Limiter) CheckValue(ns *namespace.Namespace, value []byte) error {
+	if ns.MaxValueSize > 0 && len(value) > ns.MaxValueSize {
+		return &Exceeded{Subject: "namespace:" + ns.Name, Description: fmt.Sprintf("value of %d bytes is larger than %d bytes", len(value), ns.MaxValueSize)}
+	}
+	return nil
+}
+
+// CheckWrite checks that writing the value fits the max_value_size, max_keys and max_bytes limits of the namespace.
+// The storage limits apply to the keys the node stores in the namespace, so the replicas check them before writing.
+// They are checked against the usage last read from the database, which is read again in the background once it
+// is stale. The first write of the namespace reads it before it is checked, and is refused when it cannot be read.
+func (l *Limiter) CheckWrite(ns *namespace.Namespace, key string, value []byte) error {
+	if err := l.CheckValue(ns, value); err != nil {
+		return err
+	}
+
+	if ns.MaxKeys == 0 && ns.MaxBytes == 0 {
+		return nil
+	}
+
+	if err := l.readUsage(ns); err != nil {
+		slog.Error("Could not read the usage of a namespace", "namespace", ns.Name, "error", err)
+		return &Exceeded{Subject: "namespace:" + ns.Name, Description: fmt.Sprintf("could not read the usage of the namespace: %v", err)}
+	}
+
+	newKeys := 1
+	bytes := int64(len(key) + len(value))
+	if old, err := ns.DB.GetKey(key); err == nil && old != nil {
+		// overwriting a key does not add one
+		newKeys = 0
+		bytes -= int64(len(key) + len(old))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u := l.usageOf(ns)
+
+	subject := "namespace:" + ns.Name
+	if ns.MaxKeys > 0 && newKeys > 0 && u.keys >= ns.MaxKeys {
+		slog.Warn("Rejected a new key in a full namespace", "namespace", ns.Name, "keys", u.keys, "max_keys", ns.MaxKeys)
+		return &Exceeded{Subject: subject, Description: fmt.Sprintf("namespace is full: %d of %d keys", u.keys, ns.MaxKeys)}
+	}
+	if ns.MaxBytes > 0 && bytes > 0 && u.bytes+bytes > ns.MaxBytes {
+		slog.Warn("Rejected a write in a full namespace", "namespace", ns.Name, "bytes", bytes, "used", u.bytes, "max_bytes", ns.MaxBytes)
+		return &Exceeded{Subject: subject, Description: fmt.Sprintf("namespace is full: %d of %d bytes", u.bytes, ns.MaxBytes)}
+	}
+
+	u.keys += newKeys
+	u.bytes += bytes
+	return nil
+}
+
+// readUsage reads the storage usage of the namespace when it was never read.
+func (l *Limiter) readUsage(ns *namespace.Namespace) error {
+	l.mu.Lock()
+	u := l.usage[ns.Name]
+	read := u != nil && !u.readAt.IsZero()
+	l.mu.Unlock()
+
+	if read {
+		return nil
+	}
+	return l.Refresh(ns)
+}
+
+// usageOf returns the storage usage of the namespace on this node, starting to read it again in the background when
+// it is stale. The caller holds mu.
+func (l *Limiter) usageOf(ns *namespace.Namespace) *usage {
+	u := l.usage[ns.Name]
+	if u == nil {
+		u = &usage{}
+		l.usage[ns.Name] = u
+	}
+
+	if !u.reading && time.Since(u.readAt) >= usageRefresh {
+		u.reading = true
+		go func() {
+			if err := l.Refresh(ns); err != nil {
+				// a node that cannot read its usage keeps the last one
+				slog.Error("Could not read the usage of a namespace", "namespace", ns.Name, "error", err)
+			}
+		}()
+	}
+	return u
+}
+
+// Refresh reads the storage usage of the namespace on this node from the database. The database is read without
+// holding the limiter, so that the writes are not held up by a full scan.
+func (l *Limiter) Refresh(ns *namespace.Namespace) error {
+	keys, err := ns.DB.KeyCount()
+	var bytes int64
+	if err == nil {
+		bytes, err = ns.DB.Size()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u := l.usage[ns.Name]
+	if u == nil {
+		u = &usage{}
+		l.usage[ns.Name] = u
+	}
+	u.reading = false
+	if err != nil {
+		return err
+	}
+
+	u.keys, u.bytes, u.readAt = keys, bytes, time.Now()
+	return nil
+}
@@ -0,0 +1,158 @@
+package quota_test
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/auth"
+	"github.com/EliriaT/distributed-store/coordinator/quota"
+	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/namespace"
+	"os"
+	"strings"
+	"testing"
+)
+
+var cfg = config.Config{
+	Shards:            []config.Shard{{Idx: 0}, {Idx: 1}},
+	ReplicationFactor: 1,
+	ConsistencyLevel:  1,
+	Namespaces: []config.Namespace{
+		{Name: "jobs", RateLimit: 4, Burst: 4},
+		{Name: "small", MaxKeys: 2, MaxBytes: 16, MaxValueSize: 8},
+	},
+	Auth: config.Auth{Principals: []config.Principal{
+		{Name: "batch", APIKeys: []string{"batch-key"}, RateLimit: 2},
+	}},
+}
+
+func createRegistry(t *testing.T) *namespace.Registry {
+	t.Helper()
+
+	f, err := os.CreateTemp(os.TempDir(), "kvdb")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	name := f.Name()
+	f.Close()
+	t.Cleanup(func() { os.Remove(name) })
+
+	database, closeFunc, err := db.NewBoltDatabase(name, db.BoltOptions{})
+	if err != nil {
+		t.Fatalf("Could not create a new database: %v", err)
+	}
+	t.Cleanup(func() { closeFunc() })
+
+	namespaces, err := namespace.NewRegistry(database, cfg)
+	if err != nil {
+		t.Fatalf("Could not open the namespaces: %v", err)
+	}
+	return namespaces
+}
+
+func TestAllow(t *testing.T) {
+	l := quota.New(cfg)
+	ctx := context.Background()
+
+	// the burst of 4 is split between the 2 shards
+	for i := 0; i < 2; i++ {
+		if err := l.Allow(ctx, "jobs"); err != nil {
+			t.Fatalf("Request %d should be allowed: %v", i, err)
+		}
+	}
+
+	var exceeded *quota.Exceeded
+	if err := l.Allow(ctx, "jobs"); !errors.As(err, &exceeded) || exceeded.Subject != "namespace:jobs" || exceeded.RetryAfter <= 0 {
+		t.Errorf("Unexpected error over the rate limit: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := l.Allow(ctx, config.DefaultNamespace); err != nil {
+			t.Fatalf("The default namespace has no rate limit: %v", err)
+		}
+	}
+}
+
+func TestAllowPrincipal(t *testing.T) {
+	l := quota.New(cfg)
+	batch, err := auth.New(cfg.Auth).Authenticate("batch-key", "")
+	if err != nil {
+		t.Fatalf("Could not authenticate: %v", err)
+	}
+	ctx := auth.NewContext(context.Background(), batch)
+
+	if err := l.Allow(ctx, config.DefaultNamespace); err != nil {
+		t.Fatalf("The first request should be allowed: %v", err)
+	}
+
+	var exceeded *quota.Exceeded
+	if err := l.Allow(ctx, config.DefaultNamespace); !errors.As(err, &exceeded) || exceeded.Subject != "principal:batch" {
+		t.Errorf("Unexpected error over the rate limit of the principal: %v", err)
+	}
+
+	if err := l.Allow(context.Background(), config.DefaultNamespace); err != nil {
+		t.Errorf("Other callers should not be limited by the principal: %v", err)
+	}
+}
+
+func TestCheckWrite(t *testing.T) {
+	l := quota.New(cfg)
+	ns, err := createRegistry(t).Get("small")
+	if err != nil {
+		t.Fatalf("Could not get the namespace: %v", err)
+	}
+
+	if err := l.Refresh(ns); err != nil {
+		t.Fatalf("Could not read the usage: %v", err)
+	}
+
+	write := func(key, value string) error {
+		if err := l.CheckWrite(ns, key, []byte(value)); err != nil {
+			return err
+		}
+		return ns.DB.SetKey(key, []byte(value))
+	}
+
+	if err := write("a", "too large value"); err == nil || !strings.Contains(err.Error(), "larger than 8 bytes") {
+		t.Errorf("Unexpected error for a large value: %v", err)
+	}
+
+	if err := write("a", "1"); err != nil {
+		t.Fatalf("Could not write the first key: %v", err)
+	}
+	if err := write("b", "12345678"); err != nil {
+		t.Fatalf("Could not write the second key: %v", err)
+	}
+	if err := write("c", "1"); err == nil || !strings.Contains(err.Error(), "keys") {
+		t.Errorf("Unexpected error for a key over max_keys: %v", err)
+	}
+
+	// overwriting adds no key, but 8 more bytes go over max_bytes
+	if err := write("a", "12345678"); err == nil || !strings.Contains(err.Error(), "bytes") {
+		t.Errorf("Unexpected error for a write over max_bytes: %v", err)
+	}
+	if err := write("b", "1"); err != nil {
+		t.Errorf("Shrinking a value should be allowed: %v", err)
+	}
+}
+
+func TestCheckWriteBeforeUsage(t *testing.T) {
+	l := quota.New(cfg)
+	ns, err := createRegistry(t).Get("small")
+	if err != nil {
+		t.Fatalf("Could not get the namespace: %v", err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := ns.DB.SetKey(key, []byte("1")); err != nil {
+			t.Fatalf("Could not write the key: %v", err)
+		}
+	}
+
+	// the usage is read before the first write is checked, so the limits hold from the start
+	if err := l.CheckWrite(ns, "d", []byte("1")); err == nil {
+		t.Errorf("The storage limits were not enforced before the usage was read")
+	}
+	if err := l.CheckWrite(ns, "a", []byte("2")); err != nil {
+		t.Errorf("Could not overwrite a key: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/EliriaT/distributed-store/coordinator/gossip"
+	"github.com/EliriaT/distributed-store/coordinator/quota"
+	"github.com/EliriaT/distributed-store/coordinator/session"
+	"github.com/EliriaT/distributed-store/replication"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RunFailureDetector gossips the heartbeats of the node with its peers and replays the hints of the peers that are
+// alive, until ctx is done.
+func (s *HTTPServer) RunFailureDetector(ctx context.Context) {
+	go s.detector.Run(ctx, s.gossip)
+
+	ticker := time.NewTicker(s.detector.Interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.replayHints(ctx)
+	}
+}
+
+// replayHints replays the hints of the peers that are alive.
+func (s *HTTPServer) replayHints(ctx context.Context) {
+	for shard := 0; shard < s.shards.Count; shard++ {
+		if shard == s.shards.CurrIdx || s.hints.Pending(shard) == 0 || !s.detector.Alive(shard) {
+			continue
+		}
+
+		replayed, err := s.hints.Replay(ctx, shard, func(hint replication.Hint) error {
+			return s.replay(ctx, shard, hint)
+		})
+		slog.InfoContext(ctx, "Replayed hints", "replica", shard, "replayed", replayed, "pending", s.hints.Pending(shard), "error", err)
+	}
+}
+
+// peerViews returns what the failure detector knows about the peers, with the hints kept for them.
+func (s *HTTPServer) peerViews() []gossip.PeerView {
+	views := s.detector.View()
+	for i := range views {
+		views[i].PendingHints = s.hints.Pending(views[i].Shard)
+	}
+	return views
+}
+
+// gossip sends the heartbeats the node knows to a peer, with the watermarks of its writes, and returns the heartbeats
+// the peer knows.
+func (s *HTTPServer) gossip(ctx context.Context, shard int, heartbeats gossip.Heartbeats) (gossip.Heartbeats, error) {
+	encoded, err := json.Marshal(heartbeats)
+	if err != nil {
+		return nil, err
+	}
+	watermarks, err := json.Marshal(s.sessions.Watermarks())
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"heartbeats": {string(encoded)}, "from": {strconv.Itoa(s.shards.CurrIdx)}, "watermarks": {string(watermarks)}}
+	body, err := s.call(ctx, shard, "/gossip", query)
+	if err != nil {
+		return nil, err
+	}
+
+	var received gossip.Heartbeats
+	err = json.Unmarshal([]byte(body), &received)
+	return received, err
+}
+
+// InternalGossipHandler merges the heartbeats and watermarks gossiped by a peer and answers with the heartbeats
+// the node knows.
+func (s *HTTPServer) InternalGossipHandler(w http.ResponseWriter, r *http.Request) {
+	var received gossip.Heartbeats
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("heartbeats")), &received); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if from, err := strconv.Atoi(r.URL.Query().Get("from")); err == nil {
+		var watermarks session.Watermarks
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("watermarks")), &watermarks); err == nil {
+			s.sessions.Merge(from, watermarks)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, s.detector.Exchange(received))
+}
+
+// writeReplica sends a write to a replica with write. The writes to the replicas suspected dead fail right away,
+// and they are kept as hints with the failed writes, to be replayed once the replica is alive again. A write that
+// succeeds drops the older hint of its key, so that its replay does not bring the older value back. The error of
+// a write kept as a hint wraps replication.ErrHinted. at is the position of the write, kept with the hint. A write the
+// replica refused for its quota is not kept, it would be refused again.
+func (s *HTTPServer) writeReplica(ctx context.Context, shard int, at uint64, hint replication.Hint, write func(ctx context.Context) error) error {
+	keep := func(err error) bool {
+		var exceeded *quota.Exceeded
+		return !errors.As(err, &exceeded)
+	}
+	return s.hints.Write(ctx, shard, hint, at, keep, func(ctx context.Context) error {
+		if !s.detector.Alive(shard) {
+			return gossip.ErrSuspected
+		}
+		err := write(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to write on a replica", "key", hint.Key, "delete", hint.Delete, "replica", shard, "error", err)
+		}
+		return err
+	})
+}
+
+// replay writes a hint on the replica it was kept for. A hint the replica refuses for its quota is dropped.
+func (s *HTTPServer) replay(ctx context.Context, shard int, hint replication.Hint) error {
+	query := url.Values{"key": {hint.Key}, "namespace": {hint.Namespace}}
+	if hint.Delete {
+		_, err := s.sendWithin(ctx, s.timeouts.Write, shard, "/delete", query)
+		return err
+	}
+
+	query.Set("value", string(hint.Value))
+	_, err := s.sendWithin(ctx, s.timeouts.Write, shard, "/set", query)
+
+	var exceeded *quota.Exceeded
+	if errors.As(err, &exceeded) {
+		slog.WarnContext(ctx, "Dropped a hint over the quota of the replica", "key", hint.Key, "replica", shard, "error", err)
+		return nil
+	}
+	return err
+}
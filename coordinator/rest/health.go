@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/EliriaT/distributed-store/coordinator/auth"
+	"github.com/EliriaT/distributed-store/coordinator/health"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// status returns what the current shard reports about itself.
+func (s *HTTPServer) status() health.NodeStatus {
+	pending, lag := s.replicator.Lag()
+	return health.NodeStatus{
+		Shard:           s.shards.CurrIdx,
+		Name:            s.name,
+		Epoch:           s.cfg.Epoch(),
+		PendingCommands: pending,
+		ReplicationLag:  lag,
+		Peers:           s.peerViews(),
+	}
+}
+
+// cluster asks every shard for its status on its internal address.
+func (s *HTTPServer) cluster(ctx context.Context) []health.ShardStatus {
+	return health.Cluster(ctx, s.cfg, s.status(), func(ctx context.Context, shard int) (health.NodeStatus, error) {
+		var status health.NodeStatus
+		body, err := s.send(ctx, shard, "/status", url.Values{})
+		if err != nil {
+			return status, err
+		}
+		err = json.Unmarshal([]byte(body), &status)
+		return status, err
+	})
+}
+
+// ReadinessChecks returns the conditions for the node to serve requests: the node is not stopping, the databases
+// are open, the consensus module runs and enough shards are reachable for the consistency level of the default
+// namespace.
+func (s *HTTPServer) ReadinessChecks() []health.Check {
+	return []health.Check{
+		health.Draining(s.draining.Load),
+		health.Databases(s.namespaces),
+		health.Consensus(s.replicator.Ready),
+		health.Peers(s.cfg, s.cluster),
+	}
+}
+
+// ClusterStatusResponse is the JSON body of the cluster status endpoint.
+type ClusterStatusResponse struct {
+	Coordinator int                  `json:"coordinator"`
+	Epoch       string               `json:"epoch"`
+	Shards      []health.ShardStatus `json:"shards"`
+}
+
+// ClusterStatusHandler reports the reachability, latency, topology epoch and replication lag of every shard.
+func (s *HTTPServer) ClusterStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if deny(w, r, auth.Admin, "") {
+		return
+	}
+
+	shards := s.cluster(r.Context())
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, ClusterStatusResponse{Coordinator: s.shards.CurrIdx, Epoch: s.cfg.Epoch(), Shards: shards})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join([]string{"SHARD", "NAME", "REACHABLE", "LATENCY", "EPOCH", "PENDING", "LAG", "ERROR"}, "\t"))
+	for _, shard := range shards {
+		fmt.Fprintf(tw, "%d\t%s\t%t\t%s\t%s\t%d\t%s\t%s\n", shard.Shard, shard.Name, shard.Reachable, shard.Latency.Round(time.Microsecond),
+			shard.Epoch, shard.PendingCommands, shard.ReplicationLag.Round(time.Millisecond), shard.Error)
+	}
+	tw.Flush()
+}
@@ -1,244 +1,868 @@
 package rest
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/auth"
+	"github.com/EliriaT/distributed-store/coordinator/gossip"
+	"github.com/EliriaT/distributed-store/coordinator/latency"
+	"github.com/EliriaT/distributed-store/coordinator/quota"
+	"github.com/EliriaT/distributed-store/coordinator/session"
 	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/logging"
+	"github.com/EliriaT/distributed-store/metrics"
+	"github.com/EliriaT/distributed-store/namespace"
 	"github.com/EliriaT/distributed-store/replication"
 	"github.com/EliriaT/distributed-store/sharding"
-	"github.com/gookit/slog"
+	"github.com/EliriaT/distributed-store/tracing"
+	conalglog "github.com/gookit/slog"
 	"github.com/madalv/conalg/caesar"
 	"golang.org/x/exp/slices"
-	"io"
-	"log"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // HTTPServer contains HTTP method handlers to be used for the database.
 type HTTPServer struct {
-	db                db.Database
-	shards            *config.Shards
-	sharder           sharding.Sharder
-	replicator        *replication.OrderedReplicator
-	replicationFactor int
-	consistencyLevel  int
+	namespaces    *namespace.Registry
+	shards        *config.Shards
+	sharder       sharding.Sharder
+	replicator    *replication.OrderedReplicator
+	detector      *gossip.Detector
+	latency       *latency.Tracker
+	hints         *replication.Hints
+	sessions      *session.Tracker
+	quotas        *quota.Limiter
+	name          string
+	cfg           config.Config
+	timeouts      config.Timeouts
+	clusterSecret string
+	peerClient    *http.Client
+	peerScheme    string
+	// draining is set once the node stops, and fanouts tracks the writes to the replicas still running
+	draining atomic.Bool
+	fanouts  replication.Fanouts
 }
 
 // NewServer creates a new instance with HTTP handlers to be used to get and set values.
-func NewServer(db db.Database, shards *config.Shards, cfg config.Config, envPath string) *HTTPServer {
-	replicator := replication.NewOrderedReplicator(db, shards, cfg)
-	conalg := caesar.InitConalgModule(replicator, envPath, slog.FatalLevel, false)
+func NewServer(namespaces *namespace.Registry, shards *config.Shards, cfg config.Config, envPath string) *HTTPServer {
+	replicator := replication.NewOrderedReplicator(namespaces, shards, cfg)
+	conalg := caesar.InitConalgModule(replicator, envPath, conalglog.FatalLevel, false)
 	replicator.SetConalgModule(conalg)
+	hints := replication.NewHints()
 
 	return &HTTPServer{
-		db:                db,
-		shards:            shards,
-		sharder:           sharding.NewConsistentHasher(cfg),
-		replicationFactor: cfg.ReplicationFactor,
-		consistencyLevel:  cfg.ConsistencyLevel,
-		replicator:        replicator,
+		namespaces:    namespaces,
+		shards:        shards,
+		sharder:       sharding.NewConsistentHasher(cfg),
+		replicator:    replicator,
+		detector:      gossip.New(cfg, shards.CurrIdx),
+		latency:       latency.NewTracker(),
+		hints:         hints,
+		sessions:      session.NewTracker(shards.CurrIdx, shards.Count, hints.Oldest),
+		quotas:        quota.New(cfg),
+		name:          cfg.GetShardName(shards.CurrIdx),
+		cfg:           cfg,
+		timeouts:      cfg.Timeouts.WithDefaults(),
+		clusterSecret: cfg.ClusterSecret,
+		peerClient:    &http.Client{Transport: peerTransport(nil)},
+		peerScheme:    "http",
 	}
 }
 
+// UsePeerTLS makes the requests to the internal addresses of the other replicas use https with the given config.
+func (s *HTTPServer) UsePeerTLS(tlsConfig *tls.Config) {
+	s.peerClient = &http.Client{Transport: peerTransport(tlsConfig)}
+	s.peerScheme = "https"
+}
+
+// peerTransport returns the transport shared by all the requests to the replicas. It keeps enough idle connections
+// to every replica for the concurrent fan-outs. The requests have no timeout of their own, their contexts bound them.
+func peerTransport(tlsConfig *tls.Config) http.RoundTripper {
+	return logging.Transport(tracing.Transport(&http.Transport{
+		DialContext:           (&net.Dialer{Timeout: time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   64,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   time.Second,
+		ExpectContinueTimeout: time.Second,
+	}))
+}
+
 // GetHandler handles read requests to the distributed database.
 func (s *HTTPServer) GetHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	key := r.Form.Get("key")
-	isCoordinator := r.Form.Get("coordinator")
 
-	if strings.ToLower(isCoordinator) == "false" {
-		value, err := s.db.GetKey(key)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, fmt.Sprintf("%s:%s", key, string(value)))
+	if rejectInternal(w, r) {
+		return
+	}
+
+	if deny(w, r, auth.Read, key) {
+		return
+	}
+
+	ns, ok := s.namespace(w, r)
+	if !ok {
+		return
+	}
+
+	token, ok := sessionToken(w, r)
+	if !ok {
+		return
+	}
 
+	linearizable, ok := linearizable(w, r)
+	if !ok {
 		return
 	}
 
-	shards, err := s.sharder.GetNReplicas(key, s.replicationFactor)
+	shards, err := s.sharder.GetNReplicas(key, ns.ReplicationFactor)
 	if err != nil {
-		log.Printf("Shards = %v, coordinator shard = %d, error = %v, \n", shards, s.shards.CurrIdx, err)
+		slog.ErrorContext(r.Context(), "Could not place the key", "key", key, "shards", shards, "error", err)
+		return
+	}
+
+	// a read carrying a session token goes only to the replicas that have the writes of the session
+	waitCtx, cancel := context.WithTimeout(r.Context(), s.timeouts.Read)
+	shards, err = s.sessions.Wait(waitCtx, shards, token)
+	cancel()
+	if err != nil {
+		metrics.ConsistencyMiss(metrics.HTTP, "get")
+		s.writeGetResponse(w, r, failureStatus(err), key, nil, false, -1, token, err)
+		return
+	}
+
+	if linearizable {
+		s.linearizableGet(w, r, ns, key, shards, token)
 		return
 	}
 
 	var value []byte
+	var found bool
 	var replica int
-	var response string
 
 	if slices.Contains(shards, s.shards.CurrIdx) {
 		replica = s.shards.CurrIdx
-		value, err = s.db.GetKey(key)
+		value, err = ns.DB.GetKey(key)
 
 		if err == nil {
-			log.Printf("Get processed on coordinator node %d, key = %s, value = %s", s.shards.CurrIdx, key, value)
-			fmt.Fprintf(w, "Replica shard = %d, coordinator shard = %d, current addr = %q, Value = %q, error = %v \n", replica, s.shards.CurrIdx, s.shards.Addrs[s.shards.CurrIdx], value, err)
+			logging.Sampled(r.Context(), "Get processed on the coordinator", "key", key, logging.Value(string(value)))
+			s.writeGetResponse(w, r, http.StatusOK, key, value, value != nil, replica, token, err)
 			return
 		}
 	}
 
-	for _, shard := range shards {
-		replica = shard
-		response, err = s.redirect(replica, w, r)
-		if err != nil {
-			continue
+	// the fastest replica gets the read first, and the slow ones are hedged
+	replicaResponse, replica, err := latency.Hedged(r.Context(), s.latency, s.detector.Targets(shards), func(ctx context.Context, shard int) (GetResponse, error) {
+		var replicaResponse GetResponse
+		response, err := s.redirectWithin(ctx, s.timeouts.Read, shard, r)
+		if err == nil {
+			err = json.Unmarshal([]byte(response), &replicaResponse)
+		}
+		return replicaResponse, err
+	})
+	if err == nil {
+		value, found = []byte(replicaResponse.Value), replicaResponse.Found
+		logging.Sampled(r.Context(), "Get processed on a replica", "replica", replica, "key", key, logging.Value(string(value)))
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		status = failureStatus(err)
+		metrics.ConsistencyMiss(metrics.HTTP, "get")
+	}
+
+	s.writeGetResponse(w, r, status, key, value, found, replica, token, err)
+}
+
+// linearizableGet reads the key on a replica once a barrier on the key, ordered by the consensus module after the
+// earlier writes of the key, executed there. The coordinator reads its own database when it is a replica, and asks
+// the other replicas one after the other, from the fastest, until one answers.
+func (s *HTTPServer) linearizableGet(w http.ResponseWriter, r *http.Request, ns *namespace.Namespace, key string, shards []int, token session.Token) {
+	order := s.latency.Order(s.detector.Targets(shards))
+	if slices.Contains(order, s.shards.CurrIdx) {
+		order = append([]int{s.shards.CurrIdx}, slices.DeleteFunc(order, func(shard int) bool { return shard == s.shards.CurrIdx })...)
+	}
+
+	var value []byte
+	var found bool
+	var err error
+	replica := -1
+	for _, shard := range order {
+		if shard == s.shards.CurrIdx {
+			ctx, cancel := context.WithTimeout(r.Context(), s.timeouts.Read)
+			if err = s.replicator.Barrier(ctx, ns.Name, key); err == nil {
+				value, err = ns.DB.GetKey(key)
+				found = value != nil
+			}
+			cancel()
+		} else {
+			var response string
+			if response, err = s.redirectWithin(r.Context(), s.timeouts.Read, shard, r); err == nil {
+				var replicaResponse GetResponse
+				if err = json.Unmarshal([]byte(response), &replicaResponse); err == nil {
+					value, found = []byte(replicaResponse.Value), replicaResponse.Found
+				}
+			}
+		}
+
+		if err == nil {
+			replica = shard
+			logging.Sampled(r.Context(), "Linearizable get processed", "replica", replica, "key", key, logging.Value(string(value)))
+			break
+		}
+		slog.WarnContext(r.Context(), "Failed a linearizable get", "replica", shard, "key", key, "error", err)
+		if r.Context().Err() != nil {
+			break
 		}
-		parts := strings.Split(response, ":")
-		value = []byte(parts[1])
-		log.Printf("Get processed on shard node %d, key = %s, value = %s", replica, key, value)
-		break
+	}
+	if len(order) == 0 {
+		err = latency.ErrNoReplica
 	}
 
+	status := http.StatusOK
 	if err != nil {
-		w.WriteHeader(http.StatusFailedDependency)
+		status = failureStatus(err)
+		metrics.ConsistencyMiss(metrics.HTTP, "get")
+	}
+
+	s.writeGetResponse(w, r, status, key, value, found, replica, token, err)
+}
+
+// GetResponse is the JSON body of a coordinated get, returned when the client accepts application/json.
+type GetResponse struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Found       bool   `json:"found"`
+	Replica     int    `json:"replica"`
+	Coordinator int    `json:"coordinator"`
+	// Session is the session token of the request, to send with the next reads of the session.
+	Session string `json:"session,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// WriteResponse is the JSON body of a coordinated set or delete.
+type WriteResponse struct {
+	Namespace         string `json:"namespace"`
+	ConsistencyLevel  int    `json:"consistency_level"`
+	ReplicationFactor int    `json:"replication_factor"`
+	// Mode is the write mode of the request, and Durability what the write reached: replicated, hinted,
+	// accepted when the replicas are written in the background, or failed.
+	Mode         string `json:"mode"`
+	Durability   string `json:"durability"`
+	ReplicatedOn []int  `json:"replicated_on"`
+	// HintedOn lists the replicas that missed the write, for which the coordinator keeps a hint.
+	HintedOn    []int `json:"hinted_on,omitempty"`
+	Coordinator int   `json:"coordinator"`
+	// Session is the session token including the write, to send with the next requests of the session.
+	Session string `json:"session,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ScanResponse is the JSON body of a coordinated scan.
+type ScanResponse struct {
+	Items []db.KeyValue `json:"items"`
+	Error string        `json:"error,omitempty"`
+}
+
+func (s *HTTPServer) writeGetResponse(w http.ResponseWriter, r *http.Request, status int, key string, value []byte, found bool, replica int, token session.Token, err error) {
+	setSessionToken(w, token)
+	if wantsJSON(r) {
+		writeJSON(w, status, GetResponse{
+			Key:         key,
+			Value:       string(value),
+			Found:       found,
+			Replica:     replica,
+			Coordinator: s.shards.CurrIdx,
+			Session:     token.String(),
+			Error:       errorString(err),
+		})
+		return
 	}
 
+	w.WriteHeader(status)
 	fmt.Fprintf(w, "Replica shard = %d, coordinator shard = %d, current addr = %q, Value = %q, error = %v \n", replica, s.shards.CurrIdx, s.shards.Addrs[s.shards.CurrIdx], value, err)
 }
 
+func (s *HTTPServer) writeWriteResponse(w http.ResponseWriter, r *http.Request, ns *namespace.Namespace, mode replication.WriteMode, acks replication.Acks, replicatedOn, hintedOn []int, token session.Token, err error) {
+	durability := acks.Durability(len(replicatedOn), len(hintedOn), err)
+	setSessionToken(w, token)
+
+	status := http.StatusOK
+	if durability == replication.DurabilityFailed {
+		status = failureStatus(err)
+		metrics.ConsistencyMiss(metrics.HTTP, path.Base(r.URL.Path))
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, status, WriteResponse{
+			Namespace:         ns.Name,
+			ConsistencyLevel:  ns.ConsistencyLevel,
+			ReplicationFactor: ns.ReplicationFactor,
+			Mode:              mode.String(),
+			Durability:        durability,
+			ReplicatedOn:      replicatedOn,
+			HintedOn:          hintedOn,
+			Coordinator:       s.shards.CurrIdx,
+			Session:           token.String(),
+			Error:             errorString(err),
+		})
+		return
+	}
+
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "CL = %d, RF = %d, mode = %s, durability = %s, Replicated successfully on shards = %v, hinted on shards = %v, coordinator shard = %d, error = %v, \n",
+		ns.ConsistencyLevel, ns.ReplicationFactor, mode, durability, replicatedOn, hintedOn, s.shards.CurrIdx, err)
+}
+
+// writeMode returns the write mode of the request, refusing the request when it is unknown.
+func writeMode(w http.ResponseWriter, r *http.Request) (replication.WriteMode, bool) {
+	mode, err := replication.ParseWriteMode(r.Form.Get("mode"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "%v\n", err)
+		return "", false
+	}
+	return mode, true
+}
+
+// sessionToken returns the session token of the request, refusing the request when it cannot be decoded.
+func sessionToken(w http.ResponseWriter, r *http.Request) (session.Token, bool) {
+	token, err := session.ParseToken(r.Form.Get("session"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "%v\n", err)
+		return nil, false
+	}
+	return token, true
+}
+
+// linearizable reports whether the request asks for a linearizable read, refusing the request when the option
+// is not a boolean.
+func linearizable(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	option := r.Form.Get("linearizable")
+	if option == "" {
+		return false, true
+	}
+
+	linearizable, err := strconv.ParseBool(option)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "invalid linearizable option %q\n", option)
+		return false, false
+	}
+	return linearizable, true
+}
+
+// setSessionToken returns the session token in the X-Session-Token header, for the clients reading the plain text.
+func setSessionToken(w http.ResponseWriter, token session.Token) {
+	if encoded := token.String(); encoded != "" {
+		w.Header().Set("X-Session-Token", encoded)
+	}
+}
+
+// rejectInternal refuses the requests asking to act only on the local replica. Such requests
+// would bypass replication, so they are served only on the internal address, to the other replicas.
+func rejectInternal(w http.ResponseWriter, r *http.Request) bool {
+	if strings.ToLower(r.Form.Get("coordinator")) != "false" {
+		return false
+	}
+
+	slog.WarnContext(r.Context(), "Rejected a replica only request on the public address", "path", r.URL.Path, "remote", r.RemoteAddr)
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprintf(w, "Replica only requests are served on the internal address\n")
+	return true
+}
+
+// namespace returns the namespace named by the request, refusing the request when it is unknown or not allowed.
+func (s *HTTPServer) namespace(w http.ResponseWriter, r *http.Request) (*namespace.Namespace, bool) {
+	ns, err := s.namespaces.Get(r.Form.Get("namespace"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "%v\n", err)
+		return nil, false
+	}
+
+	if auth.CheckNamespace(r.Context(), ns.Name) != nil {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "Access denied\n")
+		return nil, false
+	}
+
+	if err := s.quotas.Allow(r.Context(), ns.Name); err != nil {
+		tooManyRequests(w, err)
+		return nil, false
+	}
+
+	return ns, true
+}
+
+// overQuota refuses a write over the value size limit of the namespace. The replicas check the storage limits.
+func (s *HTTPServer) overQuota(w http.ResponseWriter, ns *namespace.Namespace, value []byte) bool {
+	if err := s.quotas.CheckValue(ns, value); err != nil {
+		tooManyRequests(w, err)
+		return true
+	}
+	return false
+}
+
+// tooManyRequests writes the 429 response of a request over a quota.
+func tooManyRequests(w http.ResponseWriter, err error) {
+	var exceeded *quota.Exceeded
+	if errors.As(err, &exceeded) && exceeded.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(exceeded.RetryAfter.Seconds()))))
+	}
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprintf(w, "Quota exceeded: %v\n", err)
+}
+
+// deny refuses the request when its principal may not do the operation on the key.
+func deny(w http.ResponseWriter, r *http.Request, access auth.Access, key string) bool {
+	if auth.Check(r.Context(), access, key) == nil {
+		return false
+	}
+
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprintf(w, "Access denied\n")
+	return true
+}
+
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// failureStatus returns 504 when the request ran out of time, 429 when the replicas are over a quota, and 424 when
+// the replicas failed it.
+func failureStatus(err error) int {
+	var exceeded *quota.Exceeded
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.As(err, &exceeded) {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusFailedDependency
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
 // SetHandler handles write requests to the distributed database.
 func (s *HTTPServer) SetHandler(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	key := r.Form.Get("key")
-	value := r.Form.Get("value")
-	isCoordinator := r.Form.Get("coordinator")
+	value := []byte(r.Form.Get("value"))
+
+	if rejectInternal(w, r) {
+		return
+	}
+
+	if deny(w, r, auth.Write, key) {
+		return
+	}
+
+	ns, ok := s.namespace(w, r)
+	if !ok {
+		return
+	}
+
+	mode, ok := writeMode(w, r)
+	if !ok {
+		return
+	}
+
+	token, ok := sessionToken(w, r)
+	if !ok {
+		return
+	}
 
-	// this method should be accessed only from the nodes itself. Should not be exposed publicly.
-	if strings.ToLower(isCoordinator) == "false" {
-		err := s.db.SetKey(key, []byte(value))
-		log.Printf("Replicated on replica shard = %d, key = %s, value = %s, error = %v, \n", s.shards.CurrIdx, key, value, err)
+	if s.overQuota(w, ns, value) {
+		return
+	}
+
+	// Add to the order replicator the set command
+	s.replicator.Replicate(r.Context(), ns.Name, key, value)
+
+	shards, err := s.sharder.GetNReplicas(key, ns.ReplicationFactor)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Could not place the key", "key", key, "shards", shards, "error", err)
+		return
+	}
+
+	acks := mode.Acks(ns.ReplicationFactor, ns.ConsistencyLevel).Coordinated(slices.Contains(shards, s.shards.CurrIdx))
+	at := s.sessions.Begin(shards)
+	replicatedOn, hintedOn, err := s.replicate(r.Context(), acks, at, shards, func(ctx context.Context, shard int) error {
+		if shard != s.shards.CurrIdx {
+			return s.writeReplica(ctx, shard, at, replication.Hint{Namespace: ns.Name, Key: key, Value: value}, func(ctx context.Context) error {
+				_, err := s.redirectWithin(ctx, s.timeouts.Write, shard, r)
+				return err
+			})
+		}
+
+		if err := s.quotas.CheckWrite(ns, key, value); err != nil {
+			return err
+		}
+
+		err := ns.DB.SetKey(key, value)
+		logging.Sampled(ctx, "Replicated on the coordinator", "key", key, logging.Value(value), "error", err)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			slog.WarnContext(ctx, "Failed to replicate", "key", key, "replica", shard, "error", err)
 		}
-		w.WriteHeader(http.StatusOK)
+		return err
+	})
+
+	s.writeWriteResponse(w, r, ns, mode, acks, replicatedOn, hintedOn, s.sessions.Token(token, at), err)
+}
+
+// DeleteHandler handles delete requests to the distributed database.
+func (s *HTTPServer) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	key := r.Form.Get("key")
+
+	if rejectInternal(w, r) {
 		return
 	}
 
-	// Add to the order replicator the set command
-	s.replicator.Replicate(key, value)
+	if deny(w, r, auth.Write, key) {
+		return
+	}
+
+	ns, ok := s.namespace(w, r)
+	if !ok {
+		return
+	}
 
-	shards, err := s.sharder.GetNReplicas(key, s.replicationFactor)
+	mode, ok := writeMode(w, r)
+	if !ok {
+		return
+	}
+
+	token, ok := sessionToken(w, r)
+	if !ok {
+		return
+	}
+
+	s.replicator.ReplicateDelete(r.Context(), ns.Name, key)
+
+	shards, err := s.sharder.GetNReplicas(key, ns.ReplicationFactor)
 	if err != nil {
-		log.Printf("Shards = %v, coordinator shard = %d, error = %v, \n", shards, s.shards.CurrIdx, err)
+		slog.ErrorContext(r.Context(), "Could not place the key", "key", key, "shards", shards, "error", err)
+		return
+	}
+
+	acks := mode.Acks(ns.ReplicationFactor, ns.ConsistencyLevel).Coordinated(slices.Contains(shards, s.shards.CurrIdx))
+	at := s.sessions.Begin(shards)
+	replicatedOn, hintedOn, err := s.replicate(r.Context(), acks, at, shards, func(ctx context.Context, shard int) error {
+		if shard != s.shards.CurrIdx {
+			return s.writeReplica(ctx, shard, at, replication.Hint{Namespace: ns.Name, Key: key, Delete: true}, func(ctx context.Context) error {
+				_, err := s.redirectWithin(ctx, s.timeouts.Write, shard, r)
+				return err
+			})
+		}
+
+		err := ns.DB.DeleteKey(key)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to delete", "key", key, "replica", shard, "error", err)
+		}
+		return err
+	})
+
+	s.writeWriteResponse(w, r, ns, mode, acks, replicatedOn, hintedOn, s.sessions.Token(token, at), err)
+}
+
+// ScanHandler returns the keys starting with a prefix. It merges the keys of all shards,
+// keeping from every shard only the keys it is a replica for.
+func (s *HTTPServer) ScanHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	prefix := r.Form.Get("prefix")
+
+	if rejectInternal(w, r) {
+		return
+	}
+
+	ns, ok := s.namespace(w, r)
+	if !ok {
 		return
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(s.consistencyLevel)
-	errCh := make(chan error, s.replicationFactor)
-	successCh := make(chan int, s.replicationFactor)
-	successCounter := 0
-	errorCounter := 0
+	limit, err := strconv.Atoi(r.Form.Get("limit"))
+	if err != nil {
+		limit = 0
+	}
 
-	for i, shard := range shards {
-		var closure func(shard int, errCh chan<- error)
+	merged := make(map[string][]byte)
+	var scanErr error
 
+	for shard := 0; shard < s.shards.Count; shard++ {
+		var items []db.KeyValue
 		if shard == s.shards.CurrIdx {
-			// why we send errCh as fun arg ?
-			closure = func(shard int, errCh chan<- error) {
-				log.Printf("Replicated on coordinator replica shard = %d, key = %s, value = %s, error = %v, \n", s.shards.CurrIdx, key, value, err)
-
-				err = s.db.SetKey(key, []byte(value))
-				if err != nil {
-					log.Printf("Failed to replicate key = %s, value = %s on shard %d, error = %v", key, value, shard, err)
-					errCh <- err
-					return
-				}
-				successCh <- shard
-			}
+			items, err = ns.DB.Scan(prefix, 0)
+		} else if !s.detector.Alive(shard) {
+			err = gossip.ErrSuspected
 		} else {
-			closure = func(shard int, errCh chan<- error) {
-				_, err := s.redirect(shard, w, r)
-				if err != nil {
-					log.Printf("Failed to replicate key = %s, value = %s on shard %d, error = %v", key, value, shard, err)
-					errCh <- err
-					return
-				}
-				successCh <- shard
+			var response string
+			// every shard returns all its matching keys, as some of them may be dropped below
+			response, err = s.sendWithin(r.Context(), s.timeouts.Scan, shard, "/scan", url.Values{"prefix": {prefix}, "namespace": {ns.Name}})
+			if err == nil {
+				err = json.Unmarshal([]byte(response), &items)
 			}
 		}
 
-		if i < s.consistencyLevel {
-			go func(shard int, errCh chan<- error) {
-				closure(shard, errCh)
-				defer wg.Done()
-			}(shard, errCh)
-		} else {
-			go closure(shard, errCh)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Failed to scan", "prefix", prefix, "replica", shard, "error", err)
+			scanErr = err
+			continue
+		}
+
+		for _, item := range items {
+			// the keys the principal may not read are left out
+			if !auth.Allowed(r.Context(), auth.Read, item.Key) {
+				continue
+			}
+
+			replicas, err := s.sharder.GetNReplicas(item.Key, ns.ReplicationFactor)
+			if err == nil && slices.Contains(replicas, shard) {
+				merged[item.Key] = item.Value
+			}
 		}
 	}
 
-	wg.Wait()
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	shards = make([]int, 0)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
 
-outerLoop:
-	for {
-		select {
-		case replicatedShard := <-successCh:
-			shards = append(shards, replicatedShard)
-			successCounter++
-			if successCounter == s.consistencyLevel {
-				break outerLoop
-			}
+	items := make([]db.KeyValue, len(keys))
+	for i, key := range keys {
+		items[i] = db.KeyValue{Key: key, Value: merged[key]}
+	}
 
-			// if s.replicationFactor responses arrive, then the wait is stopped.
-			// TODO what if response does not arrive? rest timeout will happen ?
-			if errorCounter+successCounter >= s.replicationFactor {
-				break outerLoop
-			}
-		default:
-			err = <-errCh
-			errorCounter++
-			if errorCounter+successCounter >= s.replicationFactor {
-				break outerLoop
-			}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, ScanResponse{Items: items, Error: errorString(scanErr)})
+		return
+	}
+
+	for _, item := range items {
+		fmt.Fprintf(w, "Key = %q, Value = %q\n", item.Key, item.Value)
+	}
+	if scanErr != nil {
+		fmt.Fprintf(w, "error = %v\n", scanErr)
+	}
+}
+
+// replicate sends a write to every replica shard with replication.Fanouts.Replicate. at is the position of the
+// write, Begun for the shards. Every replica that stored the write or got a hint kept for it is Done with it, and
+// the others Missed it.
+func (s *HTTPServer) replicate(ctx context.Context, acks replication.Acks, at uint64, shards []int, write func(ctx context.Context, shard int) error) (replicatedOn, hintedOn []int, err error) {
+	return s.fanouts.Replicate(ctx, acks, s.shards.CurrIdx, shards, write, func(shard int, err error) {
+		s.ended(shard, at, err)
+	})
+}
+
+// ended records the result of a write on a replica.
+func (s *HTTPServer) ended(shard int, at uint64, err error) {
+	if err == nil || errors.Is(err, replication.ErrHinted) {
+		s.sessions.Done(shard, at)
+	} else {
+		s.sessions.Missed(shard, at)
+	}
+	metrics.ObserveReplicaRequest(metrics.HTTP, err)
+}
+
+// push returns a function writing the keys of the namespace on a replica shard, without further replication.
+func (s *HTTPServer) push(ctx context.Context, ns *namespace.Namespace) replication.Push {
+	return func(shard int, item db.KeyValue) error {
+		_, err := s.sendWithin(ctx, s.timeouts.Write, shard, "/set", url.Values{"key": {item.Key}, "value": {string(item.Value)}, "namespace": {ns.Name}})
+		return err
+	}
+}
+
+// AdminResponse is the JSON body of the purge, repair and rebalance endpoints.
+type AdminResponse struct {
+	Keys  int    `json:"keys"`
+	Error string `json:"error,omitempty"`
+}
+
+// StatsResponse is the JSON body of the stats endpoint.
+type StatsResponse struct {
+	Shard      int            `json:"shard"`
+	Name       string         `json:"name"`
+	Keys       int            `json:"keys"`
+	Namespaces map[string]int `json:"namespaces"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// DeleteExtraKeysHandler deletes keys that don't belong to the current shard.
+func (s *HTTPServer) DeleteExtraKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if deny(w, r, auth.Admin, "") {
+		return
+	}
+
+	var err error
+	for _, ns := range s.namespaces.All() {
+		nsErr := ns.DB.DeleteExtraKeys(func(key string) bool {
+			return s.sharder.Index(key) != s.shards.CurrIdx
+		})
+		if nsErr != nil {
+			err = nsErr
 		}
 	}
 
-	if err != nil && len(shards) != s.consistencyLevel {
-		w.WriteHeader(http.StatusFailedDependency)
+	if wantsJSON(r) {
+		s.writeAdminResponse(w, r, 0, err)
+		return
 	}
 
-	fmt.Fprintf(w, "CL = %d, RF = %d, Replicated successfully on shards = %v, coordinator shard = %d, error = %v, \n", s.consistencyLevel, s.replicationFactor, shards, s.shards.CurrIdx, err)
+	fmt.Fprintf(w, "Error = %v\n", err)
 }
 
-func (s *HTTPServer) redirect(shardIndx int, w http.ResponseWriter, r *http.Request) (string, error) {
-	url := "http://" + s.shards.Addrs[shardIndx] + r.RequestURI + "&coordinator=false"
+// RepairHandler pushes the keys the current shard is a replica for to the other replicas of these keys.
+func (s *HTTPServer) RepairHandler(w http.ResponseWriter, r *http.Request) {
+	if deny(w, r, auth.Admin, "") {
+		return
+	}
 
-	client := http.Client{
-		Timeout: time.Second,
+	var repaired int
+	var err error
+	for _, ns := range s.namespaces.All() {
+		nsRepaired, nsErr := replication.Repair(ns.DB, s.sharder, s.shards, ns.ReplicationFactor, s.push(r.Context(), ns))
+		repaired += nsRepaired
+		if nsErr != nil {
+			err = nsErr
+		}
 	}
+	slog.InfoContext(r.Context(), "Repair done", "pushed", repaired, "error", err)
 
-	resp, err := client.Get(url)
-	if err != nil {
-		log.Printf("Error on node %d when redirecting the request: %v \n", s.shards.CurrIdx, err)
-		return "", err
+	s.writeAdminResponse(w, r, repaired, err)
+}
+
+// RebalanceHandler moves the keys the current shard is no longer a replica for to their replicas.
+func (s *HTTPServer) RebalanceHandler(w http.ResponseWriter, r *http.Request) {
+	if deny(w, r, auth.Admin, "") {
+		return
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("could not receive a success response on redirect")
+	var moved int
+	var err error
+	for _, ns := range s.namespaces.All() {
+		nsMoved, nsErr := replication.Rebalance(ns.DB, s.sharder, s.shards, ns.ReplicationFactor, s.push(r.Context(), ns))
+		moved += nsMoved
+		if nsErr != nil {
+			err = nsErr
+		}
 	}
-	defer resp.Body.Close()
+	slog.InfoContext(r.Context(), "Rebalance done", "moved", moved, "error", err)
+
+	s.writeAdminResponse(w, r, moved, err)
+}
 
-	body, err := io.ReadAll(resp.Body)
+// StatsHandler reports the number of keys stored on the current shard, in total and per namespace.
+func (s *HTTPServer) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	if deny(w, r, auth.Admin, "") {
+		return
+	}
+
+	var keys int
+	var err error
+	namespaces := make(map[string]int)
+	for _, ns := range s.namespaces.All() {
+		count, nsErr := ns.DB.KeyCount()
+		if nsErr != nil {
+			err = nsErr
+			continue
+		}
+		namespaces[ns.Name] = count
+		keys += count
+	}
+
+	status := http.StatusOK
 	if err != nil {
-		fmt.Println("Error:", err)
-		return "", err
+		status = http.StatusInternalServerError
 	}
 
-	return string(body), nil
+	if wantsJSON(r) {
+		writeJSON(w, status, StatsResponse{Shard: s.shards.CurrIdx, Name: s.name, Keys: keys, Namespaces: namespaces, Error: errorString(err)})
+		return
+	}
+
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "Shard = %d, name = %s, keys = %d, error = %v\n", s.shards.CurrIdx, s.name, keys, err)
 }
 
-// DeleteExtraKeysHandler deletes keys that don't belong to the current shard.
-func (s *HTTPServer) DeleteExtraKeysHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Error = %v\n", s.db.DeleteExtraKeys(func(key string) bool {
-		return s.sharder.Index(key) != s.shards.CurrIdx
-	}))
+// LogLevelResponse is the JSON body of the loglevel endpoint.
+type LogLevelResponse struct {
+	Level string `json:"level"`
+	Error string `json:"error,omitempty"`
+}
+
+// LogLevelHandler changes the log level of the current shard to the level query parameter, when given,
+// and reports the level in use.
+func (s *HTTPServer) LogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if deny(w, r, auth.Admin, "") {
+		return
+	}
+
+	var err error
+	status := http.StatusOK
+	if name := r.FormValue("level"); name != "" {
+		if err = logging.SetLevel(name); err != nil {
+			status = http.StatusBadRequest
+		} else {
+			slog.InfoContext(r.Context(), "Changed the log level", "level", logging.Level().String())
+		}
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, status, LogLevelResponse{Level: logging.Level().String(), Error: errorString(err)})
+		return
+	}
+
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "Level = %s, error = %v\n", logging.Level(), err)
+}
+
+func (s *HTTPServer) writeAdminResponse(w http.ResponseWriter, r *http.Request, keys int, err error) {
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, status, AdminResponse{Keys: keys, Error: errorString(err)})
+		return
+	}
+
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "Keys = %d, Error = %v\n", keys, err)
 }
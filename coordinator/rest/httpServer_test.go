@@ -6,6 +6,7 @@ import (
 	"github.com/EliriaT/distributed-store/config"
 	"github.com/EliriaT/distributed-store/coordinator/rest"
 	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/namespace"
 	"io"
 	"log"
 	"net/http"
@@ -54,7 +55,7 @@ func createShardDb(t *testing.T, idx int) *db.BoltDatabase {
 	name := tmpFile.Name()
 	t.Cleanup(func() { os.Remove(name) })
 
-	db, closeFunc, err := db.NewBoltDatabase(name)
+	db, closeFunc, err := db.NewBoltDatabase(name, db.BoltOptions{})
 	if err != nil {
 		t.Fatalf("Could not create new database %q: %v", name, err)
 	}
@@ -75,28 +76,40 @@ func createShardServer(t *testing.T, idx int, addrs map[int]string) (*db.BoltDat
 		idx = 0
 		name = "Orhei"
 		address = "localhost:8080"
+		internal_address = "localhost:9080"
 
 		[[shards]]
 		idx = 1
 		name = "Chisinau"
-		address = "localhost:8081"`)
+		address = "localhost:8081"
+		internal_address = "localhost:9081"`)
 
+	// the test servers serve both the public and the internal endpoints
 	shards := &config.Shards{
-		Addrs:   addrs,
-		Count:   len(addrs),
-		CurrIdx: idx,
+		Addrs:         addrs,
+		InternalAddrs: addrs,
+		Count:         len(addrs),
+		CurrIdx:       idx,
 	}
 
-	s := rest.NewServer(db, shards, cfg, "config/env/.env0")
+	namespaces, err := namespace.NewRegistry(db, cfg)
+	if err != nil {
+		t.Fatalf("Could not open the namespaces: %v", err)
+	}
+
+	s := rest.NewServer(namespaces, shards, cfg, "config/env/.env0")
 	return db, s
 }
 
 func TestWebServer(t *testing.T) {
 	var ts1GetHandler, ts1SetHandler func(w http.ResponseWriter, r *http.Request)
 	var ts2GetHandler, ts2SetHandler func(w http.ResponseWriter, r *http.Request)
+	var ts1Internal, ts2Internal http.Handler
 
 	ts1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.RequestURI, "/get") {
+		if strings.HasPrefix(r.RequestURI, "/internal") {
+			ts1Internal.ServeHTTP(w, r)
+		} else if strings.HasPrefix(r.RequestURI, "/get") {
 			ts1GetHandler(w, r)
 		} else if strings.HasPrefix(r.RequestURI, "/set") {
 			ts1SetHandler(w, r)
@@ -105,7 +118,9 @@ func TestWebServer(t *testing.T) {
 	defer ts1.Close()
 
 	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.RequestURI, "/get") {
+		if strings.HasPrefix(r.RequestURI, "/internal") {
+			ts2Internal.ServeHTTP(w, r)
+		} else if strings.HasPrefix(r.RequestURI, "/get") {
 			ts2GetHandler(w, r)
 		} else if strings.HasPrefix(r.RequestURI, "/set") {
 			ts2SetHandler(w, r)
@@ -131,6 +146,8 @@ func TestWebServer(t *testing.T) {
 	ts1SetHandler = web1.SetHandler
 	ts2GetHandler = web2.GetHandler
 	ts2SetHandler = web2.SetHandler
+	ts1Internal = web1.InternalHandler()
+	ts2Internal = web2.InternalHandler()
 
 	for key := range keys {
 		// Send all to first shard to test redirects.
@@ -160,6 +177,14 @@ func TestWebServer(t *testing.T) {
 		log.Printf("Contents of key %q: %s", key, contents)
 	}
 
+	resp, err := http.Get(ts1.URL + "/set?key=Orhei&value=bypass&coordinator=false")
+	if err != nil {
+		t.Fatalf("Could not send a replica only set: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Replica only requests on the public address: got status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
 	value1, err := db1.GetKey("Chisinau")
 	if err != nil {
 		t.Fatalf("Chisinau key error: %v", err)
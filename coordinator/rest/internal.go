@@ -0,0 +1,200 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/EliriaT/distributed-store/coordinator/peerauth"
+	"github.com/EliriaT/distributed-store/coordinator/quota"
+	"github.com/EliriaT/distributed-store/logging"
+	"github.com/EliriaT/distributed-store/metrics"
+	"github.com/EliriaT/distributed-store/namespace"
+	"github.com/EliriaT/distributed-store/tracing"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// InternalHandler serves the replica to replica requests. It must be exposed only on the internal address,
+// and every request has to carry the cluster secret.
+func (s *HTTPServer) InternalHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/internal/get", s.InternalGetHandler)
+	mux.HandleFunc("/internal/set", s.InternalSetHandler)
+	mux.HandleFunc("/internal/delete", s.InternalDeleteHandler)
+	mux.HandleFunc("/internal/scan", s.InternalScanHandler)
+	mux.HandleFunc("/internal/status", s.InternalStatusHandler)
+	mux.HandleFunc("/internal/gossip", s.InternalGossipHandler)
+
+	return tracing.Handler(peerauth.Middleware(s.clusterSecret, mux), "internal")
+}
+
+// InternalGetHandler reads a key from the local database only. A linearizable read waits for a barrier on the key
+// to execute on the node first.
+func (s *HTTPServer) InternalGetHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+
+	ns, ok := s.localNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	if linearizable, _ := strconv.ParseBool(r.URL.Query().Get("linearizable")); linearizable {
+		if err := s.replicator.Barrier(r.Context(), ns.Name, key); err != nil {
+			slog.WarnContext(r.Context(), "Failed a read barrier", "key", key, "error", err)
+			w.WriteHeader(failureStatus(err))
+			return
+		}
+	}
+
+	value, err := ns.DB.GetKey(key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, GetResponse{
+		Key:         key,
+		Value:       string(value),
+		Found:       value != nil,
+		Replica:     s.shards.CurrIdx,
+		Coordinator: s.shards.CurrIdx,
+	})
+}
+
+// InternalSetHandler writes a key to the local database only. A write over the storage limits of the namespace on
+// this replica is refused with 429 and the exceeded limit.
+func (s *HTTPServer) InternalSetHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	value := r.URL.Query().Get("value")
+
+	ns, ok := s.localNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.quotas.CheckWrite(ns, key, []byte(value)); err != nil {
+		writeJSON(w, http.StatusTooManyRequests, err)
+		return
+	}
+
+	err := ns.DB.SetKey(key, []byte(value))
+	logging.Sampled(r.Context(), "Replicated on a replica", "key", key, logging.Value(value), "error", err)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// InternalDeleteHandler deletes a key from the local database only.
+func (s *HTTPServer) InternalDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+
+	ns, ok := s.localNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	err := ns.DB.DeleteKey(key)
+	logging.Sampled(r.Context(), "Deleted on a replica", "key", key, "error", err)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// InternalScanHandler returns the local keys starting with a prefix.
+func (s *HTTPServer) InternalScanHandler(w http.ResponseWriter, r *http.Request) {
+	ns, ok := s.localNamespace(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := ns.DB.Scan(r.URL.Query().Get("prefix"), 0)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// InternalStatusHandler reports the status of the current shard to a peer.
+func (s *HTTPServer) InternalStatusHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// localNamespace returns the namespace of an internal request. The peer already checked the access of the caller.
+func (s *HTTPServer) localNamespace(w http.ResponseWriter, r *http.Request) (*namespace.Namespace, bool) {
+	ns, err := s.namespaces.Get(r.URL.Query().Get("namespace"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	return ns, true
+}
+
+// redirectWithin sends the request to the internal address of a shard, failing it after timeout. It forwards the
+// parsed form, so the values of a POST body reach the shard like the ones of the query.
+func (s *HTTPServer) redirectWithin(ctx context.Context, timeout time.Duration, shardIndx int, r *http.Request) (string, error) {
+	// the form is copied, as the redirects to the replicas run in parallel and send changes the values
+	return s.sendWithin(ctx, timeout, shardIndx, r.URL.Path, maps.Clone(r.Form))
+}
+
+// sendWithin is send failing after timeout, or at the deadline of ctx when it comes first.
+func (s *HTTPServer) sendWithin(ctx context.Context, timeout time.Duration, shardIndx int, path string, query url.Values) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return s.send(ctx, shardIndx, path, query)
+}
+
+// send calls the internal version of an endpoint on the internal address of a shard.
+func (s *HTTPServer) send(ctx context.Context, shardIndx int, path string, query url.Values) (string, error) {
+	body, err := s.call(ctx, shardIndx, path, query)
+	metrics.SetPeerUp(shardIndx, err == nil)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not reach a replica", "replica", shardIndx, "path", path, "error", err)
+	}
+	return body, err
+}
+
+// call is send without the logs and metrics, for the requests sent on every gossip round.
+func (s *HTTPServer) call(ctx context.Context, shardIndx int, path string, query url.Values) (string, error) {
+	query.Del("coordinator")
+	target := url.URL{Scheme: s.peerScheme, Host: s.shards.InternalAddrs[shardIndx], Path: "/internal" + path, RawQuery: query.Encode()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(peerauth.Header, s.clusterSecret)
+
+	resp, err := s.peerClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		exceeded := &quota.Exceeded{}
+		if err := json.NewDecoder(resp.Body).Decode(exceeded); err == nil {
+			return "", exceeded
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not receive a success response on redirect")
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(body), nil
+}
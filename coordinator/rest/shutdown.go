@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Drain makes the readiness checks fail, so that no new requests are routed to the node while it stops.
+func (s *HTTPServer) Drain() {
+	s.draining.Store(true)
+}
+
+// Shutdown waits for the writes to the replicas still running, replays the hints to the replicas that are alive,
+// writes the queued ordered commands and closes the idle connections to the peers. The writes starting after it
+// is called fail with replication.ErrStopping, and the hints not replayed are lost, as they are kept in memory only.
+// Stop serving the public address first. It returns ctx.Err() when ctx is done first.
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	s.Drain()
+	defer s.peerClient.CloseIdleConnections()
+
+	err := s.fanouts.Close(ctx)
+	if err == nil {
+		s.replayHints(ctx)
+	}
+	if lost := s.pendingHints(); lost > 0 {
+		slog.WarnContext(ctx, "Lost the hints not replayed before stopping", "hints", lost)
+	}
+	if err != nil {
+		return fmt.Errorf("waiting for the replica writes: %w", err)
+	}
+	return s.replicator.Close(ctx)
+}
+
+// pendingHints returns the number of hints kept for all the peers.
+func (s *HTTPServer) pendingHints() int {
+	pending := 0
+	for shard := 0; shard < s.shards.Count; shard++ {
+		pending += s.hints.Pending(shard)
+	}
+	return pending
+}
@@ -0,0 +1,314 @@
+// Package session gives the reads of a client session the writes it made, whatever node coordinates them.
+// Every coordinator stamps its writes with a position on its own clock, and a write returns a token holding the
+// position of the last write of the session per coordinator. A replica has caught up with a token once each of these
+// coordinators has no write older than its position still pending for the replica. The coordinators share how far
+// every replica caught up with their writes, their watermarks, over gossip.
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/metrics"
+	"slices"
+	"sync"
+	"time"
+)
+
+// pollInterval is how often a read waiting for a replica to catch up checks the watermarks again.
+const pollInterval = 5 * time.Millisecond
+
+// DefaultMissedTimeout is how long a replica stays behind the writes it missed without a hint, after the last one.
+const DefaultMissedTimeout = time.Minute
+
+// ErrBehind fails a read when no replica caught up with its session token in time.
+var ErrBehind = errors.New("no replica caught up with the session")
+
+// Clock is a hybrid logical clock: the wall clock in nanoseconds, moved forward by one when it did not advance,
+// so that its readings on one node always increase while it runs.
+type Clock struct {
+	mu   sync.Mutex
+	last uint64
+}
+
+// Now returns a position greater than all the ones returned before.
+func (c *Clock) Now() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last = max(uint64(time.Now().UnixNano()), c.last+1)
+	return c.last
+}
+
+// Mark is what a token asks of the writes of one coordinator.
+type Mark struct {
+	// Position follows the last write of the session the coordinator made.
+	Position uint64 `json:"p"`
+	// CaughtUp lists the replicas the coordinator knew had all its writes before the position when it made the mark.
+	CaughtUp []int `json:"c,omitempty"`
+}
+
+// Token is a session token, the mark of every coordinator the session wrote through, by shard.
+type Token map[int]Mark
+
+// ParseToken decodes a token sent by a client. An empty token is a nil Token, asking nothing.
+func ParseToken(encoded string) (Token, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session token: %w", err)
+	}
+
+	var token Token
+	if err := json.Unmarshal(payload, &token); err != nil {
+		return nil, fmt.Errorf("invalid session token: %w", err)
+	}
+	return token, nil
+}
+
+// String encodes the token for a client, as URL safe base64. A token without marks is empty.
+func (t Token) String() string {
+	if len(t) == 0 {
+		return ""
+	}
+
+	payload, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// Merge returns a token asking for both t and other: the later mark of every coordinator.
+func (t Token) Merge(other Token) Token {
+	merged := make(Token, len(t)+len(other))
+	for shard, mark := range t {
+		merged[shard] = mark
+	}
+
+	for shard, mark := range other {
+		known, ok := merged[shard]
+		switch {
+		case !ok || mark.Position > known.Position:
+			merged[shard] = mark
+		case mark.Position == known.Position:
+			caughtUp := append(slices.Clone(known.CaughtUp), mark.CaughtUp...)
+			slices.Sort(caughtUp)
+			merged[shard] = Mark{Position: mark.Position, CaughtUp: slices.Compact(caughtUp)}
+		}
+	}
+	return merged
+}
+
+// Watermarks maps a replica shard to the position before which it has all the writes of a coordinator.
+type Watermarks map[int]uint64
+
+// Tracker keeps the writes the current shard coordinates until the replicas have them, and the watermarks
+// gossiped by the other coordinators.
+type Tracker struct {
+	mu     sync.Mutex
+	self   int
+	count  int
+	clock  Clock
+	hinted func(shard int) (uint64, bool)
+	// running counts the writes sent to every replica and not answered yet, by position
+	running map[int]map[uint64]int
+	// missed holds the oldest write every replica missed without a hint kept for it
+	missed map[int]missed
+	// remote holds the watermarks gossiped by every other coordinator
+	remote map[int]Watermarks
+	// MissedTimeout is how long a replica stays behind the writes it missed without a hint, after the last one.
+	// It is DefaultMissedTimeout unless changed before the tracker is used.
+	MissedTimeout time.Duration
+}
+
+// missed is the position of the oldest write a replica missed, and the position past which it is forgotten.
+type missed struct {
+	at, until uint64
+}
+
+// NewTracker creates the tracker of the current shard in a cluster of count shards. hinted returns the position of
+// the oldest write the current shard keeps as a hint for a replica, and false when it keeps none.
+func NewTracker(self, count int, hinted func(shard int) (uint64, bool)) *Tracker {
+	return &Tracker{
+		self:    self,
+		count:   count,
+		hinted:  hinted,
+		running: make(map[int]map[uint64]int),
+		missed:  make(map[int]missed),
+		remote:  make(map[int]Watermarks),
+
+		MissedTimeout: DefaultMissedTimeout,
+	}
+}
+
+// Begin stamps a write sent to the replica shards, and returns its position.
+func (t *Tracker) Begin(shards []int) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	at := t.clock.Now()
+	for _, shard := range shards {
+		if t.running[shard] == nil {
+			t.running[shard] = make(map[uint64]int)
+		}
+		t.running[shard][at]++
+	}
+	return at
+}
+
+// Done records that the replica answered the write at the position. A write the replica missed must be kept
+// as a hint before, so that the replica stays behind until the hint is replayed.
+func (t *Tracker) Done(shard int, at uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done(shard, at)
+}
+
+// Missed records that the replica missed the write at the position and no hint was kept for it. Nothing tells
+// when a repair brings the write to the replica, so the replica stays behind it for MissedTimeout after the last
+// write it missed, and the sessions of the current shard read from the replicas that have it meanwhile.
+func (t *Tracker) Missed(shard int, at uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done(shard, at)
+	until := t.clock.Now() + uint64(t.MissedTimeout)
+	if known, ok := t.missed[shard]; ok {
+		at = min(at, known.at)
+	}
+	t.missed[shard] = missed{at: at, until: until}
+}
+
+// done forgets the write running on the replica at the position. The caller holds mu.
+func (t *Tracker) done(shard int, at uint64) {
+	if t.running[shard][at]--; t.running[shard][at] <= 0 {
+		delete(t.running[shard], at)
+	}
+}
+
+// Watermarks returns how far every replica caught up with the writes of the current shard, to gossip them.
+func (t *Tracker) Watermarks() Watermarks {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+	watermarks := make(Watermarks, t.count)
+	for shard := 0; shard < t.count; shard++ {
+		watermarks[shard] = t.watermark(shard, now)
+	}
+	return watermarks
+}
+
+// watermark returns the position of the oldest write still running, hinted or recently missed for the replica,
+// or now. The caller holds mu.
+func (t *Tracker) watermark(shard int, now uint64) uint64 {
+	watermark := now
+	for at := range t.running[shard] {
+		watermark = min(watermark, at)
+	}
+	if missed, ok := t.missed[shard]; ok {
+		if now < missed.until {
+			watermark = min(watermark, missed.at)
+		} else {
+			delete(t.missed, shard)
+		}
+	}
+	if at, ok := t.hinted(shard); ok {
+		watermark = min(watermark, at)
+	}
+	return watermark
+}
+
+// Merge records the watermarks gossiped by another coordinator. The watermarks never go back, so an older gossip
+// arriving late is ignored.
+func (t *Tracker) Merge(coordinator int, watermarks Watermarks) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	known, ok := t.remote[coordinator]
+	if !ok {
+		known = make(Watermarks, len(watermarks))
+		t.remote[coordinator] = known
+	}
+	for shard, watermark := range watermarks {
+		known[shard] = max(known[shard], watermark)
+	}
+}
+
+// Token returns the token of a write at the position, made by the current shard for a session holding token.
+func (t *Tracker) Token(token Token, at uint64) Token {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+	mark := Mark{Position: at + 1}
+	for shard := 0; shard < t.count; shard++ {
+		if t.watermark(shard, now) > at {
+			mark.CaughtUp = append(mark.CaughtUp, shard)
+		}
+	}
+	return token.Merge(Token{t.self: mark})
+}
+
+// CaughtUp reports whether the replica shard has all the writes the token asks for.
+func (t *Tracker) CaughtUp(shard int, token Token) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var now uint64
+	for coordinator, mark := range token {
+		if slices.Contains(mark.CaughtUp, shard) {
+			continue
+		}
+
+		var watermark uint64
+		if coordinator == t.self {
+			if now == 0 {
+				now = t.clock.Now()
+			}
+			watermark = t.watermark(shard, now)
+		} else {
+			watermark = t.remote[coordinator][shard]
+		}
+		if watermark < mark.Position {
+			return false
+		}
+	}
+	return true
+}
+
+// Wait returns the shards that caught up with the token, keeping their order. When none did, it waits for the
+// gossip to tell that one did, until ctx is done.
+func (t *Tracker) Wait(ctx context.Context, shards []int, token Token) ([]int, error) {
+	if len(token) == 0 {
+		return shards, nil
+	}
+
+	start := time.Now()
+	defer func() { metrics.ObserveSessionWait(time.Since(start)) }()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		caughtUp := make([]int, 0, len(shards))
+		for _, shard := range shards {
+			if t.CaughtUp(shard, token) {
+				caughtUp = append(caughtUp, shard)
+			}
+		}
+		if len(caughtUp) > 0 {
+			return caughtUp, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrBehind, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
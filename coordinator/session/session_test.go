@@ -0,0 +1,195 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/coordinator/session"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	var clock session.Clock
+
+	last := clock.Now()
+	for i := 0; i < 1000; i++ {
+		now := clock.Now()
+		if now <= last {
+			t.Fatalf("The clock went from %d to %d", last, now)
+		}
+		last = now
+	}
+}
+
+func TestToken(t *testing.T) {
+	token := session.Token{0: {Position: 10, CaughtUp: []int{0, 1}}, 2: {Position: 5}}
+
+	parsed, err := session.ParseToken(token.String())
+	if err != nil {
+		t.Fatalf("Could not parse the token: %v", err)
+	}
+	if parsed[0].Position != 10 || !slices.Equal(parsed[0].CaughtUp, []int{0, 1}) || parsed[2].Position != 5 {
+		t.Errorf("The token changed on the way: %v", parsed)
+	}
+
+	if empty, err := session.ParseToken(""); err != nil || empty != nil {
+		t.Errorf("ParseToken of an empty token = %v, %v", empty, err)
+	}
+	if _, err := session.ParseToken("not a token"); err == nil {
+		t.Errorf("A malformed token was accepted")
+	}
+
+	merged := token.Merge(session.Token{0: {Position: 10, CaughtUp: []int{2}}, 2: {Position: 4}, 1: {Position: 7}})
+	if !slices.Equal(merged[0].CaughtUp, []int{0, 1, 2}) {
+		t.Errorf("The replicas caught up with the same position were not joined: %v", merged[0].CaughtUp)
+	}
+	if merged[2].Position != 5 || merged[1].Position != 7 {
+		t.Errorf("Merge did not keep the later mark of every coordinator: %v", merged)
+	}
+	if len(token) != 2 {
+		t.Errorf("Merge changed the token it was called on: %v", token)
+	}
+}
+
+func TestTrackerReadYourWrites(t *testing.T) {
+	hinted := map[int]uint64{}
+	tracker := session.NewTracker(0, 3, func(shard int) (uint64, bool) {
+		at, ok := hinted[shard]
+		return at, ok
+	})
+
+	at := tracker.Begin([]int{0, 1, 2})
+	tracker.Done(0, at)
+	tracker.Done(1, at)
+	token := tracker.Token(nil, at)
+
+	if !slices.Equal(token[0].CaughtUp, []int{0, 1}) {
+		t.Errorf("CaughtUp = %v, want the replicas that answered", token[0].CaughtUp)
+	}
+	if tracker.CaughtUp(2, token) {
+		t.Errorf("A replica still being written caught up")
+	}
+
+	// the replica missed the write, which is kept as a hint until it is back
+	hinted[2] = at
+	tracker.Done(2, at)
+	if tracker.CaughtUp(2, token) {
+		t.Errorf("A replica with a hint pending caught up")
+	}
+
+	delete(hinted, 2)
+	if !tracker.CaughtUp(2, token) {
+		t.Errorf("The replica did not catch up once the hint was replayed")
+	}
+}
+
+func TestTrackerMissed(t *testing.T) {
+	tracker := session.NewTracker(0, 3, func(int) (uint64, bool) { return 0, false })
+
+	// the write failed on shard 2 and no hint could be kept for it
+	at := tracker.Begin([]int{0, 1, 2})
+	tracker.Done(0, at)
+	tracker.Done(1, at)
+	tracker.Missed(2, at)
+	token := tracker.Token(nil, at)
+
+	if slices.Contains(token[0].CaughtUp, 2) || tracker.CaughtUp(2, token) {
+		t.Errorf("A replica that missed the write caught up")
+	}
+	if watermark := tracker.Watermarks()[2]; watermark > at {
+		t.Errorf("The gossiped watermark %d of the replica is past the missed write %d", watermark, at)
+	}
+
+	// later writes do not move the replica past the missed one
+	later := tracker.Begin([]int{2})
+	tracker.Done(2, later)
+	if tracker.CaughtUp(2, tracker.Token(nil, later)) {
+		t.Errorf("A replica caught up past a write it missed")
+	}
+	if !tracker.CaughtUp(0, token) {
+		t.Errorf("The replicas that stored the write did not catch up")
+	}
+}
+
+func TestTrackerMissedTimeout(t *testing.T) {
+	tracker := session.NewTracker(0, 2, func(int) (uint64, bool) { return 0, false })
+	tracker.MissedTimeout = 20 * time.Millisecond
+
+	at := tracker.Begin([]int{0, 1})
+	tracker.Done(0, at)
+	tracker.Missed(1, at)
+	token := tracker.Token(nil, at)
+	if tracker.CaughtUp(1, token) {
+		t.Fatalf("A replica that missed the write caught up")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !tracker.CaughtUp(1, token) {
+		t.Errorf("The replica stayed behind a missed write past the timeout")
+	}
+	if watermark := tracker.Watermarks()[1]; watermark <= at {
+		t.Errorf("The gossiped watermark %d of the replica stayed behind the missed write %d", watermark, at)
+	}
+}
+
+func TestTrackerRemoteWatermarks(t *testing.T) {
+	coordinator := session.NewTracker(1, 2, func(int) (uint64, bool) { return 0, false })
+	reader := session.NewTracker(0, 2, func(int) (uint64, bool) { return 0, false })
+
+	at := coordinator.Begin([]int{0, 1})
+	coordinator.Done(1, at)
+	token := coordinator.Token(nil, at)
+
+	// the write to shard 0 is still running when the coordinator gossips
+	reader.Merge(1, coordinator.Watermarks())
+	if reader.CaughtUp(0, token) {
+		t.Errorf("The replica caught up before the coordinator saw the write on it")
+	}
+	if !reader.CaughtUp(1, token) {
+		t.Errorf("The replica that answered the write did not catch up")
+	}
+
+	coordinator.Done(0, at)
+	reader.Merge(1, coordinator.Watermarks())
+	if !reader.CaughtUp(0, token) {
+		t.Errorf("The replica did not catch up after the gossip")
+	}
+
+	// an older gossip arriving late does not move the watermarks back
+	reader.Merge(1, session.Watermarks{0: 1})
+	if !reader.CaughtUp(0, token) {
+		t.Errorf("A late gossip moved the watermark back")
+	}
+}
+
+func TestTrackerWait(t *testing.T) {
+	tracker := session.NewTracker(0, 2, func(int) (uint64, bool) { return 0, false })
+
+	if shards, err := tracker.Wait(context.Background(), []int{1, 0}, nil); err != nil || !slices.Equal(shards, []int{1, 0}) {
+		t.Errorf("Wait without a token = %v, %v, want all the shards", shards, err)
+	}
+
+	at := tracker.Begin([]int{0, 1})
+	tracker.Done(0, at)
+	token := tracker.Token(nil, at)
+
+	shards, err := tracker.Wait(context.Background(), []int{1, 0}, token)
+	if err != nil || !slices.Equal(shards, []int{0}) {
+		t.Errorf("Wait = %v, %v, want only the replica that caught up", shards, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := tracker.Wait(ctx, []int{1}, token); !errors.Is(err, session.ErrBehind) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait for a replica that did not catch up = %v, want ErrBehind past the deadline", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.Done(1, at)
+	}()
+	if shards, err := tracker.Wait(context.Background(), []int{1}, token); err != nil || !slices.Equal(shards, []int{1}) {
+		t.Errorf("Wait = %v, %v, want the replica once it caught up", shards, err)
+	}
+}
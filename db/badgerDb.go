@@ -1,56 +1,273 @@
 package db
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"github.com/dgraph-io/badger/v4"
-	"log"
+	"github.com/dgraph-io/badger/v4/options"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// namespaceMarker starts the keys of the namespaces other than the default one, so keys of the
+// default namespace must not start with it. checkKey refuses them.
+const namespaceMarker = 0
+
+// checkKey returns ErrReservedKey for a key of the default namespace, the one without a prefix, starting with
+// namespaceMarker, which would reach the keys of another namespace.
+func checkKey(prefix []byte, key string) error {
+	if len(prefix) == 0 && len(key) > 0 && key[0] == namespaceMarker {
+		return ErrReservedKey
+	}
+	return nil
+}
+
+// BadgerDatabase is a badger database. The keys of a namespace are stored under its prefix.
 type BadgerDatabase struct {
-	db *badger.DB
+	db     *badger.DB
+	prefix []byte
+	ttl    time.Duration
+	// gcRuns counts the value log garbage collections that rewrote a file
+	gcRuns *atomic.Int64
+}
+
+func init() {
+	Register("lsm", func(path string, options Options) (Database, func() error, error) {
+		opts, err := badgerOptions(options)
+		if err != nil {
+			return nil, nil, err
+		}
+		slog.Info("Opening the lsm store", "path", path, "options", opts)
+		return NewBadgerDatabase(path, opts)
+	})
+}
+
+// BadgerOptions configure a badger store.
+type BadgerOptions struct {
+	// MemTableSize is the size in bytes of a memtable.
+	MemTableSize int64
+	// ValueThreshold is the size in bytes past which a value goes to the value log instead of the LSM tree.
+	ValueThreshold int64
+	// SyncWrites syncs every write to disk.
+	SyncWrites bool
+	// Compression is the compression of the tables: none, snappy or zstd.
+	Compression string
+	// CacheSize is the size in bytes of the block cache, needed by a compression.
+	CacheSize int64
+	// GCInterval is how often the value log is garbage collected, and never when 0.
+	GCInterval time.Duration
+	// GCRatio is the part of a value log file that must be garbage for the collection to rewrite it.
+	GCRatio float64
+}
+
+// DefaultBadgerOptions returns the options of a store configured with none.
+func DefaultBadgerOptions() BadgerOptions {
+	defaults := badger.DefaultOptions("")
+	return BadgerOptions{
+		MemTableSize:   defaults.MemTableSize,
+		ValueThreshold: defaults.ValueThreshold,
+		SyncWrites:     defaults.SyncWrites,
+		Compression:    "snappy",
+		CacheSize:      defaults.BlockCacheSize,
+		GCInterval:     5 * time.Minute,
+		GCRatio:        0.7,
+	}
+}
+
+var badgerCompressions = map[string]options.CompressionType{
+	"none":   options.None,
+	"snappy": options.Snappy,
+	"zstd":   options.ZSTD,
+}
+
+// badgerOptions reads the options of the lsm table of the config over the defaults.
+func badgerOptions(options Options) (BadgerOptions, error) {
+	if err := options.Check("memtable_size", "value_threshold", "sync_writes", "compression", "cache_size", "gc_interval", "gc_ratio"); err != nil {
+		return BadgerOptions{}, err
+	}
+
+	defaults := DefaultBadgerOptions()
+	var opts BadgerOptions
+	var err error
+	if opts.MemTableSize, err = options.Int("memtable_size", defaults.MemTableSize); err != nil {
+		return BadgerOptions{}, err
+	}
+	if opts.ValueThreshold, err = options.Int("value_threshold", defaults.ValueThreshold); err != nil {
+		return BadgerOptions{}, err
+	}
+	if opts.SyncWrites, err = options.Bool("sync_writes", defaults.SyncWrites); err != nil {
+		return BadgerOptions{}, err
+	}
+	if opts.CacheSize, err = options.Int("cache_size", defaults.CacheSize); err != nil {
+		return BadgerOptions{}, err
+	}
+	if opts.GCInterval, err = options.Duration("gc_interval", defaults.GCInterval); err != nil {
+		return BadgerOptions{}, err
+	}
+	if opts.GCRatio, err = options.Float("gc_ratio", defaults.GCRatio); err != nil {
+		return BadgerOptions{}, err
+	}
+	opts.Compression = defaults.Compression
+	if value, ok := options["compression"]; ok {
+		if opts.Compression, ok = value.(string); !ok {
+			return BadgerOptions{}, fmt.Errorf("option %q must be none, snappy or zstd, got %v", "compression", value)
+		}
+	}
+
+	return opts, opts.validate()
+}
+
+func (o BadgerOptions) validate() error {
+	switch {
+	case o.MemTableSize <= 0:
+		return fmt.Errorf("memtable_size must be positive, got %d", o.MemTableSize)
+	case o.ValueThreshold < 0 || o.ValueThreshold > 1<<20:
+		return fmt.Errorf("value_threshold must be between 0 and 1048576, got %d", o.ValueThreshold)
+	case o.CacheSize < 0:
+		return fmt.Errorf("cache_size must not be negative, got %d", o.CacheSize)
+	case o.GCRatio <= 0 || o.GCRatio >= 1:
+		return fmt.Errorf("gc_ratio must be between 0 and 1, got %v", o.GCRatio)
+	}
+
+	compression, ok := badgerCompressions[o.Compression]
+	if !ok {
+		return fmt.Errorf("compression must be none, snappy or zstd, got %q", o.Compression)
+	}
+	// badger panics when opening a compressed store without a cache
+	if compression != options.None && o.CacheSize == 0 {
+		return fmt.Errorf("cache_size must be positive with the %s compression", o.Compression)
+	}
+	return nil
+}
+
+// LogValue reports the options like they are written in the config.
+func (o BadgerOptions) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("memtable_size", o.MemTableSize),
+		slog.Int64("value_threshold", o.ValueThreshold),
+		slog.Bool("sync_writes", o.SyncWrites),
+		slog.String("compression", o.Compression),
+		slog.Int64("cache_size", o.CacheSize),
+		slog.Duration("gc_interval", o.GCInterval),
+		slog.Float64("gc_ratio", o.GCRatio),
+	)
 }
 
-func NewBadgerDatabase(dbPath string) (db *BadgerDatabase, closeFunc func() error, err error) {
-	badgerDb, err := badger.Open(badger.DefaultOptions(dbPath))
+// NewBadgerDatabase opens the badger store in the directory, and garbage collects its value log every GCInterval
+// until closed.
+func NewBadgerDatabase(dbPath string, options BadgerOptions) (db *BadgerDatabase, closeFunc func() error, err error) {
+	if err := options.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	opts := badger.DefaultOptions(dbPath).
+		WithMemTableSize(options.MemTableSize).
+		WithValueThreshold(options.ValueThreshold).
+		WithSyncWrites(options.SyncWrites).
+		WithCompression(badgerCompressions[options.Compression]).
+		WithBlockCacheSize(options.CacheSize)
+	badgerDb, err := badger.Open(opts)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 
 	db = &BadgerDatabase{
-		db: badgerDb,
+		db:     badgerDb,
+		gcRuns: &atomic.Int64{},
+	}
+
+	stop := make(chan struct{})
+	var once sync.Once
+	closeFunc = func() error {
+		once.Do(func() { close(stop) })
+		return badgerDb.Close()
 	}
-	closeFunc = badgerDb.Close
 
 	// garbage collection once in a while
-	go func() {
-		ticker := time.NewTicker(5 * time.Minute)
-		defer ticker.Stop()
-
-		for range ticker.C {
-		again:
-			err := badgerDb.RunValueLogGC(0.7)
-			if err == nil {
-				goto again
+	if options.GCInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(options.GCInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+				case <-stop:
+					return
+				}
+				for badgerDb.RunValueLogGC(options.GCRatio) == nil {
+					db.gcRuns.Add(1)
+				}
 			}
-		}
-	}()
+		}()
+	}
 
 	return
 }
 
+// Namespace returns the database of the keys under the prefix of the namespace. Badger drops the expired keys itself.
+func (d *BadgerDatabase) Namespace(name string, ttl time.Duration) (Database, error) {
+	ns := &BadgerDatabase{db: d.db, ttl: ttl, gcRuns: d.gcRuns}
+	if name != "" && name != DefaultNamespace {
+		ns.prefix = append([]byte{namespaceMarker}, name...)
+		ns.prefix = append(ns.prefix, namespaceMarker)
+	}
+
+	return ns, nil
+}
+
+// DiskSize returns the size of the LSM tree and the value log of the whole store.
+func (d *BadgerDatabase) DiskSize() (int64, error) {
+	lsm, vlog := d.db.Size()
+	return lsm + vlog, nil
+}
+
+// GCRuns returns the number of value log garbage collections that reclaimed space.
+func (d *BadgerDatabase) GCRuns() int64 {
+	return d.gcRuns.Load()
+}
+
+func (d *BadgerDatabase) key(key string) []byte {
+	return append(append([]byte{}, d.prefix...), key...)
+}
+
+// owns reports whether a stored key belongs to the namespace of the database.
+func (d *BadgerDatabase) owns(key []byte) bool {
+	if len(d.prefix) == 0 {
+		return len(key) == 0 || key[0] != namespaceMarker
+	}
+	return bytes.HasPrefix(key, d.prefix)
+}
+
+func (d *BadgerDatabase) entry(key string, value []byte) *badger.Entry {
+	e := badger.NewEntry(d.key(key), value)
+	if d.ttl > 0 {
+		e = e.WithTTL(d.ttl)
+	}
+	return e
+}
+
 func (d *BadgerDatabase) SetKey(key string, value []byte) error {
+	if err := checkKey(d.prefix, key); err != nil {
+		return err
+	}
 	return d.db.Update(func(txn *badger.Txn) error {
-		err := txn.Set([]byte(key), value)
+		err := txn.SetEntry(d.entry(key, value))
 		return err
 	})
 }
 
 func (d *BadgerDatabase) GetKey(key string) ([]byte, error) {
+	if err := checkKey(d.prefix, key); err != nil {
+		return nil, err
+	}
 	var result []byte
 
 	err := d.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(key))
+		item, err := txn.Get(d.key(key))
 
 		if errors.Is(err, badger.ErrKeyNotFound) {
 			return nil
@@ -66,23 +283,90 @@ func (d *BadgerDatabase) GetKey(key string) ([]byte, error) {
 	return result, err
 }
 
+func (d *BadgerDatabase) DeleteKey(key string) error {
+	if err := checkKey(d.prefix, key); err != nil {
+		return err
+	}
+	return d.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(d.key(key))
+	})
+}
+
+// each calls fn with the keys of the namespace starting with prefix, without the namespace prefix, until fn returns false.
+func (d *BadgerDatabase) each(txn *badger.Txn, prefix string, prefetch bool, fn func(key string, item *badger.Item) (bool, error)) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = prefetch
+	opts.Prefix = d.key(prefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if !d.owns(item.Key()) {
+			continue
+		}
+
+		more, err := fn(string(item.Key()[len(d.prefix):]), item)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *BadgerDatabase) Scan(prefix string, limit int) ([]KeyValue, error) {
+	var result []KeyValue
+
+	err := d.db.View(func(txn *badger.Txn) error {
+		return d.each(txn, prefix, true, func(key string, item *badger.Item) (bool, error) {
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return false, err
+			}
+			result = append(result, KeyValue{Key: key, Value: value})
+			return limit <= 0 || len(result) < limit, nil
+		})
+	})
+
+	return result, err
+}
+
+func (d *BadgerDatabase) KeyCount() (int, error) {
+	var count int
+
+	err := d.db.View(func(txn *badger.Txn) error {
+		return d.each(txn, "", false, func(string, *badger.Item) (bool, error) {
+			count++
+			return true, nil
+		})
+	})
+
+	return count, err
+}
+
+func (d *BadgerDatabase) Size() (int64, error) {
+	var size int64
+
+	err := d.db.View(func(txn *badger.Txn) error {
+		return d.each(txn, "", false, func(key string, item *badger.Item) (bool, error) {
+			size += int64(len(key)) + item.ValueSize()
+			return true, nil
+		})
+	})
+
+	return size, err
+}
+
 func (d *BadgerDatabase) DeleteExtraKeys(isExtra func(string) bool) error {
 	var keys []string
 
 	err := d.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchValues = false
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			key := string(item.Key())
+		return d.each(txn, "", false, func(key string, _ *badger.Item) (bool, error) {
 			if isExtra(key) {
 				keys = append(keys, key)
 			}
-		}
-		return nil
+			return true, nil
+		})
 	})
 	if err != nil {
 		return err
@@ -90,11 +374,11 @@ func (d *BadgerDatabase) DeleteExtraKeys(isExtra func(string) bool) error {
 
 	return d.db.Update(func(txn *badger.Txn) error {
 		for _, k := range keys {
-			if err = txn.Delete([]byte(k)); err != nil {
+			if err = txn.Delete(d.key(k)); err != nil {
 				if errors.Is(badger.ErrTxnTooBig, err) {
 					_ = txn.Commit()
 					txn = d.db.NewTransaction(true)
-					_ = txn.Delete([]byte(k))
+					_ = txn.Delete(d.key(k))
 					continue
 				}
 				return err
@@ -104,12 +388,24 @@ func (d *BadgerDatabase) DeleteExtraKeys(isExtra func(string) bool) error {
 	})
 }
 
+// WriteInBatch applies the commands to the namespace of the database, whatever namespace they name.
 func (d *BadgerDatabase) WriteInBatch(setCommands []SetCommand) error {
+	for _, command := range setCommands {
+		if err := checkKey(d.prefix, command.Key); err != nil {
+			return err
+		}
+	}
+
 	wb := d.db.NewWriteBatch()
 	defer wb.Cancel()
 
 	for _, command := range setCommands {
-		err := wb.Set([]byte(command.Key), []byte(command.Value))
+		var err error
+		if command.Delete {
+			err = wb.Delete(d.key(command.Key))
+		} else {
+			err = wb.SetEntry(d.entry(command.Key, []byte(command.Value)))
+		}
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,836 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A bitcask store is a directory of append-only segments, numbered from 1, and an in-memory index mapping every
+// key to its last record. A record is:
+//
+//	crc uint32 | kind byte | expires int64 | key length uint32 | value length uint32 | key | value
+//
+// The CRC covers the rest of the record, and expires is the unix nano time the value expires at, 0 when it does not.
+// A delete appends a tombstone record. The writes go to the last segment, the active one, until it is full.
+// A merge rewrites the live records of the other segments, dropping the overwritten, deleted and expired ones,
+// and writes a hint file next to every segment it writes: the index entries of its records, so that a restart
+// loads them without reading the values.
+const (
+	bitcaskHeaderSize = 21
+	bitcaskHintSize   = 28
+
+	bitcaskSet    = 1
+	bitcaskDelete = 2
+
+	defaultMaxSegmentSize = 64 << 20
+	defaultMergeInterval  = 10 * time.Minute
+	defaultMergeRatio     = 0.5
+)
+
+// ErrCorrupted is returned for a record failing its CRC check.
+var ErrCorrupted = errors.New("corrupted record")
+
+var errBitcaskClosed = errors.New("the bitcask store is closed")
+
+func init() {
+	Register("bitcask", func(path string, options Options) (Database, func() error, error) {
+		if err := options.Check("max_segment_size", "merge_interval", "merge_ratio", "sync_writes"); err != nil {
+			return nil, nil, err
+		}
+
+		var opts BitcaskOptions
+		var err error
+		if opts.MaxSegmentSize, err = options.Int("max_segment_size", defaultMaxSegmentSize); err != nil {
+			return nil, nil, err
+		}
+		if opts.MergeInterval, err = options.Duration("merge_interval", defaultMergeInterval); err != nil {
+			return nil, nil, err
+		}
+		if opts.MergeRatio, err = options.Float("merge_ratio", defaultMergeRatio); err != nil {
+			return nil, nil, err
+		}
+		if opts.SyncWrites, err = options.Bool("sync_writes", false); err != nil {
+			return nil, nil, err
+		}
+		if opts.MaxSegmentSize <= 0 || opts.MergeRatio <= 0 || opts.MergeRatio > 1 {
+			return nil, nil, fmt.Errorf("max_segment_size must be positive and merge_ratio between 0 and 1")
+		}
+		slog.Info("Opening the bitcask store", "path", path, "options", opts)
+		return NewBitcaskDatabase(path, opts)
+	})
+}
+
+// BitcaskOptions configure a bitcask store.
+type BitcaskOptions struct {
+	// MaxSegmentSize is the size in bytes past which the writes go to a new segment.
+	MaxSegmentSize int64
+	// MergeInterval is how often the store checks whether to merge, and never when 0.
+	MergeInterval time.Duration
+	// MergeRatio is the part of the bytes of the full segments held by dead records that starts a merge.
+	MergeRatio float64
+	// SyncWrites syncs the active segment to disk after every write.
+	SyncWrites bool
+}
+
+// LogValue reports the options like they are written in the config.
+func (o BitcaskOptions) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("max_segment_size", o.MaxSegmentSize),
+		slog.Duration("merge_interval", o.MergeInterval),
+		slog.Float64("merge_ratio", o.MergeRatio),
+		slog.Bool("sync_writes", o.SyncWrites),
+	)
+}
+
+// bitcaskEntry locates the last record of a key.
+type bitcaskEntry struct {
+	segment   uint32
+	offset    int64
+	keySize   uint32
+	valueSize uint32
+	expires   int64
+}
+
+func (e bitcaskEntry) size() int64 {
+	return bitcaskHeaderSize + int64(e.keySize) + int64(e.valueSize)
+}
+
+func (e bitcaskEntry) expired(now int64) bool {
+	return e.expires != 0 && e.expires <= now
+}
+
+// bitcaskStore is the directory and the index shared by the namespaces of a bitcask database.
+type bitcaskStore struct {
+	mu       sync.RWMutex
+	dir      string
+	options  BitcaskOptions
+	index    map[string]bitcaskEntry
+	segments map[uint32]*os.File
+	active   uint32
+	// activeSize is the size of the active segment, where the next record goes
+	activeSize int64
+	// mergeMu runs one merge at a time, and merges counts the merges that rewrote segments
+	mergeMu sync.Mutex
+	merges  atomic.Int64
+	stop    chan struct{}
+}
+
+// BitcaskDatabase is a bitcask store. The keys of a namespace are stored under its prefix, like in Badger.
+type BitcaskDatabase struct {
+	store  *bitcaskStore
+	prefix []byte
+	ttl    time.Duration
+}
+
+// NewBitcaskDatabase opens the bitcask store in the directory, creating it if needed, and merges it in the background
+// every MergeInterval until closed.
+func NewBitcaskDatabase(dir string, options BitcaskOptions) (db *BitcaskDatabase, closeFunc func() error, err error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+
+	store := &bitcaskStore{
+		dir:      dir,
+		options:  options,
+		index:    make(map[string]bitcaskEntry),
+		segments: make(map[uint32]*os.File),
+		stop:     make(chan struct{}),
+	}
+	if err := store.load(); err != nil {
+		store.close()
+		return nil, nil, err
+	}
+
+	if options.MergeInterval > 0 {
+		go store.mergeEvery(options.MergeInterval)
+	}
+
+	var once sync.Once
+	closeFunc = func() error {
+		var err error
+		once.Do(func() {
+			close(store.stop)
+			store.mergeMu.Lock()
+			defer store.mergeMu.Unlock()
+			err = store.close()
+		})
+		return err
+	}
+	return &BitcaskDatabase{store: store}, closeFunc, nil
+}
+
+func (s *bitcaskStore) path(id uint32, ext string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%09d%s", id, ext))
+}
+
+// load rebuilds the index from the segments, from the hint files where the merges wrote them.
+func (s *bitcaskStore) load() error {
+	names, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	var ids []uint32
+	for _, entry := range names {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".merge") {
+			// left by a merge that did not finish
+			if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if id, err := strconv.ParseUint(strings.TrimSuffix(name, ".data"), 10, 32); err == nil && strings.HasSuffix(name, ".data") {
+			ids = append(ids, uint32(id))
+		}
+	}
+	slices.Sort(ids)
+
+	for i, id := range ids {
+		file, err := os.OpenFile(s.path(id, ".data"), os.O_RDWR, 0600)
+		if err != nil {
+			return err
+		}
+		s.segments[id] = file
+
+		last := i == len(ids)-1
+		if loaded, err := s.loadHints(id); err != nil || !loaded {
+			if err != nil {
+				slog.Warn("Reading the segment instead of its hint file", "segment", id, "error", err)
+			}
+			if err := s.scan(id, file, last); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return s.rotate()
+	}
+	s.active = ids[len(ids)-1]
+	info, err := s.segments[s.active].Stat()
+	if err != nil {
+		return err
+	}
+	s.activeSize = info.Size()
+	return nil
+}
+
+// loadHints adds the entries of the hint file of the segment to the index, and returns false when there is none.
+func (s *bitcaskStore) loadHints(id uint32) (bool, error) {
+	hints, err := os.ReadFile(s.path(id, ".hint"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	entries := make(map[string]bitcaskEntry)
+	for len(hints) > 0 {
+		if len(hints) < bitcaskHintSize {
+			return false, ErrCorrupted
+		}
+		keySize := binary.BigEndian.Uint32(hints[24:28])
+		if uint64(len(hints)) < bitcaskHintSize+uint64(keySize) {
+			return false, ErrCorrupted
+		}
+		hint := hints[:bitcaskHintSize+keySize]
+		if crc32.ChecksumIEEE(hint[4:]) != binary.BigEndian.Uint32(hint) {
+			return false, ErrCorrupted
+		}
+
+		entries[string(hint[bitcaskHintSize:])] = bitcaskEntry{
+			segment:   id,
+			expires:   int64(binary.BigEndian.Uint64(hint[4:12])),
+			offset:    int64(binary.BigEndian.Uint64(hint[12:20])),
+			valueSize: binary.BigEndian.Uint32(hint[20:24]),
+			keySize:   keySize,
+		}
+		hints = hints[len(hint):]
+	}
+
+	for key, entry := range entries {
+		s.index[key] = entry
+	}
+	return true, nil
+}
+
+// scan adds the records of the segment to the index. A torn record at the end of the last segment, the one written
+// when the node stopped, is cut off.
+func (s *bitcaskStore) scan(id uint32, file *os.File, last bool) error {
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<62))
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for offset < int64(len(data)) {
+		kind, key, _, expires, size, err := decodeRecord(data[offset:])
+		if err != nil {
+			if !last {
+				return fmt.Errorf("segment %d at offset %d: %w", id, offset, err)
+			}
+			slog.Warn("Cut off a torn record at the end of the last segment", "segment", id, "offset", offset, "error", err)
+			return file.Truncate(offset)
+		}
+
+		if kind == bitcaskDelete {
+			delete(s.index, string(key))
+		} else {
+			s.index[string(key)] = bitcaskEntry{
+				segment:   id,
+				offset:    offset,
+				keySize:   uint32(len(key)),
+				valueSize: uint32(size - bitcaskHeaderSize - int64(len(key))),
+				expires:   expires,
+			}
+		}
+		offset += size
+	}
+	return nil
+}
+
+// encodeRecord appends a record to buf.
+func encodeRecord(buf []byte, kind byte, key, value []byte, expires int64) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0, kind)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(expires))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(key)))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+	buf = append(append(buf, key...), value...)
+	binary.BigEndian.PutUint32(buf[start:], crc32.ChecksumIEEE(buf[start+4:]))
+	return buf
+}
+
+// decodeRecord reads the record starting data, and returns its size.
+func decodeRecord(data []byte) (kind byte, key, value []byte, expires int64, size int64, err error) {
+	if len(data) < bitcaskHeaderSize {
+		return 0, nil, nil, 0, 0, ErrCorrupted
+	}
+	keySize := int64(binary.BigEndian.Uint32(data[13:17]))
+	valueSize := int64(binary.BigEndian.Uint32(data[17:21]))
+	size = bitcaskHeaderSize + keySize + valueSize
+	if int64(len(data)) < size {
+		return 0, nil, nil, 0, 0, ErrCorrupted
+	}
+
+	record := data[:size]
+	if crc32.ChecksumIEEE(record[4:]) != binary.BigEndian.Uint32(record) {
+		return 0, nil, nil, 0, 0, ErrCorrupted
+	}
+	kind = record[4]
+	if kind != bitcaskSet && kind != bitcaskDelete {
+		return 0, nil, nil, 0, 0, ErrCorrupted
+	}
+	expires = int64(binary.BigEndian.Uint64(record[5:13]))
+	return kind, record[bitcaskHeaderSize : bitcaskHeaderSize+keySize], record[bitcaskHeaderSize+keySize:], expires, size, nil
+}
+
+// rotate starts a new active segment. The caller holds the write lock.
+func (s *bitcaskStore) rotate() error {
+	id := s.active + 1
+	for existing := range s.segments {
+		id = max(id, existing+1)
+	}
+
+	file, err := os.OpenFile(s.path(id, ".data"), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	s.segments[id] = file
+	s.active = id
+	s.activeSize = 0
+	return nil
+}
+
+// append writes the records to the active segment, starting a new one when it is full, and indexes them.
+// The caller holds the write lock.
+func (s *bitcaskStore) append(records []byte) error {
+	if s.activeSize > 0 && s.activeSize+int64(len(records)) > s.options.MaxSegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	file, ok := s.segments[s.active]
+	if !ok {
+		return errBitcaskClosed
+	}
+	if _, err := file.WriteAt(records, s.activeSize); err != nil {
+		return err
+	}
+	if s.options.SyncWrites {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	for len(records) > 0 {
+		kind, key, value, expires, size, _ := decodeRecord(records)
+		if kind == bitcaskDelete {
+			delete(s.index, string(key))
+		} else {
+			s.index[string(key)] = bitcaskEntry{
+				segment:   s.active,
+				offset:    s.activeSize,
+				keySize:   uint32(len(key)),
+				valueSize: uint32(len(value)),
+				expires:   expires,
+			}
+		}
+		s.activeSize += size
+		records = records[size:]
+	}
+	return nil
+}
+
+// read returns the value of the record of the entry, checking its CRC. The caller holds a lock.
+func (s *bitcaskStore) read(entry bitcaskEntry) ([]byte, error) {
+	file, ok := s.segments[entry.segment]
+	if !ok {
+		return nil, errBitcaskClosed
+	}
+	record := make([]byte, entry.size())
+	if _, err := file.ReadAt(record, entry.offset); err != nil {
+		return nil, err
+	}
+
+	_, _, value, _, _, err := decodeRecord(record)
+	if err != nil {
+		return nil, fmt.Errorf("segment %d at offset %d: %w", entry.segment, entry.offset, err)
+	}
+	return value, nil
+}
+
+func (s *bitcaskStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for id, file := range s.segments {
+		if id == s.active && s.options.SyncWrites {
+			errs = append(errs, file.Sync())
+		}
+		errs = append(errs, file.Close())
+	}
+	s.segments = map[uint32]*os.File{}
+	return errors.Join(errs...)
+}
+
+func (s *bitcaskStore) mergeEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.deadRatio() < s.options.MergeRatio {
+				continue
+			}
+			if err := s.merge(); err != nil {
+				slog.Error("Could not merge the bitcask segments", "error", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// deadRatio returns the part of the bytes of the full segments that the index does not point to.
+func (s *bitcaskStore) deadRatio() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total, live int64
+	for id, file := range s.segments {
+		if id == s.active {
+			continue
+		}
+		if info, err := file.Stat(); err == nil {
+			total += info.Size()
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	now := time.Now().UnixNano()
+	for _, entry := range s.index {
+		if entry.segment != s.active && !entry.expired(now) {
+			live += entry.size()
+		}
+	}
+	return float64(total-live) / float64(total)
+}
+
+// merged is a record moved by a merge.
+type merged struct {
+	key      string
+	from, to bitcaskEntry
+}
+
+// merge rewrites the live records of the full segments into as few segments as they fill, taking the numbers of
+// the first segments merged, and removes the others. The writes go on to the active segment meanwhile.
+func (s *bitcaskStore) merge() error {
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+
+	s.mu.Lock()
+	if s.activeSize > 0 {
+		if err := s.rotate(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	var inputs []uint32
+	for id := range s.segments {
+		if id != s.active {
+			inputs = append(inputs, id)
+		}
+	}
+	slices.Sort(inputs)
+
+	now := time.Now().UnixNano()
+	var moves []merged
+	for key, entry := range s.index {
+		if entry.segment != s.active && !entry.expired(now) {
+			moves = append(moves, merged{key: key, from: entry})
+		}
+	}
+	s.mu.Unlock()
+
+	if len(inputs) == 0 {
+		return nil
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		if moves[i].from.segment != moves[j].from.segment {
+			return moves[i].from.segment < moves[j].from.segment
+		}
+		return moves[i].from.offset < moves[j].from.offset
+	})
+
+	outputs, err := s.writeMerged(inputs, moves)
+	if err != nil {
+		for _, id := range inputs {
+			os.Remove(s.path(id, ".data.merge"))
+			os.Remove(s.path(id, ".hint.merge"))
+		}
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// in the order of the segments, so that a crash leaves no stale record after the live one of its key
+	for _, id := range inputs {
+		s.segments[id].Close()
+		delete(s.segments, id)
+		if err := os.Remove(s.path(id, ".hint")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if id >= outputs {
+			if err := os.Remove(s.path(id, ".data")); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.Rename(s.path(id, ".data.merge"), s.path(id, ".data")); err != nil {
+			return err
+		}
+		if err := os.Rename(s.path(id, ".hint.merge"), s.path(id, ".hint")); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(s.path(id, ".data"), os.O_RDWR, 0600)
+		if err != nil {
+			return err
+		}
+		s.segments[id] = file
+	}
+
+	for _, move := range moves {
+		if s.index[move.key] == move.from {
+			s.index[move.key] = move.to
+		}
+	}
+	s.merges.Add(1)
+	return nil
+}
+
+// writeMerged copies the records to merge files named after the inputs, and returns the first input number it did
+// not use.
+func (s *bitcaskStore) writeMerged(inputs []uint32, moves []merged) (uint32, error) {
+	var data, hints *os.File
+	var size int64
+	next := 0
+
+	finish := func() error {
+		if data == nil {
+			return nil
+		}
+		errs := errors.Join(data.Sync(), hints.Sync(), data.Close(), hints.Close())
+		data, hints = nil, nil
+		return errs
+	}
+
+	for i := range moves {
+		move := &moves[i]
+		// a merged segment takes the number of an input, so the records that do not fit the last one go in it anyway
+		full := size > 0 && size+move.from.size() > s.options.MaxSegmentSize && next < len(inputs)
+		if data == nil || full {
+			if err := finish(); err != nil {
+				return 0, err
+			}
+			id := inputs[next]
+			next++
+
+			var err error
+			if data, err = os.Create(s.path(id, ".data.merge")); err != nil {
+				return 0, err
+			}
+			if hints, err = os.Create(s.path(id, ".hint.merge")); err != nil {
+				data.Close()
+				return 0, err
+			}
+			size = 0
+		}
+
+		s.mu.RLock()
+		value, err := s.read(move.from)
+		s.mu.RUnlock()
+		if err != nil {
+			finish()
+			return 0, err
+		}
+
+		record := encodeRecord(nil, bitcaskSet, []byte(move.key), value, move.from.expires)
+		if _, err := data.Write(record); err != nil {
+			finish()
+			return 0, err
+		}
+
+		move.to = move.from
+		move.to.segment = inputs[next-1]
+		move.to.offset = size
+		size += int64(len(record))
+
+		hint := make([]byte, bitcaskHintSize, bitcaskHintSize+len(move.key))
+		binary.BigEndian.PutUint64(hint[4:12], uint64(move.to.expires))
+		binary.BigEndian.PutUint64(hint[12:20], uint64(move.to.offset))
+		binary.BigEndian.PutUint32(hint[20:24], move.to.valueSize)
+		binary.BigEndian.PutUint32(hint[24:28], move.to.keySize)
+		hint = append(hint, move.key...)
+		binary.BigEndian.PutUint32(hint, crc32.ChecksumIEEE(hint[4:]))
+		if _, err := hints.Write(hint); err != nil {
+			finish()
+			return 0, err
+		}
+	}
+
+	if err := finish(); err != nil {
+		return 0, err
+	}
+	if next == 0 {
+		return inputs[0], nil
+	}
+	if next == len(inputs) {
+		return inputs[len(inputs)-1] + 1, nil
+	}
+	return inputs[next], nil
+}
+
+// Namespace returns the database of the keys under the prefix of the namespace.
+func (d *BitcaskDatabase) Namespace(name string, ttl time.Duration) (Database, error) {
+	ns := &BitcaskDatabase{store: d.store, ttl: ttl}
+	if name != "" && name != DefaultNamespace {
+		ns.prefix = append([]byte{namespaceMarker}, name...)
+		ns.prefix = append(ns.prefix, namespaceMarker)
+	}
+
+	return ns, nil
+}
+
+// Merge rewrites the full segments without their dead records.
+func (d *BitcaskDatabase) Merge() error {
+	return d.store.merge()
+}
+
+// DiskSize returns the size of the segments and the hint files of the whole store.
+func (d *BitcaskDatabase) DiskSize() (int64, error) {
+	entries, err := os.ReadDir(d.store.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size, nil
+}
+
+// GCRuns returns the number of merges that rewrote segments.
+func (d *BitcaskDatabase) GCRuns() int64 {
+	return d.store.merges.Load()
+}
+
+func (d *BitcaskDatabase) key(key string) []byte {
+	return append(append([]byte{}, d.prefix...), key...)
+}
+
+// owns reports whether a stored key belongs to the namespace of the database.
+func (d *BitcaskDatabase) owns(key string) bool {
+	if len(d.prefix) == 0 {
+		return len(key) == 0 || key[0] != namespaceMarker
+	}
+	return strings.HasPrefix(key, string(d.prefix))
+}
+
+func (d *BitcaskDatabase) record(buf []byte, command SetCommand) []byte {
+	if command.Delete {
+		return encodeRecord(buf, bitcaskDelete, d.key(command.Key), nil, 0)
+	}
+
+	var expires int64
+	if d.ttl > 0 {
+		expires = time.Now().Add(d.ttl).UnixNano()
+	}
+	return encodeRecord(buf, bitcaskSet, d.key(command.Key), command.Value, expires)
+}
+
+func (d *BitcaskDatabase) SetKey(key string, value []byte) error {
+	return d.WriteInBatch([]SetCommand{{Key: key, Value: value}})
+}
+
+func (d *BitcaskDatabase) GetKey(key string) ([]byte, error) {
+	if err := checkKey(d.prefix, key); err != nil {
+		return nil, err
+	}
+
+	d.store.mu.RLock()
+	defer d.store.mu.RUnlock()
+
+	entry, ok := d.store.index[string(d.key(key))]
+	if !ok || entry.expired(time.Now().UnixNano()) {
+		return nil, nil
+	}
+	return d.store.read(entry)
+}
+
+func (d *BitcaskDatabase) DeleteKey(key string) error {
+	return d.WriteInBatch([]SetCommand{{Key: key, Delete: true}})
+}
+
+// each calls fn with the keys of the namespace starting with prefix, without the namespace prefix, in order,
+// until fn returns false. The caller holds a lock.
+func (d *BitcaskDatabase) each(prefix string, fn func(key string, entry bitcaskEntry) (bool, error)) error {
+	full := string(d.key(prefix))
+	now := time.Now().UnixNano()
+
+	var keys []string
+	for key, entry := range d.store.index {
+		if strings.HasPrefix(key, full) && d.owns(key) && !entry.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		more, err := fn(key[len(d.prefix):], d.store.index[key])
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *BitcaskDatabase) Scan(prefix string, limit int) ([]KeyValue, error) {
+	d.store.mu.RLock()
+	defer d.store.mu.RUnlock()
+
+	var result []KeyValue
+	err := d.each(prefix, func(key string, entry bitcaskEntry) (bool, error) {
+		value, err := d.store.read(entry)
+		if err != nil {
+			return false, err
+		}
+		result = append(result, KeyValue{Key: key, Value: value})
+		return limit <= 0 || len(result) < limit, nil
+	})
+	return result, err
+}
+
+func (d *BitcaskDatabase) KeyCount() (int, error) {
+	d.store.mu.RLock()
+	defer d.store.mu.RUnlock()
+
+	var count int
+	err := d.each("", func(string, bitcaskEntry) (bool, error) {
+		count++
+		return true, nil
+	})
+	return count, err
+}
+
+func (d *BitcaskDatabase) Size() (int64, error) {
+	d.store.mu.RLock()
+	defer d.store.mu.RUnlock()
+
+	var size int64
+	err := d.each("", func(key string, entry bitcaskEntry) (bool, error) {
+		size += int64(len(key)) + int64(entry.valueSize)
+		return true, nil
+	})
+	return size, err
+}
+
+func (d *BitcaskDatabase) DeleteExtraKeys(isExtra func(string) bool) error {
+	var commands []SetCommand
+
+	d.store.mu.RLock()
+	err := d.each("", func(key string, _ bitcaskEntry) (bool, error) {
+		if isExtra(key) {
+			commands = append(commands, SetCommand{Key: key, Delete: true})
+		}
+		return true, nil
+	})
+	d.store.mu.RUnlock()
+	if err != nil || len(commands) == 0 {
+		return err
+	}
+
+	return d.WriteInBatch(commands)
+}
+
+// WriteInBatch applies the commands to the namespace of the database, whatever namespace they name, appending
+// their records with a single write.
+func (d *BitcaskDatabase) WriteInBatch(setCommands []SetCommand) error {
+	var records []byte
+	for _, command := range setCommands {
+		if err := checkKey(d.prefix, command.Key); err != nil {
+			return err
+		}
+		records = d.record(records, command)
+	}
+
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+	return d.store.append(records)
+}
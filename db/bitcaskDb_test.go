@@ -0,0 +1,163 @@
+package db_test
+
+import (
+	"errors"
+	"github.com/EliriaT/distributed-store/db"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openBitcask(t *testing.T, dir string, options db.BitcaskOptions) (*db.BitcaskDatabase, func() error) {
+	t.Helper()
+
+	d, closeFunc, err := db.NewBitcaskDatabase(dir, options)
+	if err != nil {
+		t.Fatalf("Could not open the bitcask store: %v", err)
+	}
+	return d, closeFunc
+}
+
+func segments(t *testing.T, dir, pattern string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestBitcaskReopen(t *testing.T) {
+	dir := t.TempDir()
+	d, closeFunc := openBitcask(t, dir, db.BitcaskOptions{MaxSegmentSize: 64})
+	cache, _ := d.Namespace("cache", 0)
+
+	setKey(t, d, "utm", "fcim")
+	setKey(t, d, "usm", "math")
+	setKey(t, d, "utm", "changed")
+	setKey(t, cache, "utm", "cached")
+	if err := d.DeleteKey("usm"); err != nil {
+		t.Fatalf("Could not delete the key: %v", err)
+	}
+	if err := closeFunc(); err != nil {
+		t.Fatalf("Could not close the store: %v", err)
+	}
+	if len(segments(t, dir, "*.data")) < 2 {
+		t.Fatalf("The writes should have filled several segments")
+	}
+
+	d, closeFunc = openBitcask(t, dir, db.BitcaskOptions{MaxSegmentSize: 64})
+	defer closeFunc()
+	cache, _ = d.Namespace("cache", 0)
+
+	if got := getKey(t, d, "utm"); got != "changed" {
+		t.Errorf("Unexpected value after reopening: got %q, want %q", got, "changed")
+	}
+	if got := getKey(t, d, "usm"); got != "" {
+		t.Errorf("The deleted key came back after reopening: %q", got)
+	}
+	if got := getKey(t, cache, "utm"); got != "cached" {
+		t.Errorf("Unexpected value in the cache namespace: got %q, want %q", got, "cached")
+	}
+}
+
+func TestBitcaskMerge(t *testing.T) {
+	dir := t.TempDir()
+	d, closeFunc := openBitcask(t, dir, db.BitcaskOptions{MaxSegmentSize: 128})
+
+	for i := 0; i < 20; i++ {
+		setKey(t, d, "utm", string(rune('a'+i)))
+		setKey(t, d, "usm", "math")
+	}
+	setKey(t, d, "asem", "economics")
+	if err := d.DeleteKey("asem"); err != nil {
+		t.Fatalf("Could not delete the key: %v", err)
+	}
+
+	before, _ := d.DiskSize()
+	if err := d.Merge(); err != nil {
+		t.Fatalf("Could not merge: %v", err)
+	}
+	after, _ := d.DiskSize()
+
+	if d.GCRuns() != 1 {
+		t.Errorf("Unexpected merge count: got %d, want %d", d.GCRuns(), 1)
+	}
+	if after >= before {
+		t.Errorf("The merge did not shrink the store: %d bytes before, %d after", before, after)
+	}
+	if len(segments(t, dir, "*.hint")) == 0 {
+		t.Errorf("The merge wrote no hint file")
+	}
+	if got := getKey(t, d, "utm"); got != "t" {
+		t.Errorf("Unexpected value after the merge: got %q, want %q", got, "t")
+	}
+	setKey(t, d, "usm", "physics")
+	if err := closeFunc(); err != nil {
+		t.Fatalf("Could not close the store: %v", err)
+	}
+
+	d, closeFunc = openBitcask(t, dir, db.BitcaskOptions{MaxSegmentSize: 128})
+	defer closeFunc()
+
+	for key, want := range map[string]string{"utm": "t", "usm": "physics", "asem": ""} {
+		if got := getKey(t, d, key); got != want {
+			t.Errorf("Unexpected value of %q after reopening: got %q, want %q", key, got, want)
+		}
+	}
+	if count, _ := d.KeyCount(); count != 2 {
+		t.Errorf("Unexpected key count: got %d, want %d", count, 2)
+	}
+}
+
+func TestBitcaskTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	d, closeFunc := openBitcask(t, dir, db.BitcaskOptions{MaxSegmentSize: 1 << 20})
+	setKey(t, d, "utm", "fcim")
+	closeFunc()
+
+	// a record cut off by a crash
+	files := segments(t, dir, "*.data")
+	file, err := os.OpenFile(files[len(files)-1], os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte{1, 2, 3, 4, 1, 0, 0})
+	file.Close()
+
+	d, closeFunc = openBitcask(t, dir, db.BitcaskOptions{MaxSegmentSize: 1 << 20})
+	setKey(t, d, "usm", "math")
+	closeFunc()
+
+	d, closeFunc = openBitcask(t, dir, db.BitcaskOptions{MaxSegmentSize: 1 << 20})
+	defer closeFunc()
+	if got := getKey(t, d, "utm"); got != "fcim" {
+		t.Errorf("Unexpected value before the torn record: got %q, want %q", got, "fcim")
+	}
+	if got := getKey(t, d, "usm"); got != "math" {
+		t.Errorf("Unexpected value written after the torn record: got %q, want %q", got, "math")
+	}
+}
+
+func TestBitcaskCorruption(t *testing.T) {
+	dir := t.TempDir()
+	d, closeFunc := openBitcask(t, dir, db.BitcaskOptions{MaxSegmentSize: 32})
+	setKey(t, d, "utm", "fcim")
+	setKey(t, d, "usm", "math")
+	closeFunc()
+
+	files := segments(t, dir, "*.data")
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(files[0], data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := db.NewBitcaskDatabase(dir, db.BitcaskOptions{MaxSegmentSize: 32}); !errors.Is(err, db.ErrCorrupted) {
+		t.Errorf("Opening a store with a corrupted segment: got %v, want %v", err, db.ErrCorrupted)
+	}
+}
@@ -1,25 +1,129 @@
 package db
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	bolt "go.etcd.io/bbolt"
+	"log/slog"
+	"math"
+	"time"
 )
 
-var defaultBucket = []byte("default")
+var defaultBucket = []byte(DefaultNamespace)
 
-// BoltDatabase is a bolt database.
+// expiryPrefix starts the names of the buckets holding the expiry times of the keys of a namespace.
+const expiryPrefix = "\x00expiry\x00"
+
+// BoltDatabase is a bolt database. Every namespace is stored in its own bucket.
 type BoltDatabase struct {
-	db *bolt.DB
+	db     *bolt.DB
+	bucket []byte
+	// expiry maps the keys of the bucket to the unix nano time they expire at
+	expiry []byte
+	ttl    time.Duration
+}
+
+func init() {
+	Register("btree", func(path string, options Options) (Database, func() error, error) {
+		opts, err := boltOptions(options)
+		if err != nil {
+			return nil, nil, err
+		}
+		slog.Info("Opening the btree store", "path", path, "options", opts)
+		return NewBoltDatabase(path, opts)
+	})
+}
+
+// BoltOptions configure a bolt store. The zero value holds the defaults of bolt.
+type BoltOptions struct {
+	// NoSync skips the sync to disk after every commit, which loses the last writes on a crash.
+	NoSync bool
+	// FreelistType is the freelist backend, array or hashmap, faster for a large store.
+	FreelistType string
+	// InitialMmapSize is the size in bytes the file is first mapped with, which saves remapping a growing store.
+	InitialMmapSize int64
+	// LockTimeout is how long the open waits for the lock of the file, forever when 0.
+	LockTimeout time.Duration
+	// MaxBatchDelay is how long the batched writes wait for others to commit with.
+	MaxBatchDelay time.Duration
+}
+
+// boltOptions reads the options of the btree table of the config.
+func boltOptions(options Options) (BoltOptions, error) {
+	if err := options.Check("no_sync", "freelist_type", "initial_mmap_size", "lock_timeout", "max_batch_delay"); err != nil {
+		return BoltOptions{}, err
+	}
+
+	opts := BoltOptions{FreelistType: string(bolt.FreelistArrayType)}
+	var err error
+	if opts.NoSync, err = options.Bool("no_sync", false); err != nil {
+		return BoltOptions{}, err
+	}
+	if opts.InitialMmapSize, err = options.Int("initial_mmap_size", 0); err != nil {
+		return BoltOptions{}, err
+	}
+	if opts.LockTimeout, err = options.Duration("lock_timeout", 0); err != nil {
+		return BoltOptions{}, err
+	}
+	if opts.MaxBatchDelay, err = options.Duration("max_batch_delay", bolt.DefaultMaxBatchDelay); err != nil {
+		return BoltOptions{}, err
+	}
+	if value, ok := options["freelist_type"]; ok {
+		if opts.FreelistType, ok = value.(string); !ok {
+			return BoltOptions{}, fmt.Errorf("option %q must be array or hashmap, got %v", "freelist_type", value)
+		}
+	}
+
+	return opts, opts.validate()
+}
+
+func (o BoltOptions) validate() error {
+	switch {
+	case o.FreelistType != "" && o.FreelistType != string(bolt.FreelistArrayType) && o.FreelistType != string(bolt.FreelistMapType):
+		return fmt.Errorf("freelist_type must be array or hashmap, got %q", o.FreelistType)
+	case o.InitialMmapSize < 0 || o.InitialMmapSize > math.MaxInt:
+		return fmt.Errorf("initial_mmap_size must not be negative, got %d", o.InitialMmapSize)
+	}
+	return nil
+}
+
+// LogValue reports the options like they are written in the config.
+func (o BoltOptions) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Bool("no_sync", o.NoSync),
+		slog.String("freelist_type", o.FreelistType),
+		slog.Int64("initial_mmap_size", o.InitialMmapSize),
+		slog.Duration("lock_timeout", o.LockTimeout),
+		slog.Duration("max_batch_delay", o.MaxBatchDelay),
+	)
 }
 
 // NewBoltDatabase returns an instance of a database.
-func NewBoltDatabase(dbPath string) (db *BoltDatabase, closeFunc func() error, err error) {
-	boltDb, err := bolt.Open(dbPath, 0600, nil)
+func NewBoltDatabase(dbPath string, options BoltOptions) (db *BoltDatabase, closeFunc func() error, err error) {
+	if err := options.validate(); err != nil {
+		return nil, nil, err
+	}
+
+	freelist := bolt.FreelistType(options.FreelistType)
+	if freelist == "" {
+		freelist = bolt.FreelistArrayType
+	}
+
+	boltDb, err := bolt.Open(dbPath, 0600, &bolt.Options{
+		NoSync:          options.NoSync,
+		FreelistType:    freelist,
+		InitialMmapSize: int(options.InitialMmapSize),
+		Timeout:         options.LockTimeout,
+	})
 	if err != nil {
 		return nil, nil, err
 	}
+	if options.MaxBatchDelay > 0 {
+		boltDb.MaxBatchDelay = options.MaxBatchDelay
+	}
 
-	db = &BoltDatabase{db: boltDb}
+	db = &BoltDatabase{db: boltDb, bucket: defaultBucket, expiry: []byte(expiryPrefix + DefaultNamespace)}
 	closeFunc = boltDb.Close
 
 	if err := db.createBuckets(); err != nil {
@@ -33,17 +137,72 @@ func NewBoltDatabase(dbPath string) (db *BoltDatabase, closeFunc func() error, e
 
 func (d *BoltDatabase) createBuckets() error {
 	return d.db.Update(func(tx *bolt.Tx) error {
-		if _, err := tx.CreateBucketIfNotExists(defaultBucket); err != nil {
+		if _, err := tx.CreateBucketIfNotExists(d.bucket); err != nil {
 			return err
 		}
+		if d.ttl > 0 {
+			if _, err := tx.CreateBucketIfNotExists(d.expiry); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 }
 
+// Namespace returns the database of the bucket named after the namespace, creating the bucket if needed.
+func (d *BoltDatabase) Namespace(name string, ttl time.Duration) (Database, error) {
+	if name == "" {
+		name = DefaultNamespace
+	}
+
+	ns := &BoltDatabase{db: d.db, bucket: []byte(name), expiry: []byte(expiryPrefix + name), ttl: ttl}
+	if err := ns.createBuckets(); err != nil {
+		return nil, fmt.Errorf("creating bucket %q: %w", name, err)
+	}
+
+	return ns, nil
+}
+
+// put writes the key, recording when it expires if the namespace has a ttl.
+func (d *BoltDatabase) put(tx *bolt.Tx, key, value []byte) error {
+	if err := tx.Bucket(d.bucket).Put(key, value); err != nil {
+		return err
+	}
+
+	expiry := tx.Bucket(d.expiry)
+	if d.ttl > 0 {
+		return expiry.Put(key, binary.BigEndian.AppendUint64(nil, uint64(time.Now().Add(d.ttl).UnixNano())))
+	}
+	if expiry != nil {
+		return expiry.Delete(key)
+	}
+	return nil
+}
+
+func (d *BoltDatabase) delete(tx *bolt.Tx, key []byte) error {
+	if expiry := tx.Bucket(d.expiry); expiry != nil {
+		if err := expiry.Delete(key); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(d.bucket).Delete(key)
+}
+
+// expired reports whether the key outlived the ttl it was written with.
+func (d *BoltDatabase) expired(tx *bolt.Tx, key []byte, now time.Time) bool {
+	expiry := tx.Bucket(d.expiry)
+	if expiry == nil {
+		return false
+	}
+
+	at := expiry.Get(key)
+	return len(at) == 8 && now.UnixNano() >= int64(binary.BigEndian.Uint64(at))
+}
+
 // SetKey sets the key to the requested value into the default database or returns an error.
 func (d *BoltDatabase) SetKey(key string, value []byte) error {
 	return d.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket(defaultBucket).Put([]byte(key), value)
+		return d.put(tx, []byte(key), value)
 	})
 }
 
@@ -51,7 +210,11 @@ func (d *BoltDatabase) SetKey(key string, value []byte) error {
 func (d *BoltDatabase) GetKey(key string) ([]byte, error) {
 	var result []byte
 	err := d.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(defaultBucket)
+		if d.expired(tx, []byte(key), time.Now()) {
+			return nil
+		}
+
+		b := tx.Bucket(d.bucket)
 		result = copyByteSlice(b.Get([]byte(key)))
 		return nil
 	})
@@ -62,6 +225,77 @@ func (d *BoltDatabase) GetKey(key string) ([]byte, error) {
 	return nil, err
 }
 
+// DeleteKey removes the key from the default database. Deleting a missing key is not an error.
+func (d *BoltDatabase) DeleteKey(key string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return d.delete(tx, []byte(key))
+	})
+}
+
+// Scan returns up to limit keys starting with prefix, in key order. A limit of 0 returns all of them.
+func (d *BoltDatabase) Scan(prefix string, limit int) ([]KeyValue, error) {
+	var result []KeyValue
+	err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(d.bucket).Cursor()
+		p := []byte(prefix)
+		now := time.Now()
+
+		for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+			if d.expired(tx, k, now) {
+				continue
+			}
+
+			result = append(result, KeyValue{Key: string(k), Value: copyByteSlice(v)})
+			if limit > 0 && len(result) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// KeyCount returns the number of keys in the bucket, counting the expired keys that were not purged yet.
+func (d *BoltDatabase) KeyCount() (int, error) {
+	var count int
+	err := d.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(d.bucket).Stats().KeyN
+		return nil
+	})
+
+	return count, err
+}
+
+// Size returns the total length of the keys and values in the bucket, counting the expired keys that were not purged yet.
+func (d *BoltDatabase) Size() (int64, error) {
+	var size int64
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(d.bucket).ForEach(func(k, v []byte) error {
+			size += int64(len(k) + len(v))
+			return nil
+		})
+	})
+
+	return size, err
+}
+
+// DiskSize returns the size of the database file, shared by all the namespaces.
+func (d *BoltDatabase) DiskSize() (int64, error) {
+	var size int64
+	err := d.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+
+	return size, err
+}
+
+// GCRuns is always 0, bolt reuses the freed pages of its file without garbage collection.
+func (d *BoltDatabase) GCRuns() int64 {
+	return 0
+}
+
 func copyByteSlice(b []byte) []byte {
 	if b == nil {
 		return nil
@@ -71,15 +305,16 @@ func copyByteSlice(b []byte) []byte {
 	return res
 }
 
-// DeleteExtraKeys deletes the keys that do not belong to this shard.
+// DeleteExtraKeys deletes the keys that do not belong to this shard, together with the expired keys.
 func (d *BoltDatabase) DeleteExtraKeys(isExtra func(string) bool) error {
 	var keys []string
 
 	err := d.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(defaultBucket)
+		b := tx.Bucket(d.bucket)
+		now := time.Now()
 		return b.ForEach(func(k, v []byte) error {
 			key := string(k)
-			if isExtra(key) {
+			if isExtra(key) || d.expired(tx, k, now) {
 				keys = append(keys, key)
 			}
 			return nil
@@ -91,10 +326,8 @@ func (d *BoltDatabase) DeleteExtraKeys(isExtra func(string) bool) error {
 	}
 
 	return d.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(defaultBucket)
-
 		for _, k := range keys {
-			if err := b.Delete([]byte(k)); err != nil {
+			if err := d.delete(tx, []byte(k)); err != nil {
 				return err
 			}
 		}
@@ -102,10 +335,16 @@ func (d *BoltDatabase) DeleteExtraKeys(isExtra func(string) bool) error {
 	})
 }
 
+// WriteInBatch applies the commands to the bucket of the database, whatever namespace they name.
 func (d *BoltDatabase) WriteInBatch(setCommands []SetCommand) error {
 	err := d.db.Batch(func(tx *bolt.Tx) error {
 		for _, command := range setCommands {
-			err := tx.Bucket(defaultBucket).Put([]byte(command.Key), []byte(command.Value))
+			var err error
+			if command.Delete {
+				err = d.delete(tx, []byte(command.Key))
+			} else {
+				err = d.put(tx, []byte(command.Key), command.Value)
+			}
 			if err != nil {
 				return err
 			}
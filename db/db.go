@@ -1,13 +1,41 @@
 package db
 
+import (
+	"errors"
+	"time"
+)
+
+// DefaultNamespace is the keyspace of the database returned by the constructors.
+const DefaultNamespace = "default"
+
 type SetCommand struct {
-	Key   string `json:"Key"`
-	Value string `json:"Value"`
+	Key       string `json:"Key"`
+	Value     []byte `json:"Value"`
+	Delete    bool   `json:"Delete,omitempty"`
+	Namespace string `json:"Namespace,omitempty"`
+}
+
+// ErrReservedKey is returned for a key of the default namespace starting with a 0x00 byte by the stores keeping the
+// keys of all the namespaces in one keyspace, where the keys of the other namespaces start with it.
+var ErrReservedKey = errors.New("keys of the default namespace must not start with a 0x00 byte")
+
+// KeyValue is a single key with its value, as returned by Scan.
+type KeyValue struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
 }
 
 type Database interface {
 	SetKey(key string, value []byte) error
 	GetKey(key string) ([]byte, error)
+	DeleteKey(key string) error
+	Scan(prefix string, limit int) ([]KeyValue, error)
+	KeyCount() (int, error)
+	// Size returns the total length of the keys and values stored.
+	Size() (int64, error)
 	DeleteExtraKeys(isExtra func(string) bool) error
 	WriteInBatch(setCommands []SetCommand) error
+	// Namespace returns a view of another keyspace of the same store. Keys of different namespaces never collide.
+	// The keys written through the view expire after ttl, or never when ttl is 0.
+	Namespace(name string, ttl time.Duration) (Database, error)
 }
@@ -2,9 +2,12 @@ package db_test
 
 import (
 	"bytes"
+	"errors"
 	"github.com/EliriaT/distributed-store/db"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func createTempDb(t *testing.T, readOnly bool) *db.BoltDatabase {
@@ -19,7 +22,7 @@ func createTempDb(t *testing.T, readOnly bool) *db.BoltDatabase {
 
 	t.Cleanup(func() { os.Remove(name) })
 
-	db, closeFunc, err := db.NewBoltDatabase(name)
+	db, closeFunc, err := db.NewBoltDatabase(name, db.BoltOptions{})
 	if err != nil {
 		t.Fatalf("Could not create a new database: %v", err)
 	}
@@ -47,7 +50,7 @@ func TestGetSet(t *testing.T) {
 	}
 }
 
-func setKey(t *testing.T, d *db.BoltDatabase, key, value string) {
+func setKey(t *testing.T, d db.Database, key, value string) {
 	t.Helper()
 
 	if err := d.SetKey(key, []byte(value)); err != nil {
@@ -55,7 +58,7 @@ func setKey(t *testing.T, d *db.BoltDatabase, key, value string) {
 	}
 }
 
-func getKey(t *testing.T, d *db.BoltDatabase, key string) string {
+func getKey(t *testing.T, d db.Database, key string) string {
 	t.Helper()
 
 	value, err := d.GetKey(key)
@@ -84,3 +87,257 @@ func TestDeleteExtraKeys(t *testing.T) {
 		t.Errorf(`Unexpected value for key "us": got %q, want %q`, value, "")
 	}
 }
+
+func TestDeleteKey(t *testing.T) {
+	db := createTempDb(t, false)
+
+	setKey(t, db, "utm", "utm-value")
+
+	if err := db.DeleteKey("utm"); err != nil {
+		t.Fatalf("Could not delete key: %v", err)
+	}
+
+	if value := getKey(t, db, "utm"); value != "" {
+		t.Errorf(`Unexpected value for key "utm": got %q, want %q`, value, "")
+	}
+
+	if err := db.DeleteKey("missing"); err != nil {
+		t.Errorf("Deleting a missing key failed: %v", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	db := createTempDb(t, false)
+
+	setKey(t, db, "user:2", "b")
+	setKey(t, db, "user:1", "a")
+	setKey(t, db, "user:3", "c")
+	setKey(t, db, "city:1", "chisinau")
+
+	got, err := db.Scan("user:", 0)
+	if err != nil {
+		t.Fatalf("Could not scan: %v", err)
+	}
+
+	want := []string{"user:1", "user:2", "user:3"}
+	if len(got) != len(want) {
+		t.Fatalf("Unexpected scan result: got %d keys, want %d", len(got), len(want))
+	}
+	for i, kv := range got {
+		if kv.Key != want[i] {
+			t.Errorf("Unexpected key at position %d: got %q, want %q", i, kv.Key, want[i])
+		}
+	}
+
+	limited, err := db.Scan("user:", 2)
+	if err != nil {
+		t.Fatalf("Could not scan with limit: %v", err)
+	}
+	if len(limited) != 2 {
+		t.Errorf("Unexpected scan result with limit: got %d keys, want %d", len(limited), 2)
+	}
+}
+
+func TestKeyCount(t *testing.T) {
+	db := createTempDb(t, false)
+
+	setKey(t, db, "utm", "utm-value")
+	setKey(t, db, "fcim", "fcim-value")
+
+	count, err := db.KeyCount()
+	if err != nil {
+		t.Fatalf("Could not count keys: %v", err)
+	}
+
+	if count != 2 {
+		t.Errorf("Unexpected key count: got %d, want %d", count, 2)
+	}
+}
+
+func createTempBadgerDb(t *testing.T) *db.BadgerDatabase {
+	t.Helper()
+
+	d, closeFunc, err := db.NewBadgerDatabase(t.TempDir(), db.DefaultBadgerOptions())
+	if err != nil {
+		t.Fatalf("Could not create a new database: %v", err)
+	}
+	t.Cleanup(func() { closeFunc() })
+
+	return d
+}
+
+func createMemoryDb(t *testing.T) *db.MemoryDatabase {
+	t.Helper()
+
+	d, closeFunc := db.NewMemoryDatabase(time.Minute)
+	t.Cleanup(func() { closeFunc() })
+
+	return d
+}
+
+func createBitcaskDb(t *testing.T, dir string, options db.BitcaskOptions) *db.BitcaskDatabase {
+	t.Helper()
+
+	if options.MaxSegmentSize == 0 {
+		options.MaxSegmentSize = 1 << 20
+	}
+	d, closeFunc, err := db.NewBitcaskDatabase(dir, options)
+	if err != nil {
+		t.Fatalf("Could not open the bitcask store: %v", err)
+	}
+	t.Cleanup(func() { closeFunc() })
+
+	return d
+}
+
+func TestNamespaces(t *testing.T) {
+	engines := map[string]db.Database{
+		"bolt":    createTempDb(t, false),
+		"badger":  createTempBadgerDb(t),
+		"memory":  createMemoryDb(t),
+		"bitcask": createBitcaskDb(t, t.TempDir(), db.BitcaskOptions{}),
+	}
+
+	for name, d := range engines {
+		t.Run(name, func(t *testing.T) {
+			cache, err := d.Namespace("cache", 0)
+			if err != nil {
+				t.Fatalf("Could not open the namespace: %v", err)
+			}
+
+			setKey(t, d, "utm", "default-value")
+			setKey(t, cache, "utm", "cache-value")
+			setKey(t, cache, "fcim", "cache-value")
+
+			if got := getKey(t, d, "utm"); got != "default-value" {
+				t.Errorf("Unexpected value in the default namespace: got %q, want %q", got, "default-value")
+			}
+			if got := getKey(t, cache, "utm"); got != "cache-value" {
+				t.Errorf("Unexpected value in the cache namespace: got %q, want %q", got, "cache-value")
+			}
+
+			if count, _ := d.KeyCount(); count != 1 {
+				t.Errorf("Unexpected key count of the default namespace: got %d, want %d", count, 1)
+			}
+			if size, _ := cache.Size(); size != 29 {
+				t.Errorf("Unexpected size of the cache namespace: got %d, want %d", size, 29)
+			}
+			if items, _ := cache.Scan("", 0); len(items) != 2 || items[0].Key != "fcim" {
+				t.Errorf("Unexpected scan of the cache namespace: %v", items)
+			}
+
+			if err = cache.DeleteKey("utm"); err != nil {
+				t.Fatalf("Could not delete the key: %v", err)
+			}
+			if got := getKey(t, d, "utm"); got != "default-value" {
+				t.Errorf("Deleting from a namespace changed the default namespace: got %q", got)
+			}
+		})
+	}
+}
+
+func TestReservedKeys(t *testing.T) {
+	engines := map[string]db.Database{
+		"bolt":    createTempDb(t, false),
+		"badger":  createTempBadgerDb(t),
+		"memory":  createMemoryDb(t),
+		"bitcask": createBitcaskDb(t, t.TempDir(), db.BitcaskOptions{}),
+	}
+
+	for name, d := range engines {
+		t.Run(name, func(t *testing.T) {
+			config, err := d.Namespace("config", 0)
+			if err != nil {
+				t.Fatalf("Could not open the namespace: %v", err)
+			}
+			setKey(t, config, "k", "config-value")
+
+			// the key the stores sharing a keyspace give to the key k of the config namespace
+			reserved := "\x00config\x00k"
+			if err := d.SetKey(reserved, []byte("default-value")); err != nil && !errors.Is(err, db.ErrReservedKey) {
+				t.Fatalf("Unexpected error writing a reserved key: %v", err)
+			}
+			if err := d.WriteInBatch([]db.SetCommand{{Key: reserved, Value: []byte("default-value")}}); err != nil && !errors.Is(err, db.ErrReservedKey) {
+				t.Fatalf("Unexpected error writing a reserved key in a batch: %v", err)
+			}
+			if err := d.DeleteKey(reserved); err != nil && !errors.Is(err, db.ErrReservedKey) {
+				t.Fatalf("Unexpected error deleting a reserved key: %v", err)
+			}
+
+			if got := getKey(t, config, "k"); got != "config-value" {
+				t.Errorf("A key of the default namespace reached the config namespace: got %q", got)
+			}
+			if value, err := d.GetKey(reserved); string(value) == "config-value" {
+				t.Errorf("A key of the config namespace was read from the default namespace: %q, %v", value, err)
+			}
+		})
+	}
+}
+
+func TestNamespaceTTL(t *testing.T) {
+	engines := map[string]db.Database{
+		"bolt":    createTempDb(t, false),
+		"badger":  createTempBadgerDb(t),
+		"memory":  createMemoryDb(t),
+		"bitcask": createBitcaskDb(t, t.TempDir(), db.BitcaskOptions{}),
+	}
+
+	for name, d := range engines {
+		t.Run(name, func(t *testing.T) {
+			// badger stores expiry times in seconds
+			sessions, err := d.Namespace("sessions", time.Second)
+			if err != nil {
+				t.Fatalf("Could not open the namespace: %v", err)
+			}
+
+			setKey(t, sessions, "utm", "fcim")
+			if got := getKey(t, sessions, "utm"); got != "fcim" {
+				t.Fatalf("Unexpected value before the key expired: got %q, want %q", got, "fcim")
+			}
+
+			time.Sleep(2 * time.Second)
+
+			if got := getKey(t, sessions, "utm"); got != "" {
+				t.Errorf("The key should have expired, got %q", got)
+			}
+			if items, _ := sessions.Scan("", 0); len(items) != 0 {
+				t.Errorf("Scan returned expired keys: %v", items)
+			}
+		})
+	}
+}
+
+func TestEngineOptions(t *testing.T) {
+	tests := []struct {
+		engine  string
+		options db.Options
+		valid   bool
+	}{
+		{"lsm", db.Options{"memtable_size": int64(16 << 20), "value_threshold": int64(1024), "compression": "zstd", "cache_size": int64(8 << 20), "gc_interval": "1m", "gc_ratio": 0.5}, true},
+		{"lsm", db.Options{"compression": "none", "cache_size": int64(0), "sync_writes": true}, true},
+		{"lsm", db.Options{"compression": "snappy", "cache_size": int64(0)}, false},
+		{"lsm", db.Options{"compression": "lz4"}, false},
+		{"lsm", db.Options{"gc_ratio": 1.5}, false},
+		{"lsm", db.Options{"value_threshold": int64(2 << 20)}, false},
+		{"lsm", db.Options{"memtable": int64(1 << 20)}, false},
+		{"btree", db.Options{"no_sync": true, "freelist_type": "hashmap", "initial_mmap_size": int64(1 << 20), "lock_timeout": "1s", "max_batch_delay": "5ms"}, true},
+		{"btree", db.Options{"freelist_type": "tree"}, false},
+		{"btree", db.Options{"no_sync": "yes"}, false},
+		{"btree", db.Options{"lock_timeout": 1}, false},
+	}
+
+	for _, test := range tests {
+		d, closeFunc, err := db.Open(test.engine, filepath.Join(t.TempDir(), "store"), test.options)
+		if test.valid {
+			if err != nil {
+				t.Errorf("Could not open the %s store with %v: %v", test.engine, test.options, err)
+				continue
+			}
+			setKey(t, d, "utm", "fcim")
+			closeFunc()
+		} else if err == nil {
+			closeFunc()
+			t.Errorf("Opening the %s store with %v should fail", test.engine, test.options)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package db
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrReadOnly is returned for a write to a snapshot.
+var ErrReadOnly = errors.New("the snapshot is read-only")
+
+// defaultExpiryInterval is how often the memory store drops the expired keys, when expiry_interval is unset.
+const defaultExpiryInterval = time.Minute
+
+func init() {
+	Register("memory", func(_ string, options Options) (Database, func() error, error) {
+		if err := options.Check("expiry_interval"); err != nil {
+			return nil, nil, err
+		}
+		interval, err := options.Duration("expiry_interval", defaultExpiryInterval)
+		if err != nil {
+			return nil, nil, err
+		}
+		if interval == 0 {
+			interval = defaultExpiryInterval
+		}
+
+		slog.Info("Opening the memory store", "options", slog.GroupValue(slog.Duration("expiry_interval", interval)))
+		database, closeFunc := NewMemoryDatabase(interval)
+		return database, closeFunc, nil
+	})
+}
+
+// Snapshotter is a database taking snapshots: read-only views of the keys of every namespace as they were when
+// the snapshot was taken. release frees what the snapshot keeps.
+type Snapshotter interface {
+	Snapshot() (snapshot Database, release func())
+}
+
+// version is a value a key had from a write on, or a delete when deleted.
+type version struct {
+	seq     uint64
+	value   []byte
+	deleted bool
+	// expires is the unix nano time the value expires at, 0 when it does not
+	expires int64
+}
+
+func (v *version) visible(now int64) bool {
+	return !v.deleted && (v.expires == 0 || v.expires > now)
+}
+
+// keyspace holds the keys of a namespace, with their versions from the oldest one.
+type keyspace struct {
+	keys map[string][]version
+	// sorted holds the keys in order, rebuilt by the first scan after a key was added or removed
+	sorted []string
+	dirty  bool
+}
+
+// memoryStore holds the keyspaces of a memory database. Every write gets the next sequence number, and the
+// snapshots keep the versions they see until released.
+type memoryStore struct {
+	mu        sync.RWMutex
+	seq       uint64
+	spaces    map[string]*keyspace
+	snapshots map[uint64]int
+}
+
+// MemoryDatabase is a database kept in memory, lost when the process exits. The keys of every namespace are kept
+// in a map, sorted for the scans.
+type MemoryDatabase struct {
+	store *memoryStore
+	name  string
+	ttl   time.Duration
+	// at is the sequence number a snapshot reads at, 0 for the current keys
+	at uint64
+}
+
+// NewMemoryDatabase returns an empty memory database, dropping the expired keys every expiryInterval until closed.
+func NewMemoryDatabase(expiryInterval time.Duration) (db *MemoryDatabase, closeFunc func() error) {
+	store := &memoryStore{spaces: make(map[string]*keyspace), snapshots: make(map[uint64]int)}
+	db = &MemoryDatabase{store: store, name: DefaultNamespace}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(expiryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				store.dropExpired()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	closeFunc = func() error {
+		once.Do(func() { close(stop) })
+		return nil
+	}
+	return db, closeFunc
+}
+
+// Namespace returns the database of the keys of the namespace. The namespace of a snapshot is read at the same time.
+func (d *MemoryDatabase) Namespace(name string, ttl time.Duration) (Database, error) {
+	if name == "" {
+		name = DefaultNamespace
+	}
+	return &MemoryDatabase{store: d.store, name: name, ttl: ttl, at: d.at}, nil
+}
+
+// Snapshot returns a read-only view of the keys as they are now. The snapshot of a snapshot is itself.
+func (d *MemoryDatabase) Snapshot() (Database, func()) {
+	if d.at > 0 {
+		return d, func() {}
+	}
+
+	d.store.mu.Lock()
+	at := d.store.seq + 1
+	// the sequence number moves on, so that the snapshot sees no write made after it
+	d.store.seq = at
+	d.store.snapshots[at]++
+	d.store.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() { d.store.release(at) })
+	}
+	return &MemoryDatabase{store: d.store, name: d.name, ttl: d.ttl, at: at}, release
+}
+
+func (s *memoryStore) release(at uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.snapshots[at]--; s.snapshots[at] <= 0 {
+		delete(s.snapshots, at)
+	}
+	for _, space := range s.spaces {
+		for key := range space.keys {
+			s.compact(space, key)
+		}
+	}
+}
+
+// compact drops the versions of the key no reader sees anymore: the current one and the last one before every
+// snapshot are kept. It removes a key left without a version.
+func (s *memoryStore) compact(space *keyspace, key string) {
+	versions := space.keys[key]
+	kept := versions[:0]
+	for i, v := range versions {
+		if i == len(versions)-1 || s.seen(v.seq, versions[i+1].seq) {
+			kept = append(kept, v)
+		}
+	}
+	// a delete before every kept value reads like a missing key
+	for len(kept) > 0 && kept[0].deleted {
+		kept = kept[1:]
+	}
+
+	if len(kept) == 0 {
+		delete(space.keys, key)
+		space.dirty = true
+		return
+	}
+	space.keys[key] = kept
+}
+
+// seen reports whether a snapshot reads a version written at from, and replaced at until.
+func (s *memoryStore) seen(from, until uint64) bool {
+	for at := range s.snapshots {
+		if at > from && at <= until {
+			return true
+		}
+	}
+	return false
+}
+
+// dropExpired removes the expired keys no snapshot reads.
+func (s *memoryStore) dropExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.snapshots) > 0 {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	for _, space := range s.spaces {
+		for key, versions := range space.keys {
+			if current := versions[len(versions)-1]; current.expires != 0 && current.expires <= now {
+				delete(space.keys, key)
+				space.dirty = true
+			}
+		}
+	}
+}
+
+func (d *MemoryDatabase) space() *keyspace {
+	space, ok := d.store.spaces[d.name]
+	if !ok {
+		space = &keyspace{keys: make(map[string][]version)}
+		d.store.spaces[d.name] = space
+	}
+	return space
+}
+
+// read returns the version of the key the database sees, nil for a missing or expired key. The caller holds a lock.
+func (d *MemoryDatabase) read(space *keyspace, key string, now int64) *version {
+	versions := space.keys[key]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if d.at == 0 || versions[i].seq < d.at {
+			if versions[i].visible(now) {
+				return &versions[i]
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// write adds a version of the key. The caller holds the write lock.
+func (d *MemoryDatabase) write(space *keyspace, key string, value []byte, deleted bool) {
+	d.store.seq++
+	v := version{seq: d.store.seq, deleted: deleted}
+	if !deleted {
+		v.value = append([]byte{}, value...)
+		if d.ttl > 0 {
+			v.expires = time.Now().Add(d.ttl).UnixNano()
+		}
+	}
+
+	versions, ok := space.keys[key]
+	if !ok {
+		if deleted {
+			return
+		}
+		space.dirty = true
+	}
+	space.keys[key] = append(versions, v)
+	d.store.compact(space, key)
+}
+
+func (d *MemoryDatabase) SetKey(key string, value []byte) error {
+	return d.update(func(space *keyspace) {
+		d.write(space, key, value, false)
+	})
+}
+
+func (d *MemoryDatabase) GetKey(key string) ([]byte, error) {
+	d.store.mu.RLock()
+	defer d.store.mu.RUnlock()
+
+	space, ok := d.store.spaces[d.name]
+	if !ok {
+		return nil, nil
+	}
+	if v := d.read(space, key, time.Now().UnixNano()); v != nil {
+		return append([]byte{}, v.value...), nil
+	}
+	return nil, nil
+}
+
+func (d *MemoryDatabase) DeleteKey(key string) error {
+	return d.update(func(space *keyspace) {
+		d.write(space, key, nil, true)
+	})
+}
+
+// update runs fn under the write lock, failing on a snapshot.
+func (d *MemoryDatabase) update(fn func(space *keyspace)) error {
+	if d.at > 0 {
+		return ErrReadOnly
+	}
+
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	fn(d.space())
+	return nil
+}
+
+// each calls fn with the keys the database sees starting with prefix, in order, until fn returns false.
+func (d *MemoryDatabase) each(prefix string, fn func(key string, v *version) bool) {
+	d.store.mu.Lock()
+	defer d.store.mu.Unlock()
+
+	space := d.space()
+	if space.dirty {
+		space.sorted = space.sorted[:0]
+		for key := range space.keys {
+			space.sorted = append(space.sorted, key)
+		}
+		sort.Strings(space.sorted)
+		space.dirty = false
+	}
+
+	now := time.Now().UnixNano()
+	for i := sort.SearchStrings(space.sorted, prefix); i < len(space.sorted) && strings.HasPrefix(space.sorted[i], prefix); i++ {
+		if v := d.read(space, space.sorted[i], now); v != nil && !fn(space.sorted[i], v) {
+			return
+		}
+	}
+}
+
+func (d *MemoryDatabase) Scan(prefix string, limit int) ([]KeyValue, error) {
+	var result []KeyValue
+	d.each(prefix, func(key string, v *version) bool {
+		result = append(result, KeyValue{Key: key, Value: append([]byte{}, v.value...)})
+		return limit <= 0 || len(result) < limit
+	})
+	return result, nil
+}
+
+func (d *MemoryDatabase) KeyCount() (int, error) {
+	var count int
+	d.each("", func(string, *version) bool {
+		count++
+		return true
+	})
+	return count, nil
+}
+
+func (d *MemoryDatabase) Size() (int64, error) {
+	var size int64
+	d.each("", func(key string, v *version) bool {
+		size += int64(len(key) + len(v.value))
+		return true
+	})
+	return size, nil
+}
+
+func (d *MemoryDatabase) DeleteExtraKeys(isExtra func(string) bool) error {
+	var keys []string
+	d.each("", func(key string, _ *version) bool {
+		if isExtra(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	return d.update(func(space *keyspace) {
+		for _, key := range keys {
+			d.write(space, key, nil, true)
+		}
+	})
+}
+
+// WriteInBatch applies the commands to the namespace of the database at once, whatever namespace they name.
+func (d *MemoryDatabase) WriteInBatch(setCommands []SetCommand) error {
+	return d.update(func(space *keyspace) {
+		for _, command := range setCommands {
+			d.write(space, command.Key, command.Value, command.Delete)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package db_test
+
+import (
+	"errors"
+	"github.com/EliriaT/distributed-store/db"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMemoryDatabase(t *testing.T) {
+	d := createMemoryDb(t)
+
+	setKey(t, d, "user:2", "b")
+	setKey(t, d, "user:1", "a")
+	setKey(t, d, "city:1", "chisinau")
+	if err := d.WriteInBatch([]db.SetCommand{{Key: "user:3", Value: []byte("c")}, {Key: "city:1", Delete: true}}); err != nil {
+		t.Fatalf("Could not write the batch: %v", err)
+	}
+
+	items, err := d.Scan("", 0)
+	if err != nil {
+		t.Fatalf("Could not scan: %v", err)
+	}
+	var keys []string
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	if len(keys) != 3 || keys[0] != "user:1" || keys[2] != "user:3" {
+		t.Errorf("Unexpected scan: %v", keys)
+	}
+	if count, _ := d.KeyCount(); count != 3 {
+		t.Errorf("Unexpected key count: got %d, want %d", count, 3)
+	}
+	if size, _ := d.Size(); size != 21 {
+		t.Errorf("Unexpected size: got %d, want %d", size, 21)
+	}
+
+	value, _ := d.GetKey("user:1")
+	value[0] = 'z'
+	if got := getKey(t, d, "user:1"); got != "a" {
+		t.Errorf("Changing a returned value changed the stored one: %q", got)
+	}
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	d := createMemoryDb(t)
+	cache, _ := d.Namespace("cache", 0)
+
+	setKey(t, d, "utm", "fcim")
+	setKey(t, d, "usm", "math")
+	setKey(t, cache, "utm", "cached")
+
+	snapshot, release := d.Snapshot()
+	defer release()
+
+	setKey(t, d, "utm", "changed")
+	setKey(t, d, "asem", "new")
+	setKey(t, cache, "utm", "changed")
+	if err := d.DeleteKey("usm"); err != nil {
+		t.Fatalf("Could not delete the key: %v", err)
+	}
+
+	if got := getKey(t, snapshot, "utm"); got != "fcim" {
+		t.Errorf("The snapshot sees a later write: got %q, want %q", got, "fcim")
+	}
+	if got := getKey(t, snapshot, "usm"); got != "math" {
+		t.Errorf("The snapshot does not see a key deleted after it: got %q", got)
+	}
+	if items, _ := snapshot.Scan("", 0); len(items) != 2 || items[0].Key != "usm" || string(items[1].Value) != "fcim" {
+		t.Errorf("Unexpected scan of the snapshot: %v", items)
+	}
+	snapshotCache, _ := snapshot.Namespace("cache", 0)
+	if got := getKey(t, snapshotCache, "utm"); got != "cached" {
+		t.Errorf("The namespace of the snapshot sees a later write: got %q, want %q", got, "cached")
+	}
+	if err := snapshot.SetKey("utm", []byte("x")); !errors.Is(err, db.ErrReadOnly) {
+		t.Errorf("Writing to the snapshot = %v, want ErrReadOnly", err)
+	}
+
+	if got := getKey(t, d, "utm"); got != "changed" {
+		t.Errorf("Unexpected current value: got %q, want %q", got, "changed")
+	}
+	if got := getKey(t, d, "usm"); got != "" {
+		t.Errorf("The deleted key is back: got %q", got)
+	}
+
+	release()
+	release()
+	later, releaseLater := d.Snapshot()
+	defer releaseLater()
+	if got := getKey(t, later, "utm"); got != "changed" {
+		t.Errorf("A later snapshot does not see the current value: got %q", got)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if engines := db.Engines(); !slices.Equal(engines, []string{"bitcask", "btree", "lsm", "memory"}) {
+		t.Errorf("Registered engines = %v, want bitcask, btree, lsm and memory", engines)
+	}
+
+	d, closeFunc, err := db.Open("memory", "", db.Options{"expiry_interval": "10ms"})
+	if err != nil {
+		t.Fatalf("Could not open the memory store: %v", err)
+	}
+	defer closeFunc()
+
+	sessions, _ := d.Namespace("sessions", 20*time.Millisecond)
+	setKey(t, sessions, "utm", "fcim")
+	time.Sleep(50 * time.Millisecond)
+	if count, _ := sessions.KeyCount(); count != 0 {
+		t.Errorf("The expired key was not dropped")
+	}
+
+	if _, _, err := db.Open("memory", "", db.Options{"expiry": "1m"}); err == nil {
+		t.Errorf("An unknown option was accepted")
+	}
+	if _, _, err := db.Open("memory", "", db.Options{"expiry_interval": 60}); err == nil {
+		t.Errorf("A malformed duration was accepted")
+	}
+	if _, _, err := db.Open("rocksdb", "", nil); !errors.Is(err, db.ErrUnknownEngine) {
+		t.Errorf("Opening an unknown engine = %v, want ErrUnknownEngine", err)
+	}
+}
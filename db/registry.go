@@ -0,0 +1,154 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownEngine is returned for a storage engine no backend registered.
+var ErrUnknownEngine = errors.New("unknown storage engine")
+
+// Options are the settings of a storage engine, the table named after it in the storage section of the config.
+type Options map[string]any
+
+// Check returns an error naming the first option not in known, so that a mistyped option is not ignored.
+func (o Options) Check(known ...string) error {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch {
+		case len(known) == 0:
+			return fmt.Errorf("unknown option %q, the engine takes none", name)
+		case !slices.Contains(known, name):
+			return fmt.Errorf("unknown option %q, allowed: %s", name, strings.Join(known, "/"))
+		}
+	}
+	return nil
+}
+
+// Duration returns the option as a duration, written like "30s", or fallback when it is unset.
+func (o Options) Duration(name string, fallback time.Duration) (time.Duration, error) {
+	value, ok := o[name]
+	if !ok {
+		return fallback, nil
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("option %q must be a duration like \"30s\", got %v", name, value)
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("option %q must be a positive duration like \"30s\", got %q", name, text)
+	}
+	return duration, nil
+}
+
+// Int returns the option as an integer, or fallback when it is unset.
+func (o Options) Int(name string, fallback int64) (int64, error) {
+	value, ok := o[name]
+	if !ok {
+		return fallback, nil
+	}
+
+	switch number := value.(type) {
+	case int64:
+		return number, nil
+	case int:
+		return int64(number), nil
+	default:
+		return 0, fmt.Errorf("option %q must be an integer, got %v", name, value)
+	}
+}
+
+// Float returns the option as a number, or fallback when it is unset.
+func (o Options) Float(name string, fallback float64) (float64, error) {
+	value, ok := o[name]
+	if !ok {
+		return fallback, nil
+	}
+
+	switch number := value.(type) {
+	case float64:
+		return number, nil
+	case int64:
+		return float64(number), nil
+	case int:
+		return float64(number), nil
+	default:
+		return 0, fmt.Errorf("option %q must be a number, got %v", name, value)
+	}
+}
+
+// Bool returns the option as a boolean, or fallback when it is unset.
+func (o Options) Bool(name string, fallback bool) (bool, error) {
+	value, ok := o[name]
+	if !ok {
+		return fallback, nil
+	}
+
+	flag, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("option %q must be true or false, got %v", name, value)
+	}
+	return flag, nil
+}
+
+// Opener opens the store of an engine at the path, and returns the function closing it.
+type Opener func(path string, options Options) (Database, func() error, error)
+
+var (
+	enginesMu sync.RWMutex
+	engines   = make(map[string]Opener)
+)
+
+// Register makes a storage engine available under the name, for the storage_module of the config. It panics when
+// the name is taken.
+func Register(name string, open Opener) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	if _, ok := engines[name]; ok {
+		panic(fmt.Sprintf("storage engine %q registered twice", name))
+	}
+	engines[name] = open
+}
+
+// Engines returns the names of the registered storage engines, sorted.
+func Engines() []string {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the store of the engine registered under the name at the path.
+func Open(name, path string, options Options) (Database, func() error, error) {
+	enginesMu.RLock()
+	open, ok := engines[name]
+	enginesMu.RUnlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %q, allowed: %s", ErrUnknownEngine, name, strings.Join(Engines(), "/"))
+	}
+
+	database, closeFunc, err := open(path, options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening the %s store: %w", name, err)
+	}
+	return database, closeFunc, nil
+}
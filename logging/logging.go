@@ -0,0 +1,223 @@
+// Package logging sets up the structured, leveled logs of a node. Every request gets an ID that is logged with
+// everything done for it, on the coordinator and on the replicas, and is returned in the X-Request-ID header.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// RequestIDHeader carries the request ID, in HTTP headers and in gRPC metadata.
+const RequestIDHeader = "X-Request-ID"
+
+var (
+	level        = new(slog.LevelVar)
+	redactValues atomic.Bool
+	sampleEvery  atomic.Int64
+	// samples counts the sampled logs by message
+	samples sync.Map
+)
+
+// Setup makes the logger described by the config the default one, for slog and for the log package.
+// With logs = false in the config nothing is logged.
+func Setup(cfg config.Config, w io.Writer, shard string) {
+	if err := SetLevel(cfg.Logging.Level); err != nil {
+		SetLevel("info")
+	}
+	redactValues.Store(cfg.Logging.RedactValues)
+	sampleEvery.Store(int64(cfg.Logging.SampleEvery))
+
+	if !cfg.MustLog {
+		w = io.Discard
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if cfg.Logging.Format == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	slog.SetDefault(slog.New(&contextHandler{handler}).With("shard", shard))
+}
+
+// Level returns the lowest level logged.
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel changes the lowest level logged. An empty name is "info".
+func SetLevel(name string) error {
+	if name == "" {
+		name = "info"
+	}
+
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("unknown log level %q", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+// Value returns the attribute logging a value, or only its length when the values are redacted.
+func Value[V string | []byte](value V) slog.Attr {
+	if redactValues.Load() {
+		return slog.String("value", fmt.Sprintf("[redacted %d bytes]", len(value)))
+	}
+	return slog.String("value", string(value))
+}
+
+// Sampled logs a debug message of a hot path, like every key read or written. Only one of every sample_every
+// logs with the same message is written.
+func Sampled(ctx context.Context, msg string, args ...any) {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	if every := sampleEvery.Load(); every > 1 {
+		counter, _ := samples.LoadOrStore(msg, new(atomic.Int64))
+		if counter.(*atomic.Int64).Add(1)%every != 1 {
+			return
+		}
+	}
+	slog.DebugContext(ctx, msg, args...)
+}
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithRequestID returns a context carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by the context, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestID keeps the ID the caller sent, if it is a sane one, or makes a new one.
+func requestID(sent string) string {
+	if sent == "" || len(sent) > 64 || strings.ContainsFunc(sent, func(r rune) bool { return r <= ' ' || r > '~' }) {
+		return NewRequestID()
+	}
+	return sent
+}
+
+// contextHandler adds the request ID of the context to the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Middleware gives every HTTP request the ID sent in its X-Request-ID header, or a new one, and returns it in the response.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// Transport sends the request ID of the request context in the X-Request-ID header.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(r *http.Request) (*http.Response, error) {
+		if id := RequestID(r.Context()); id != "" {
+			r = r.Clone(r.Context())
+			r.Header.Set(RequestIDHeader, id)
+		}
+		return base.RoundTrip(r)
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// ServerOptions give every gRPC call the ID sent in its x-request-id metadata, or a new one, and return it in the header.
+func ServerOptions() []grpc.ServerOption {
+	withID := func(ctx context.Context) context.Context {
+		var sent string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(RequestIDHeader); len(values) > 0 {
+				sent = values[0]
+			}
+		}
+
+		id := requestID(sent)
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+		return WithRequestID(ctx, id)
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			return handler(withID(ctx), req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return handler(srv, &serverStream{ServerStream: ss, ctx: withID(ss.Context())})
+		}),
+	}
+}
+
+// serverStream replaces the context of a stream with the one carrying the request ID.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// DialOptions send the request ID of the call context in the x-request-id metadata.
+func DialOptions() []grpc.DialOption {
+	withID := func(ctx context.Context) context.Context {
+		if id := RequestID(ctx); id != "" {
+			return metadata.AppendToOutgoingContext(ctx, RequestIDHeader, id)
+		}
+		return ctx
+	}
+
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(withID(ctx), method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(withID(ctx), desc, cc, method, opts...)
+		}),
+	}
+}
@@ -0,0 +1,117 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/logging"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func setup(t *testing.T, cfg config.Logging) *bytes.Buffer {
+	t.Helper()
+
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	var buf bytes.Buffer
+	logging.Setup(config.Config{MustLog: true, Logging: cfg}, &buf, "Chisinau")
+	return &buf
+}
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var logged []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Could not decode the log line %q: %v", line, err)
+		}
+		logged = append(logged, record)
+	}
+	return logged
+}
+
+func TestMiddleware(t *testing.T) {
+	buf := setup(t, config.Logging{Format: "json"})
+
+	var seen string
+	handler := logging.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+		slog.InfoContext(r.Context(), "Handled")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/get?key=utm", nil)
+	req.Header.Set(logging.RequestIDHeader, "abc123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if seen != "abc123" || rec.Header().Get(logging.RequestIDHeader) != "abc123" {
+		t.Errorf("The sent request ID was not kept: handler got %q, response has %q", seen, rec.Header().Get(logging.RequestIDHeader))
+	}
+
+	logged := records(t, buf)
+	if len(logged) != 1 || logged[0]["request_id"] != "abc123" || logged[0]["shard"] != "Chisinau" {
+		t.Errorf("The log misses the request ID or the shard: %v", logged)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/get?key=utm", nil))
+	if id := rec.Header().Get(logging.RequestIDHeader); id == "" || id != seen {
+		t.Errorf("No request ID was made: handler got %q, response has %q", seen, id)
+	}
+}
+
+func TestValue(t *testing.T) {
+	setup(t, config.Logging{})
+	if got := logging.Value("fcim").Value.String(); got != "fcim" {
+		t.Errorf("Value = %q, want fcim", got)
+	}
+
+	setup(t, config.Logging{RedactValues: true})
+	if got := logging.Value("fcim").Value.String(); got != "[redacted 4 bytes]" {
+		t.Errorf("Redacted value = %q, want [redacted 4 bytes]", got)
+	}
+}
+
+func TestSampled(t *testing.T) {
+	buf := setup(t, config.Logging{Level: "debug", Format: "json", SampleEvery: 3})
+
+	for i := 0; i < 7; i++ {
+		logging.Sampled(context.Background(), "Get processed", "key", "utm")
+	}
+
+	if logged := records(t, buf); len(logged) != 3 {
+		t.Errorf("Got %d sampled logs, want 3", len(logged))
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	buf := setup(t, config.Logging{Format: "json"})
+
+	logging.Sampled(context.Background(), "Set processed")
+	if buf.Len() != 0 {
+		t.Errorf("Debug logs are written at info level: %s", buf)
+	}
+
+	if err := logging.SetLevel("loud"); err == nil {
+		t.Errorf("An unknown level was accepted")
+	}
+
+	if err := logging.SetLevel("debug"); err != nil {
+		t.Fatalf("Could not set the debug level: %v", err)
+	}
+	logging.Sampled(context.Background(), "Set processed")
+	if buf.Len() == 0 {
+		t.Errorf("Debug logs are not written at debug level")
+	}
+}
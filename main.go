@@ -1,37 +1,62 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/EliriaT/distributed-store/certs"
 	config "github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/coordinator/auth"
 	grpcCoordinator "github.com/EliriaT/distributed-store/coordinator/grpc"
 	"github.com/EliriaT/distributed-store/coordinator/grpc/proto"
+	"github.com/EliriaT/distributed-store/coordinator/health"
+	"github.com/EliriaT/distributed-store/coordinator/peerauth"
 	"github.com/EliriaT/distributed-store/coordinator/rest"
 	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/logging"
+	"github.com/EliriaT/distributed-store/metrics"
+	"github.com/EliriaT/distributed-store/namespace"
+	"github.com/EliriaT/distributed-store/tracing"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
-	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
 var (
-	dbLocation = flag.String("db-location", "", "The path to the bolt db database")
-	httpAddr   = flag.String("http-addr", "127.0.0.1:8080", "HTTP host and port")
-	configFile = flag.String("config-file", "sharding.toml", "Config file for static sharding")
-	shard      = flag.String("shard", "", "The name of the shard to run")
-	env        = flag.String("env", "", "The path to env file for the consensus module")
+	dbLocation  = flag.String("db-location", "", "The path to the database, unused by the memory storage engine")
+	httpAddr    = flag.String("http-addr", "127.0.0.1:8080", "HTTP host and port")
+	configFile  = flag.String("config-file", "sharding.toml", "Config file for static sharding")
+	shard       = flag.String("shard", "", "The name of the shard to run")
+	env         = flag.String("env", "", "The path to env file for the consensus module")
+	metricsAddr = flag.String("metrics-addr", "", "Host and port serving the Prometheus metrics on /metrics, disabled when empty")
 )
 
 const (
 	HTTP_TRANSPORT string = "http"
-	LSM_STORAGE    string = "lsm"
 )
 
+// certReloadInterval is how often the TLS certificate files are checked for changes.
+const certReloadInterval = 30 * time.Second
+
+// healthCheckInterval is how often the readiness behind the gRPC health service is checked.
+const healthCheckInterval = 5 * time.Second
+
+// defaultDrainTimeout bounds the shutdown when the config sets no drain_timeout.
+const defaultDrainTimeout = 30 * time.Second
+
 var kacp = keepalive.ClientParameters{
 	Time:                20 * time.Second, // send pings every 20 seconds if there is no activity
 	Timeout:             2 * time.Second,  // wait 2 second for ping ack before considering the connection dead
@@ -76,72 +101,265 @@ func main() {
 		log.Fatalf("Error parsing shards config: %v", err)
 	}
 
-	log.Printf("Shard count is %d, current shard: %d", shards.Count, shards.CurrIdx)
+	logging.Setup(shardConfig, os.Stderr, *shard)
+	slog.Info("Starting the node", "shards", shards.Count, "index", shards.CurrIdx)
 
-	var database db.Database
-	var closeFunc func() error
+	engine := strings.ToLower(shardConfig.StorageModule)
+	database, closeFunc, err := db.Open(engine, *dbLocation, shardConfig.Storage[engine])
+	if err != nil {
+		log.Fatalf("Error creating %q: %v", *dbLocation, err)
+	}
+	defer func() {
+		if err := closeFunc(); err != nil {
+			slog.Error("Could not close the database", "error", err)
+		}
+	}()
 
-	if shardConfig.StorageModule == LSM_STORAGE {
-		database, closeFunc, err = db.NewBadgerDatabase(*dbLocation)
-	} else {
-		database, closeFunc, err = db.NewBoltDatabase(*dbLocation)
+	if store, ok := database.(metrics.Store); ok {
+		metrics.RegisterStore(engine, store)
 	}
 
+	namespaces, err := namespace.NewRegistry(database, shardConfig)
 	if err != nil {
-		log.Fatalf("Error creating %q: %v", *dbLocation, err)
+		log.Fatalf("Error opening the namespaces: %v", err)
+	}
+
+	if shardConfig.ClusterSecret == "" {
+		slog.Warn("No cluster_secret is configured, the internal address accepts requests from anyone who can reach it")
+	}
+
+	var reloader *certs.Reloader
+	if shardConfig.TLS.Enabled() {
+		reloader, err = certs.NewReloader(shardConfig.TLS)
+		if err != nil {
+			log.Fatalf("Error loading the TLS certificates: %v", err)
+		}
+		go reloader.Watch(certReloadInterval)
+		defer reloader.Close()
+	}
+
+	if !shardConfig.Auth.Enabled() {
+		slog.Warn("No auth principals are configured, the public address accepts requests from anyone who can reach it")
 	}
-	defer closeFunc()
 
-	if shardConfig.MustLog == false {
-		log.SetOutput(io.Discard)
-		log.SetFlags(0)
+	shutdownTracing, err := tracing.Init(context.Background(), shardConfig.Tracing, *shard)
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
 	}
+	defer shutdownTracing(context.Background())
+
+	// the servers return once drained, so that the deferred closes of the database and the exporters run
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	if shardConfig.TransportProtocol == HTTP_TRANSPORT {
-		startHttpServer(database, shards, shardConfig)
+		startHttpServer(ctx, namespaces, shards, shardConfig, reloader)
 	} else {
-		startGRPCServer(database, shards, shardConfig)
+		startGRPCServer(ctx, namespaces, shards, shardConfig, reloader)
+	}
+}
+
+// drainContext returns the context bounding the shutdown of the node.
+func drainContext(cfg config.Config) (context.Context, context.CancelFunc) {
+	timeout := cfg.DrainTimeout
+	if timeout == 0 {
+		timeout = defaultDrainTimeout
 	}
+	slog.Info("Draining the node", "timeout", timeout)
+	return context.WithTimeout(context.Background(), timeout)
 }
 
-func startGRPCServer(db db.Database, shards *config.Shards, cfg config.Config) {
-	srv := grpcCoordinator.NewServer(db, shards, cfg, *env)
+// startGRPCServer serves the node over gRPC until ctx is done, then drains it.
+func startGRPCServer(ctx context.Context, namespaces *namespace.Registry, shards *config.Shards, cfg config.Config, reloader *certs.Reloader) {
+	srv := grpcCoordinator.NewServer(namespaces, shards, cfg, *env)
 
 	nodeAddress := strings.Split(*httpAddr, ":")
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", nodeAddress[1]))
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer(grpc.KeepaliveEnforcementPolicy(kaep), grpc.KeepaliveParams(kasp))
+	opts := append([]grpc.ServerOption{grpc.KeepaliveEnforcementPolicy(kaep), grpc.KeepaliveParams(kasp), tracing.ServerOption()}, logging.ServerOptions()...)
+	internalOpts := append(peerauth.ServerOptions(cfg.ClusterSecret), opts...)
+	peerCreds := insecure.NewCredentials()
+	if reloader != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig(false))))
+		internalOpts = append(internalOpts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig(cfg.TLS.MutualTLS))))
+		peerCreds = credentials.NewTLS(reloader.PeerConfig())
+	}
+
+	// the metrics interceptors come first, to record the calls rejected by auth too
+	publicOpts := append(append(opts, metrics.ServerOptions()...), auth.New(cfg.Auth).ServerOptions()...)
+	s := grpc.NewServer(publicOpts...)
 	proto.RegisterNodeServiceServer(s, srv)
 
+	// the health service follows the readiness of the node, on both addresses
+	healthServer := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	// the replica to replica calls are served on the internal address only
+	internalLis, err := net.Listen("tcp", listenAddress(shards.InternalAddrs[shards.CurrIdx]))
+	if err != nil {
+		log.Fatalf("failed to listen on the internal address: %v", err)
+	}
+	internal := grpc.NewServer(internalOpts...)
+	proto.RegisterInternalServiceServer(internal, grpcCoordinator.NewInternalServer(namespaces, shards, srv))
+	healthpb.RegisterHealthServer(internal, healthServer)
+
+	go func() {
+		// Serve returns nil once the server is stopped
+		if err := internal.Serve(internalLis); err != nil {
+			log.Fatalf("failed to serve the internal API: %v", err)
+		}
+	}()
+
 	// establishing http2 long live connections with peer nodes
 	for _, peer := range cfg.Shards {
 		if peer.Idx != shards.CurrIdx {
-			address := strings.Split(peer.Address, ":")
-			conn, err := grpc.NewClient(fmt.Sprintf(":%s", address[1]), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithKeepaliveParams(kacp))
+			dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(peerCreds), grpc.WithKeepaliveParams(kacp),
+				grpc.WithPerRPCCredentials(peerauth.Credentials{Secret: cfg.ClusterSecret}), tracing.DialOption()}, logging.DialOptions()...)
+			conn, err := grpc.NewClient(listenAddress(peer.InternalAddress), dialOpts...)
 			if err != nil {
 				log.Fatalf("grpc: did not connect to node %s, error: %v", peer.Name, err)
 			}
 			defer conn.Close()
 
-			peerConn := proto.NewNodeServiceClient(conn)
-			srv.PeerConnections[peer.Idx] = peerConn
+			srv.AddPeer(peer.Idx, conn)
 		}
 	}
 
-	if err = s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	// the checks and the failure detector read the peer connections, so they start once all of them are added
+	go srv.RunFailureDetector(ctx)
+	go health.Watch(ctx, healthServer, srv.ReadinessChecks(), healthCheckInterval, proto.NodeService_ServiceDesc.ServiceName)
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr, srv.ReadinessChecks())
+	}
+
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+	<-ctx.Done()
+
+	drainCtx, cancel := drainContext(cfg)
+	defer cancel()
+
+	// the clients stop getting new calls first, and the peers last, as they may still write to the node
+	srv.Drain()
+	healthServer.Shutdown()
+	if err := stopGRPC(drainCtx, s); err != nil {
+		slog.Warn("Stopped serving clients with calls in flight", "error", err)
+	}
+	if err := srv.Shutdown(drainCtx); err != nil {
+		slog.Warn("Stopped before the replication finished", "error", err)
+	}
+	if err := stopGRPC(drainCtx, internal); err != nil {
+		slog.Warn("Stopped serving peers with calls in flight", "error", err)
 	}
 }
 
-func startHttpServer(db db.Database, shards *config.Shards, cfg config.Config) {
-	srv := rest.NewServer(db, shards, cfg, *env)
+// stopGRPC stops the server once its calls in flight are done, or cancels them when ctx is done first.
+func stopGRPC(ctx context.Context, s *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
+
+// startHttpServer serves the node over HTTP until ctx is done, then drains it.
+func startHttpServer(ctx context.Context, namespaces *namespace.Registry, shards *config.Shards, cfg config.Config, reloader *certs.Reloader) {
+	srv := rest.NewServer(namespaces, shards, cfg, *env)
+	if reloader != nil {
+		srv.UsePeerTLS(reloader.PeerConfig())
+	}
 
 	http.HandleFunc("/get", srv.GetHandler)
 	http.HandleFunc("/set", srv.SetHandler)
+	http.HandleFunc("/delete", srv.DeleteHandler)
+	http.HandleFunc("/scan", srv.ScanHandler)
 	// TODO adjust purge to take into account n replicas
 	http.HandleFunc("/purge", srv.DeleteExtraKeysHandler)
+	http.HandleFunc("/repair", srv.RepairHandler)
+	http.HandleFunc("/rebalance", srv.RebalanceHandler)
+	http.HandleFunc("/stats", srv.StatsHandler)
+	http.HandleFunc("/loglevel", srv.LogLevelHandler)
+	http.HandleFunc("/cluster/status", srv.ClusterStatusHandler)
+
+	if *metricsAddr != "" {
+		go serveMetrics(*metricsAddr, srv.ReadinessChecks())
+	}
+	go srv.RunFailureDetector(ctx)
+
+	// the probes are answered without credentials, the other endpoints go through auth
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", health.LiveHandler)
+	mux.HandleFunc("/readyz", health.ReadyHandler(srv.ReadinessChecks()))
+	mux.Handle("/", auth.New(cfg.Auth).Middleware(http.DefaultServeMux))
+
+	// the replica to replica requests are served on the internal address only
+	internal := &http.Server{Addr: listenAddress(shards.InternalAddrs[shards.CurrIdx]), Handler: logging.Middleware(srv.InternalHandler())}
+	public := &http.Server{Addr: *httpAddr, Handler: logging.Middleware(metrics.Middleware(tracing.Handler(mux, "coordinator")))}
+
+	if reloader != nil {
+		internal.TLSConfig = reloader.ServerConfig(cfg.TLS.MutualTLS)
+		public.TLSConfig = reloader.ServerConfig(false)
+	}
+
+	serve := func(server *http.Server) {
+		var err error
+		if reloader == nil {
+			err = server.ListenAndServe()
+		} else {
+			// the certificates come from the TLS configs, so no files are passed here
+			err = server.ListenAndServeTLS("", "")
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}
+	go serve(internal)
+	go serve(public)
+	<-ctx.Done()
+
+	drainCtx, cancel := drainContext(cfg)
+	defer cancel()
+
+	// the clients stop getting new requests first, and the peers last, as they may still write to the node
+	srv.Drain()
+	if err := public.Shutdown(drainCtx); err != nil {
+		slog.Warn("Stopped serving clients with requests in flight", "error", err)
+		public.Close()
+	}
+	if err := srv.Shutdown(drainCtx); err != nil {
+		slog.Warn("Stopped before the replication finished", "error", err)
+	}
+	if err := internal.Shutdown(drainCtx); err != nil {
+		slog.Warn("Stopped serving peers with requests in flight", "error", err)
+		internal.Close()
+	}
+}
+
+// serveMetrics serves the Prometheus metrics and the health probes on their own address, without TLS or auth,
+// so that Prometheus and the orchestrator can reach them. Do not publish the address outside the cluster network.
+func serveMetrics(addr string, checks []health.Check) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", health.LiveHandler)
+	mux.HandleFunc("/readyz", health.ReadyHandler(checks))
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
 
-	log.Fatal(http.ListenAndServe(*httpAddr, nil))
+// listenAddress keeps only the port of a shard address, so that the node listens on all interfaces.
+func listenAddress(address string) string {
+	parts := strings.Split(address, ":")
+	return fmt.Sprintf(":%s", parts[len(parts)-1])
 }
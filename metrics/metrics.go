@@ -0,0 +1,259 @@
+// Package metrics exposes the Prometheus metrics of a node: the requests it serves, the fan-out to the replicas,
+// the ordered replication batches, the size of the store and the state of the connections to the peers.
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+const (
+	HTTP = "http"
+	GRPC = "grpc"
+)
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_requests_total",
+		Help: "Requests served on the public address, by transport, operation and status code.",
+	}, []string{"transport", "operation", "code"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kv_request_duration_seconds",
+		Help:    "Latency of the requests served on the public address, by transport and operation.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"transport", "operation"})
+
+	replicaRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_replica_requests_total",
+		Help: "Requests the coordinator sent to the replicas of a key, by transport and result.",
+	}, []string{"transport", "result"})
+
+	consistencyMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_consistency_level_misses_total",
+		Help: "Requests that did not reach the consistency level, by transport and operation.",
+	}, []string{"transport", "operation"})
+
+	replicatorQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kv_replicator_queue_depth",
+		Help: "Ordered commands waiting for the next batch write.",
+	})
+
+	replicatorAppliedIndex = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kv_replicator_applied_index",
+		Help: "Delivery index of the last ordered command applied on the node.",
+	})
+
+	replicatorFlushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kv_replicator_flush_duration_seconds",
+		Help:    "Latency of the batch writes of the ordered commands.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+	})
+
+	peerUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kv_peer_up",
+		Help: "Whether the last attempt to reach a peer shard on its internal address succeeded.",
+	}, []string{"shard"})
+
+	peerPhi = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kv_peer_phi",
+		Help: "Suspicion level of the failure detector for a peer shard. The peer is suspected dead above the phi_threshold.",
+	}, []string{"shard"})
+
+	hintsPending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kv_hints_pending",
+		Help: "Writes kept for a peer shard that missed them, replayed once it is alive again.",
+	}, []string{"shard"})
+
+	peerLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kv_peer_read_latency_seconds",
+		Help: "Moving average of the latency of the reads sent to a peer shard.",
+	}, []string{"shard"})
+
+	hedgedReads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kv_hedged_reads_total",
+		Help: "Reads sent to more than one replica because the first was slow or failed, by whether another replica answered first.",
+	}, []string{"result"})
+
+	sessionWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kv_session_wait_seconds",
+		Help:    "Time the reads carrying a session token waited for a replica to catch up with it.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 9),
+	})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records a request served on the public address.
+func ObserveRequest(transport, operation, code string, took time.Duration) {
+	requests.WithLabelValues(transport, operation, code).Inc()
+	requestDuration.WithLabelValues(transport, operation).Observe(took.Seconds())
+}
+
+// ObserveReplicaRequest records the result of a request sent by the coordinator to a replica.
+func ObserveReplicaRequest(transport string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	replicaRequests.WithLabelValues(transport, result).Inc()
+}
+
+// ConsistencyMiss records a request that did not reach the consistency level.
+func ConsistencyMiss(transport, operation string) {
+	consistencyMisses.WithLabelValues(transport, operation).Inc()
+}
+
+// SetReplicatorQueueDepth records the number of ordered commands waiting for a batch write.
+func SetReplicatorQueueDepth(depth int) {
+	replicatorQueueDepth.Set(float64(depth))
+}
+
+// SetReplicatorAppliedIndex records the delivery index of the last ordered command applied on the node.
+func SetReplicatorAppliedIndex(index uint64) {
+	replicatorAppliedIndex.Set(float64(index))
+}
+
+// ObserveReplicatorFlush records the latency of a batch write of the ordered commands.
+func ObserveReplicatorFlush(took time.Duration) {
+	replicatorFlushDuration.Observe(took.Seconds())
+}
+
+// SetPeerUp records whether the peer shard could be reached.
+func SetPeerUp(shard int, up bool) {
+	value := 0.0
+	if up {
+		value = 1
+	}
+	peerUp.WithLabelValues(strconv.Itoa(shard)).Set(value)
+}
+
+// SetPeerPhi records the suspicion level of the failure detector for the peer shard.
+func SetPeerPhi(shard int, phi float64) {
+	peerPhi.WithLabelValues(strconv.Itoa(shard)).Set(phi)
+}
+
+// SetHintsPending records the number of writes kept for the peer shard.
+func SetHintsPending(shard int, pending int) {
+	hintsPending.WithLabelValues(strconv.Itoa(shard)).Set(float64(pending))
+}
+
+// SetPeerLatency records the moving average of the read latency of the peer shard.
+func SetPeerLatency(shard int, latency time.Duration) {
+	peerLatency.WithLabelValues(strconv.Itoa(shard)).Set(latency.Seconds())
+}
+
+// ObserveSessionWait records how long a read carrying a session token waited for a replica to catch up with it.
+func ObserveSessionWait(took time.Duration) {
+	sessionWait.Observe(took.Seconds())
+}
+
+// HedgedRead records a read sent to more than one replica, and whether another replica than the first answered first.
+func HedgedRead(won bool) {
+	result := "lost"
+	if won {
+		result = "won"
+	}
+	hedgedReads.WithLabelValues(result).Inc()
+}
+
+// WatchPeer keeps kv_peer_up of the shard in sync with the state of its gRPC connection until the connection is closed.
+// Idle connections count as up, they reconnect on the next call.
+func WatchPeer(shard int, conn *grpc.ClientConn) {
+	go func() {
+		for {
+			state := conn.GetState()
+			SetPeerUp(shard, state == connectivity.Ready || state == connectivity.Idle)
+			if state == connectivity.Shutdown || !conn.WaitForStateChange(context.Background(), state) {
+				return
+			}
+		}
+	}()
+}
+
+// Store is implemented by the databases that report their size on disk and the garbage collections they ran.
+type Store interface {
+	DiskSize() (int64, error)
+	GCRuns() int64
+}
+
+// RegisterStore exports the size on disk and the garbage collection runs of the store of the given engine.
+func RegisterStore(engine string, store Store) {
+	labels := prometheus.Labels{"engine": engine}
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "kv_db_size_bytes",
+		Help:        "Size of the database on disk.",
+		ConstLabels: labels,
+	}, func() float64 {
+		size, err := store.DiskSize()
+		if err != nil {
+			return 0
+		}
+		return float64(size)
+	})
+
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name:        "kv_db_gc_runs_total",
+		Help:        "Garbage collections of the database that reclaimed space.",
+		ConstLabels: labels,
+	}, func() float64 {
+		return float64(store.GCRuns())
+	})
+}
+
+// Middleware records the requests served by an HTTP handler. The operation is the request path.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		operation := path.Base(r.URL.Path)
+		if rec.status == http.StatusNotFound {
+			// unknown paths would add a series each
+			operation = "unknown"
+		}
+		ObserveRequest(HTTP, operation, strconv.Itoa(rec.status), time.Since(start))
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// ServerOptions returns the interceptors recording the gRPC calls. The operation is the method name.
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			start := time.Now()
+			resp, err := handler(ctx, req)
+			ObserveRequest(GRPC, path.Base(info.FullMethod), status.Code(err).String(), time.Since(start))
+			return resp, err
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			err := handler(srv, ss)
+			ObserveRequest(GRPC, path.Base(info.FullMethod), status.Code(err).String(), time.Since(start))
+			return err
+		}),
+	}
+}
@@ -0,0 +1,63 @@
+package metrics_test
+
+import (
+	"github.com/EliriaT/distributed-store/metrics"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/set", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFailedDependency)
+	})
+	handler := metrics.Middleware(mux)
+
+	for _, path := range []string{"/set?key=utm&value=fcim", "/does-not-exist"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t)
+	for _, want := range []string{
+		`kv_requests_total{code="424",operation="set",transport="http"} 1`,
+		`kv_requests_total{code="404",operation="unknown",transport="http"} 1`,
+		`kv_request_duration_seconds_count{operation="set",transport="http"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("The metrics miss %s", want)
+		}
+	}
+}
+
+type store struct{}
+
+func (store) DiskSize() (int64, error) { return 4096, nil }
+func (store) GCRuns() int64            { return 3 }
+
+func TestRegisterStore(t *testing.T) {
+	metrics.RegisterStore("lsm", store{})
+	metrics.SetPeerUp(2, false)
+
+	body := scrape(t)
+	for _, want := range []string{
+		`kv_db_size_bytes{engine="lsm"} 4096`,
+		`kv_db_gc_runs_total{engine="lsm"} 3`,
+		`kv_peer_up{shard="2"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("The metrics miss %s", want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Package namespace resolves the namespaces of the sharding config to their settings and the databases holding their keys.
+package namespace
+
+import (
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/db"
+)
+
+// ErrUnknown is returned for a namespace missing from the config.
+var ErrUnknown = errors.New("unknown namespace")
+
+// Namespace is a keyspace with its settings and the local database of its keys.
+type Namespace struct {
+	config.Namespace
+	DB db.Database
+}
+
+// Registry holds the namespaces of the cluster.
+type Registry struct {
+	namespaces map[string]*Namespace
+	names      []string
+}
+
+// NewRegistry opens the database of every namespace of the config, the default one included.
+func NewRegistry(database db.Database, cfg config.Config) (*Registry, error) {
+	r := &Registry{namespaces: make(map[string]*Namespace)}
+
+	for _, name := range cfg.NamespaceNames() {
+		settings, _ := cfg.GetNamespace(name)
+
+		nsDb, err := database.Namespace(name, settings.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("opening namespace %q: %w", name, err)
+		}
+
+		r.namespaces[name] = &Namespace{Namespace: settings, DB: nsDb}
+		r.names = append(r.names, name)
+	}
+
+	return r, nil
+}
+
+// Get returns the namespace. An empty name is the default namespace.
+func (r *Registry) Get(name string) (*Namespace, error) {
+	if name == "" {
+		name = config.DefaultNamespace
+	}
+
+	ns, ok := r.namespaces[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknown, name)
+	}
+	return ns, nil
+}
+
+// Default returns the default namespace.
+func (r *Registry) Default() *Namespace {
+	return r.namespaces[config.DefaultNamespace]
+}
+
+// All returns every namespace, the default one first.
+func (r *Registry) All() []*Namespace {
+	all := make([]*Namespace, len(r.names))
+	for i, name := range r.names {
+		all[i] = r.namespaces[name]
+	}
+	return all
+}
@@ -0,0 +1,106 @@
+package replication_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/namespace"
+	"github.com/EliriaT/distributed-store/replication"
+	"sync"
+	"testing"
+	"time"
+)
+
+// asyncConalg delivers the proposed commands from a goroutine of their own, like the consensus module.
+type asyncConalg struct {
+	replicator *replication.OrderedReplicator
+	wg         sync.WaitGroup
+}
+
+func (c *asyncConalg) Propose(payload []byte) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.replicator.Execute(payload)
+	}()
+}
+
+// failingDatabase fails every batch write.
+type failingDatabase struct {
+	db.Database
+}
+
+func (failingDatabase) WriteInBatch([]db.SetCommand) error {
+	return errors.New("disk full")
+}
+
+func (d failingDatabase) Namespace(name string, ttl time.Duration) (db.Database, error) {
+	database, err := d.Database.Namespace(name, ttl)
+	return failingDatabase{database}, err
+}
+
+func TestConcurrentDeliveries(t *testing.T) {
+	replicator, namespaces := createReplicator(t)
+	conalg := &asyncConalg{replicator: replicator}
+	replicator.SetConalgModule(conalg)
+
+	const writes = 500
+	var wg sync.WaitGroup
+	for i := 0; i < writes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			replicator.Replicate(context.Background(), "", fmt.Sprintf("key-%d", i), []byte(fmt.Sprint(i)))
+		}(i)
+	}
+	wg.Wait()
+	conalg.wg.Wait()
+
+	if err := replicator.Barrier(context.Background(), "", "key-0"); err != nil {
+		t.Fatalf("Barrier failed: %v", err)
+	}
+	if applied := replicator.Applied(); applied != writes+1 {
+		t.Errorf("Applied() = %d, want %d", applied, writes+1)
+	}
+	if pending, _ := replicator.Lag(); pending != 0 {
+		t.Errorf("Got %d pending commands after the barrier, want 0", pending)
+	}
+
+	ns, _ := namespaces.Get("")
+	for i := 0; i < writes; i++ {
+		if value, err := ns.DB.GetKey(fmt.Sprintf("key-%d", i)); err != nil || string(value) != fmt.Sprint(i) {
+			t.Fatalf("key-%d = %q, %v, want %d", i, value, err, i)
+		}
+	}
+}
+
+func TestFailedWriteStopsTheApplier(t *testing.T) {
+	cfg := config.Config{ReplicationFactor: 1, ConsistencyLevel: 1, Shards: []config.Shard{{Idx: 0, Name: "Chisinau"}}}
+	namespaces, err := namespace.NewRegistry(failingDatabase{createDb(t, nil)}, cfg)
+	if err != nil {
+		t.Fatalf("Could not open the namespaces: %v", err)
+	}
+	replicator := replication.NewOrderedReplicator(namespaces, &config.Shards{Count: 1, CurrIdx: 0}, cfg)
+	replicator.SetConalgModule(&orderedConalg{replicator: replicator})
+
+	replicator.Replicate(context.Background(), "", "utm", []byte("fcim"))
+	if err := replicator.Barrier(context.Background(), "", "utm"); err == nil {
+		t.Fatalf("Barrier succeeded after a failed write")
+	}
+	if replicator.Err() == nil || replicator.Ready() == nil {
+		t.Errorf("The replicator did not report the failed write: Err() = %v, Ready() = %v", replicator.Err(), replicator.Ready())
+	}
+
+	replicator.Replicate(context.Background(), "", "usm", []byte("math"))
+	if applied := replicator.Applied(); applied != 0 {
+		t.Errorf("Applied() = %d after a failed write, want 0", applied)
+	}
+	if pending, _ := replicator.Lag(); pending != 2 {
+		t.Errorf("Got %d pending commands, want the 2 not written", pending)
+	}
+	if err := replicator.Close(context.Background()); err == nil {
+		t.Errorf("Close succeeded with commands not written")
+	}
+}
@@ -0,0 +1,144 @@
+package replication_test
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/namespace"
+	"github.com/EliriaT/distributed-store/replication"
+	"testing"
+	"time"
+)
+
+// orderedConalg executes every proposed command right away, in the order of the proposals.
+type orderedConalg struct {
+	replicator *replication.OrderedReplicator
+	proposed   [][]byte
+}
+
+func (c *orderedConalg) Propose(payload []byte) {
+	c.proposed = append(c.proposed, payload)
+	c.replicator.Execute(payload)
+}
+
+// droppingConalg never executes the proposed commands.
+type droppingConalg struct{}
+
+func (droppingConalg) Propose([]byte) {}
+
+func createReplicator(t testing.TB) (*replication.OrderedReplicator, *namespace.Registry) {
+	t.Helper()
+
+	cfg := config.Config{ReplicationFactor: 1, ConsistencyLevel: 1, Shards: []config.Shard{{Idx: 0, Name: "Chisinau"}}}
+	namespaces, err := namespace.NewRegistry(createDb(t, nil), cfg)
+	if err != nil {
+		t.Fatalf("Could not open the namespaces: %v", err)
+	}
+
+	replicator := replication.NewOrderedReplicator(namespaces, &config.Shards{Count: 1, CurrIdx: 0}, cfg)
+	t.Cleanup(func() { replicator.Close(context.Background()) })
+	return replicator, namespaces
+}
+
+func TestBarrierWritesTheQueuedCommands(t *testing.T) {
+	replicator, namespaces := createReplicator(t)
+	conalg := &orderedConalg{replicator: replicator}
+	replicator.SetConalgModule(conalg)
+
+	replicator.Replicate(context.Background(), "", "utm", []byte("fcim"))
+	if pending, _ := replicator.Lag(); pending != 1 {
+		t.Fatalf("Got %d pending commands, want 1", pending)
+	}
+
+	if err := replicator.Barrier(context.Background(), "", "utm"); err != nil {
+		t.Fatalf("Barrier failed: %v", err)
+	}
+	ns, _ := namespaces.Get("")
+	if value, err := ns.DB.GetKey("utm"); err != nil || string(value) != "fcim" {
+		t.Errorf("The write ordered before the barrier is not readable: %q, %v", value, err)
+	}
+
+	if err := replicator.Barrier(context.Background(), "", "utm"); err != nil {
+		t.Fatalf("Second barrier failed: %v", err)
+	}
+	first, second := conalg.proposed[1], conalg.proposed[2]
+	if replicator.DetermineConflict(first, second) {
+		t.Errorf("Two barriers on the same key conflict")
+	}
+	if !replicator.DetermineConflict(conalg.proposed[0], first) {
+		t.Errorf("A barrier does not conflict with a write of its key")
+	}
+	write := legacyCommand("usm", "math", false)
+	if replicator.DetermineConflict(write, first) {
+		t.Errorf("A barrier conflicts with a write of another key")
+	}
+}
+
+func TestBarrierTimeout(t *testing.T) {
+	replicator, _ := createReplicator(t)
+	if err := replicator.Barrier(context.Background(), "", "utm"); err == nil {
+		t.Errorf("Barrier succeeded without a consensus module")
+	}
+
+	replicator.SetConalgModule(droppingConalg{})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := replicator.Barrier(ctx, "", "utm"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Barrier that never executed = %v, want a deadline error", err)
+	}
+
+	replicator.Close(context.Background())
+	if err := replicator.Barrier(context.Background(), "", "utm"); !errors.Is(err, replication.ErrReplicatorClosed) {
+		t.Errorf("Barrier on a closed replicator = %v, want ErrReplicatorClosed", err)
+	}
+}
+
+// switchingConalg drops the proposed commands until deliver is set.
+type switchingConalg struct {
+	orderedConalg
+	deliver bool
+}
+
+func (c *switchingConalg) Propose(payload []byte) {
+	if c.deliver {
+		c.orderedConalg.Propose(payload)
+	}
+}
+
+func TestUndeliveredProposalsFreeSlots(t *testing.T) {
+	cfg := config.Config{
+		ReplicationFactor: 1,
+		ConsistencyLevel:  1,
+		Shards:            []config.Shard{{Idx: 0, Name: "Chisinau"}},
+		Timeouts:          config.Timeouts{Write: 20 * time.Millisecond},
+	}
+	namespaces, err := namespace.NewRegistry(createDb(t, nil), cfg)
+	if err != nil {
+		t.Fatalf("Could not open the namespaces: %v", err)
+	}
+	replicator := replication.NewOrderedReplicator(namespaces, &config.Shards{Count: 1, CurrIdx: 0}, cfg)
+	t.Cleanup(func() { replicator.Close(context.Background()) })
+	conalg := &switchingConalg{orderedConalg: orderedConalg{replicator: replicator}}
+	replicator.SetConalgModule(conalg)
+
+	// more proposals than the node keeps in flight, none of them delivered
+	for i := 0; i < 2000; i++ {
+		replicator.Replicate(context.Background(), "", "utm", []byte("lost"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := replicator.Barrier(ctx, "", "utm"); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Barrier that was never delivered = %v, want it given up after the write timeout", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	conalg.deliver = true
+	replicator.Replicate(context.Background(), "", "utm", []byte("fcim"))
+	if err := replicator.Barrier(context.Background(), "", "utm"); err != nil {
+		t.Fatalf("Barrier failed after the undelivered proposals: %v", err)
+	}
+	ns, _ := namespaces.Get("")
+	if value, err := ns.DB.GetKey("utm"); err != nil || string(value) != "fcim" {
+		t.Errorf("The write after the undelivered proposals was not applied: %q, %v", value, err)
+	}
+}
@@ -0,0 +1,272 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/db"
+)
+
+// The commands proposed to the consensus module are encoded in a binary envelope:
+//
+//	magic byte | version byte | op byte | key | namespace | ID | value | reads | writes
+//
+// The key, namespace, ID and value are byte strings prefixed with their uvarint length. The reads and writes are a
+// uvarint count of keys, each its namespace and its key. A later version only appends fields, which the older nodes
+// skip, so they still read its commands. The commands proposed as JSON by the nodes predating the envelope are
+// decoded too.
+const (
+	// commandMagic starts every envelope. JSON never starts with it.
+	commandMagic = 0xc5
+	// commandVersion is the version of the envelopes the node writes.
+	commandVersion = 1
+)
+
+var errMalformedCommand = errors.New("malformed command")
+
+// op is the operation of a command.
+type op byte
+
+const (
+	opSet op = iota + 1
+	opDelete
+	opBarrier
+)
+
+// command is the payload proposed to the consensus module. A linearizable read proposes a barrier, a command
+// naming its key without changing it, which the consensus module orders after the earlier writes of the key.
+type command struct {
+	db.SetCommand
+	// ID identifies the proposal on the node that made it
+	ID      string
+	Barrier bool
+	// Reads and Writes are the keys the command reads and writes. A command declaring none, like the ones of the
+	// older nodes, reads its key when it is a barrier, and writes it otherwise.
+	Reads  []keyRef
+	Writes []keyRef
+}
+
+// legacyCommand is a command proposed as JSON by the nodes predating the envelope, with its value as a string.
+type legacyCommand struct {
+	Key       string
+	Value     string
+	Delete    bool
+	Namespace string
+	ID        string
+	Barrier   bool
+}
+
+func (c command) op() op {
+	switch {
+	case c.Barrier:
+		return opBarrier
+	case c.Delete:
+		return opDelete
+	default:
+		return opSet
+	}
+}
+
+// encode returns the envelope of the command.
+func (c command) encode() []byte {
+	payload := make([]byte, 0, 3+len(c.Key)+len(c.Namespace)+len(c.ID)+len(c.Value)+6*binary.MaxVarintLen64)
+	payload = append(payload, commandMagic, commandVersion, byte(c.op()))
+	payload = appendBytes(payload, []byte(c.Key))
+	payload = appendBytes(payload, []byte(c.Namespace))
+	payload = appendBytes(payload, []byte(c.ID))
+	payload = appendBytes(payload, c.Value)
+	payload = appendKeys(payload, c.Reads)
+	return appendKeys(payload, c.Writes)
+}
+
+func appendBytes(payload, field []byte) []byte {
+	payload = binary.AppendUvarint(payload, uint64(len(field)))
+	return append(payload, field...)
+}
+
+func appendKeys(payload []byte, keys []keyRef) []byte {
+	payload = binary.AppendUvarint(payload, uint64(len(keys)))
+	for _, k := range keys {
+		payload = appendBytes(payload, k.namespace)
+		payload = appendBytes(payload, k.key)
+	}
+	return payload
+}
+
+// keyRef is a key of a namespace.
+type keyRef struct {
+	namespace, key []byte
+}
+
+// keyOf returns the key of the namespace.
+func keyOf(namespace, key string) keyRef {
+	return keyRef{namespace: []byte(namespace), key: []byte(key)}
+}
+
+// equals reports whether the keys are the same key of the same namespace.
+func (k keyRef) equals(other keyRef) bool {
+	return bytes.Equal(k.key, other.key) && bytes.Equal(namespaceOf(k.namespace), namespaceOf(other.namespace))
+}
+
+func namespaceOf(namespace []byte) []byte {
+	if len(namespace) == 0 {
+		return []byte(config.DefaultNamespace)
+	}
+	return namespace
+}
+
+// header is an envelope read without copying, all a conflict check needs. Its byte strings point into the payload.
+type header struct {
+	op             op
+	key, namespace []byte
+	id, value      []byte
+	reads, writes  []keyRef
+}
+
+// keys returns the keys the command reads, or writes. A command declaring none reads or writes its key, returned
+// apart with true.
+func (h *header) keys(write bool) ([]keyRef, keyRef, bool) {
+	if len(h.reads) > 0 || len(h.writes) > 0 {
+		if write {
+			return h.writes, keyRef{}, false
+		}
+		return h.reads, keyRef{}, false
+	}
+	return nil, keyRef{namespace: h.namespace, key: h.key}, (h.op == opBarrier) != write
+}
+
+// touches reports whether a key the command reads, or writes, is one the other command reads, or writes.
+func (h *header) touches(write bool, other *header, otherWrite bool) bool {
+	keys, key, implied := h.keys(write)
+	otherKeys, otherKey, otherImplied := other.keys(otherWrite)
+
+	shared := func(k keyRef) bool {
+		if otherImplied && k.equals(otherKey) {
+			return true
+		}
+		for _, o := range otherKeys {
+			if k.equals(o) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if implied && shared(key) {
+		return true
+	}
+	for _, k := range keys {
+		if shared(k) {
+			return true
+		}
+	}
+	return false
+}
+
+// conflicts reports whether one command writes a key the other reads or writes. Commands only reading, like two
+// barriers, never conflict.
+func (h *header) conflicts(other *header) bool {
+	return h.touches(true, other, true) || h.touches(true, other, false) || h.touches(false, other, true)
+}
+
+// readHeader reads an envelope or a JSON command.
+func readHeader(payload []byte) (header, error) {
+	if len(payload) > 0 && payload[0] != commandMagic {
+		var proposed legacyCommand
+		if err := json.Unmarshal(payload, &proposed); err != nil {
+			return header{}, fmt.Errorf("%w: %w", errMalformedCommand, err)
+		}
+		return header{
+			op:        command{SetCommand: db.SetCommand{Delete: proposed.Delete}, Barrier: proposed.Barrier}.op(),
+			key:       []byte(proposed.Key),
+			namespace: []byte(proposed.Namespace),
+			id:        []byte(proposed.ID),
+			value:     []byte(proposed.Value),
+		}, nil
+	}
+	if len(payload) < 3 {
+		return header{}, errMalformedCommand
+	}
+
+	h := header{op: op(payload[2])}
+	rest := payload[3:]
+	var err error
+	if h.key, rest, err = readBytes(rest); err != nil {
+		return header{}, err
+	}
+	if h.namespace, rest, err = readBytes(rest); err != nil {
+		return header{}, err
+	}
+	if h.id, rest, err = readBytes(rest); err != nil {
+		return header{}, err
+	}
+	if h.value, rest, err = readBytes(rest); err != nil {
+		return header{}, err
+	}
+
+	if h.reads, rest, err = readKeys(rest); err != nil {
+		return header{}, err
+	}
+	if h.writes, _, err = readKeys(rest); err != nil {
+		return header{}, err
+	}
+	// the fields a later version appends are skipped
+	return h, nil
+}
+
+func readBytes(payload []byte) ([]byte, []byte, error) {
+	length, n := binary.Uvarint(payload)
+	if n <= 0 || uint64(len(payload)-n) < length {
+		return nil, nil, errMalformedCommand
+	}
+	return payload[n : n+int(length)], payload[n+int(length):], nil
+}
+
+func readKeys(payload []byte) ([]keyRef, []byte, error) {
+	count, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return nil, nil, errMalformedCommand
+	}
+	rest := payload[n:]
+	// every key takes at least 2 bytes, which bounds the count of a malformed envelope
+	if count > uint64(len(rest))/2 {
+		return nil, nil, errMalformedCommand
+	}
+
+	var keys []keyRef
+	for i := uint64(0); i < count; i++ {
+		var k keyRef
+		var err error
+		if k.namespace, rest, err = readBytes(rest); err != nil {
+			return nil, nil, err
+		}
+		if k.key, rest, err = readBytes(rest); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rest, nil
+}
+
+// decodeCommand decodes a payload proposed to the consensus module, an envelope or a JSON command. The value is
+// copied, as the consensus module owns the payload.
+func decodeCommand(payload []byte) (command, error) {
+	h, err := readHeader(payload)
+	if err != nil {
+		return command{}, err
+	}
+	if h.op < opSet || h.op > opBarrier {
+		return command{}, fmt.Errorf("%w: unknown operation %d", errMalformedCommand, h.op)
+	}
+
+	return command{
+		SetCommand: db.SetCommand{Key: string(h.key), Value: bytes.Clone(h.value), Delete: h.op == opDelete, Namespace: string(h.namespace)},
+		ID:         string(h.id),
+		Barrier:    h.op == opBarrier,
+		Reads:      h.reads,
+		Writes:     h.writes,
+	}, nil
+}
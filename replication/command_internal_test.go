@@ -0,0 +1,77 @@
+package replication
+
+import (
+	"github.com/EliriaT/distributed-store/db"
+	"reflect"
+	"testing"
+)
+
+func TestCommandRoundTrip(t *testing.T) {
+	// a decoded value is never nil, even an empty one
+	commands := []command{
+		{SetCommand: db.SetCommand{Key: "utm", Value: []byte("fcim \x00\xff"), Namespace: "sessions"}, ID: "1"},
+		{SetCommand: db.SetCommand{Key: "utm", Value: []byte{}, Delete: true}, ID: "2", Writes: []keyRef{keyOf("", "utm")}},
+		{SetCommand: db.SetCommand{Key: "utm", Value: []byte{}}, ID: "3", Barrier: true, Reads: []keyRef{keyOf("", "utm")}},
+		{
+			SetCommand: db.SetCommand{Key: "a:1", Value: []byte("1")},
+			Reads:      []keyRef{keyOf("", "a:1"), keyOf("sessions", "a:2")},
+			Writes:     []keyRef{keyOf("", "user:42"), keyOf("", "")},
+		},
+	}
+	for _, proposed := range commands {
+		decoded, err := decodeCommand(proposed.encode())
+		if err != nil {
+			t.Fatalf("Could not decode %+v: %v", proposed, err)
+		}
+		if !reflect.DeepEqual(decoded, proposed) {
+			t.Errorf("Decoded %+v, want %+v", decoded, proposed)
+		}
+	}
+
+	payload := commands[3].encode()
+	for n := 0; n < len(payload); n++ {
+		if _, err := readHeader(payload[:n]); err == nil {
+			t.Errorf("The command truncated to %d bytes was read", n)
+		}
+	}
+}
+
+func TestDeclaredKeyConflicts(t *testing.T) {
+	replicator := &OrderedReplicator{}
+	set := func(key string) []byte {
+		return command{SetCommand: db.SetCommand{Key: key}, Writes: []keyRef{keyOf("", key)}}.encode()
+	}
+	writes := func(keys ...keyRef) []byte { return command{Writes: keys}.encode() }
+	reads := func(keys ...keyRef) []byte { return command{Barrier: true, Reads: keys}.encode() }
+	transaction := command{Reads: []keyRef{keyOf("", "a:1")}, Writes: []keyRef{keyOf("", "b:1")}}.encode()
+	implied := command{SetCommand: db.SetCommand{Key: "user:42"}}.encode()
+	// a count of writes far past the end of the envelope
+	empty := command{}.encode()
+	malformed := append(empty[:len(empty)-1], 0xff, 0x7f)
+
+	tests := []struct {
+		name     string
+		c1, c2   []byte
+		conflict bool
+	}{
+		{"writes of several keys and one of them", writes(keyOf("", "user:41"), keyOf("", "user:42")), set("user:42"), true},
+		{"writes of several keys and another key", writes(keyOf("", "user:41"), keyOf("", "user:42")), set("city:1"), false},
+		{"a key and its prefix", writes(keyOf("", "user:")), set("user:42"), false},
+		{"keys read only", reads(keyOf("", "a")), reads(keyOf("", "a")), false},
+		{"a write of a key a transaction reads", transaction, set("a:1"), true},
+		{"a write of a key a transaction writes", transaction, set("b:1"), true},
+		{"a read of a key a transaction reads", transaction, reads(keyOf("", "a:1")), false},
+		{"a key of another namespace", writes(keyOf("sessions", "user:42")), set("user:42"), false},
+		{"the default namespace named", writes(keyOf("default", "user:42")), set("user:42"), true},
+		{"a command declaring no key", writes(keyOf("", "user:42")), implied, true},
+		{"a malformed key count", malformed, set("user:42"), true},
+	}
+	for _, tt := range tests {
+		if got := replicator.DetermineConflict(tt.c1, tt.c2); got != tt.conflict {
+			t.Errorf("%s: DetermineConflict = %v, want %v", tt.name, got, tt.conflict)
+		}
+		if got := replicator.DetermineConflict(tt.c2, tt.c1); got != tt.conflict {
+			t.Errorf("%s, swapped: DetermineConflict = %v, want %v", tt.name, got, tt.conflict)
+		}
+	}
+}
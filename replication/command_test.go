@@ -0,0 +1,106 @@
+package replication_test
+
+import (
+	"context"
+	"github.com/EliriaT/distributed-store/replication"
+	"strings"
+	"testing"
+)
+
+// capturingConalg keeps the proposed commands without executing them.
+type capturingConalg struct {
+	proposed [][]byte
+}
+
+func (c *capturingConalg) Propose(payload []byte) {
+	c.proposed = append(c.proposed, payload)
+}
+
+// propose returns the payloads the replicator proposes for a set and a delete of the key.
+func propose(t testing.TB, namespace, key, value string) (set, del []byte) {
+	t.Helper()
+
+	replicator, _ := createReplicator(t)
+	conalg := &capturingConalg{}
+	replicator.SetConalgModule(conalg)
+	replicator.Replicate(context.Background(), namespace, key, []byte(value))
+	replicator.ReplicateDelete(context.Background(), namespace, key)
+	return conalg.proposed[0], conalg.proposed[1]
+}
+
+func TestCommandEncoding(t *testing.T) {
+	value := "fcim \x00\xff" + strings.Repeat("v", 300)
+	set, del := propose(t, "", "utm", value)
+	if set[0] == '{' {
+		t.Fatalf("The command was proposed as JSON: %q", set)
+	}
+
+	replicator, namespaces := createReplicator(t)
+	replicator.SetConalgModule(&orderedConalg{replicator: replicator})
+	replicator.Execute(set)
+	if err := replicator.Barrier(context.Background(), "", "utm"); err != nil {
+		t.Fatalf("Barrier failed: %v", err)
+	}
+	ns, _ := namespaces.Get("")
+	if got, err := ns.DB.GetKey("utm"); err != nil || string(got) != value {
+		t.Fatalf("The set was applied as %q, %v", got, err)
+	}
+
+	// a later version appending a field is still read
+	next := append([]byte{set[0], set[1] + 1}, set[2:]...)
+	next = append(next, 0x05, 'x', 'y', 'z')
+	replicator.Execute(del)
+	replicator.Execute(next)
+	if err := replicator.Barrier(context.Background(), "", "utm"); err != nil {
+		t.Fatalf("Barrier failed: %v", err)
+	}
+	if got, err := ns.DB.GetKey("utm"); err != nil || string(got) != value {
+		t.Errorf("The command of a later version was applied as %q, %v", got, err)
+	}
+	if applied := replicator.Applied(); applied != 5 {
+		t.Errorf("Applied() = %d, want 5", applied)
+	}
+
+	legacy := legacyCommand("utm", "math", false)
+	if !replicator.DetermineConflict(set, del) || !replicator.DetermineConflict(set, legacy) {
+		t.Errorf("Commands of the same key do not conflict")
+	}
+	other, _ := propose(t, "sessions", "utm", value)
+	if replicator.DetermineConflict(set, other) {
+		t.Errorf("Commands of the same key in other namespaces conflict")
+	}
+	explicit, _ := propose(t, "default", "utm", value)
+	if !replicator.DetermineConflict(set, explicit) {
+		t.Errorf("The default namespace named explicitly does not conflict with the empty one")
+	}
+
+	truncated := set[:len(set)-10]
+	if !replicator.DetermineConflict(truncated[:4], set) {
+		t.Errorf("A truncated command does not conflict")
+	}
+	replicator.Execute(truncated)
+	if applied := replicator.Applied(); applied != 5 {
+		t.Errorf("A truncated command was applied")
+	}
+}
+
+func BenchmarkDetermineConflict(b *testing.B) {
+	value := strings.Repeat("v", 1024)
+	set, del := propose(b, "", "user:42", value)
+	legacySet := legacyCommand("user:42", value, false)
+	legacyDel := legacyCommand("user:42", "", true)
+
+	replicator := &replication.OrderedReplicator{}
+	b.Run("binary", func(b *testing.B) {
+		b.ReportMetric(float64(len(set)), "payload-bytes")
+		for i := 0; i < b.N; i++ {
+			replicator.DetermineConflict(set, del)
+		}
+	})
+	b.Run("json", func(b *testing.B) {
+		b.ReportMetric(float64(len(legacySet)), "payload-bytes")
+		for i := 0; i < b.N; i++ {
+			replicator.DetermineConflict(legacySet, legacyDel)
+		}
+	})
+}
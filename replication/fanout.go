@@ -0,0 +1,121 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+)
+
+// ErrStopping is returned for a write starting once the node stops.
+var ErrStopping = errors.New("the node is stopping")
+
+// Fanouts tracks the writes to the replicas still running, so that a stopping node waits for them. Once it is
+// closed no new write starts, as the writes must not be added to the ones waited for.
+type Fanouts struct {
+	mu      sync.Mutex
+	closed  bool
+	running sync.WaitGroup
+}
+
+// Begin adds n writes to the running ones, each calling Done once it ends. It fails with ErrStopping once the
+// fan-outs are closed.
+func (f *Fanouts) Begin(n int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return ErrStopping
+	}
+	f.running.Add(n)
+	return nil
+}
+
+// Done ends a write added with Begin.
+func (f *Fanouts) Done() {
+	f.running.Done()
+}
+
+// Close stops new writes from starting, and waits for the running ones until ctx is done.
+func (f *Fanouts) Close(ctx context.Context) error {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		f.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Replicate runs write for every replica shard in parallel. It returns once the acknowledgements are met, every
+// replica answered or ctx is done, with the shards that acknowledged the write and the ones hints were kept for.
+// The error is the last one seen when the acknowledgements are not met, and nil otherwise. Writes waiting only
+// for the coordinator shard return with the error of the local write. ended is called with the result of every
+// write once it ends, also for the writes still running after Replicate returned.
+func (f *Fanouts) Replicate(ctx context.Context, acks Acks, coordinator int, shards []int, write func(ctx context.Context, shard int) error, ended func(shard int, err error)) (replicatedOn, hintedOn []int, err error) {
+	type result struct {
+		shard int
+		err   error
+	}
+
+	if err := f.Begin(len(shards)); err != nil {
+		return nil, nil, err
+	}
+
+	// the writes past the acknowledgements go on after Replicate returns, so they must not be cancelled with ctx
+	detached := tracing.Detach(ctx)
+
+	results := make(chan result, len(shards))
+	for _, shard := range shards {
+		go func(shard int) {
+			defer f.Done()
+
+			ctx, span := tracing.Start(detached, "replica write", trace.WithAttributes(attribute.Int("shard", shard)))
+			err := write(ctx, shard)
+			tracing.End(span, err)
+			ended(shard, err)
+			results <- result{shard: shard, err: err}
+		}(shard)
+	}
+
+	replicatedOn = make([]int, 0, len(shards))
+
+	for range shards {
+		var res result
+		select {
+		case res = <-results:
+		case <-ctx.Done():
+			// the writes still running complete in the background
+			return replicatedOn, hintedOn, ctx.Err()
+		}
+
+		switch {
+		case res.err == nil:
+			replicatedOn = append(replicatedOn, res.shard)
+		case errors.Is(res.err, ErrHinted):
+			hintedOn = append(hintedOn, res.shard)
+			err = res.err
+		default:
+			err = res.err
+		}
+
+		if acks.Local && res.shard == coordinator {
+			return replicatedOn, hintedOn, res.err
+		}
+		if !acks.Local && acks.Met(len(replicatedOn), len(hintedOn)) {
+			return replicatedOn, hintedOn, nil
+		}
+	}
+
+	return replicatedOn, hintedOn, err
+}
@@ -0,0 +1,71 @@
+package replication_test
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/replication"
+	"testing"
+	"time"
+)
+
+func TestFanoutsClose(t *testing.T) {
+	var fanouts replication.Fanouts
+	if err := fanouts.Begin(2); err != nil {
+		t.Fatalf("Could not begin the writes: %v", err)
+	}
+	fanouts.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := fanouts.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close = %v with a write running, want the context error", err)
+	}
+	if err := fanouts.Begin(1); !errors.Is(err, replication.ErrStopping) {
+		t.Errorf("Begin = %v once closed, want ErrStopping", err)
+	}
+
+	fanouts.Done()
+	if err := fanouts.Close(context.Background()); err != nil {
+		t.Errorf("Close = %v once the writes ended", err)
+	}
+}
+
+func TestFanoutsReplicate(t *testing.T) {
+	refused := errors.New("connection refused")
+	write := func(failing ...int) func(context.Context, int) error {
+		return func(_ context.Context, shard int) error {
+			for _, f := range failing {
+				if f == shard {
+					return refused
+				}
+			}
+			return nil
+		}
+	}
+	ended := func(int, error) {}
+
+	tests := []struct {
+		name       string
+		acks       replication.Acks
+		write      func(context.Context, int) error
+		replicated int
+		err        error
+	}{
+		{"every replica stored the write", replication.Acks{Replicas: 2}, write(), 2, nil},
+		{"the acknowledgements met after a failure", replication.Acks{Replicas: 2}, write(0), 2, nil},
+		{"the acknowledgements not met", replication.Acks{Replicas: 2}, write(0, 1), 1, refused},
+		// the other replicas may still be running
+		{"the coordinator failed", replication.Acks{Local: true}, write(1), -1, refused},
+	}
+	for _, tt := range tests {
+		var fanouts replication.Fanouts
+		replicatedOn, _, err := fanouts.Replicate(context.Background(), tt.acks, 1, []int{0, 1, 2}, tt.write, ended)
+		if err != tt.err {
+			t.Errorf("%s: Replicate error = %v, want %v", tt.name, err, tt.err)
+		}
+		if tt.replicated >= 0 && len(replicatedOn) != tt.replicated {
+			t.Errorf("%s: Replicated on %v, want %d shards", tt.name, replicatedOn, tt.replicated)
+		}
+		fanouts.Close(context.Background())
+	}
+}
@@ -0,0 +1,211 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/metrics"
+	"log/slog"
+	"sync"
+)
+
+// MaxHints is the number of keys the coordinator keeps hints for, per replica. The hints past it are dropped,
+// and the replica catches up on those keys with a repair.
+const MaxHints = 10000
+
+// Hint is a write a replica missed, kept by the coordinator until the replica is back.
+type Hint = db.SetCommand
+
+type hintKey struct {
+	namespace string
+	key       string
+}
+
+// busyKey is a key being written on a replica, by a replay or by a new write.
+type busyKey struct {
+	shard int
+	hintKey
+}
+
+// hinted is a hint with the position of the oldest write of its key the replica missed, and the number telling
+// it apart from the other hints of its key.
+type hinted struct {
+	hint Hint
+	at   uint64
+	seq  uint64
+}
+
+// Hints keeps the writes the replicas missed, the last one of every key, in memory. A key is written on a replica
+// by one replay or new write at a time, so that a hint replayed never lands after a newer write of its key.
+type Hints struct {
+	mu      sync.Mutex
+	pending map[int]map[hintKey]hinted
+	seq     uint64
+	// busy holds the keys being written on the replicas, with a channel closed once the write is done
+	busy map[busyKey]chan struct{}
+}
+
+func NewHints() *Hints {
+	return &Hints{pending: make(map[int]map[hintKey]hinted), busy: make(map[busyKey]chan struct{})}
+}
+
+// acquire waits until no other replay or write of the key on the replica shard runs, or until ctx is done.
+func (h *Hints) acquire(ctx context.Context, key busyKey) error {
+	for {
+		h.mu.Lock()
+		released, busy := h.busy[key]
+		if !busy {
+			h.busy[key] = make(chan struct{})
+			h.mu.Unlock()
+			return nil
+		}
+		h.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release lets the other replays and writes of the key on the replica shard run. The caller holds mu.
+func (h *Hints) release(key busyKey) {
+	close(h.busy[key])
+	delete(h.busy, key)
+}
+
+// Write writes a key on the replica shard with write, once no other replay or write of the key runs. When the write
+// succeeds, the hint kept for the key is dropped, as it is older. When it fails, the write is kept as a hint before
+// the key is released, unless keep reports false for the error, and the error returned then wraps ErrHinted. at is
+// the position of the write, kept with the hint. A write that could not start before ctx is done is not kept, as an
+// older hint could be replayed after it, and the replica catches up on it with a repair.
+func (h *Hints) Write(ctx context.Context, shard int, hint Hint, at uint64, keep func(error) bool, write func(ctx context.Context) error) error {
+	key := busyKey{shard: shard, hintKey: hintKey{namespace: namespaceName(hint), key: hint.Key}}
+	if err := h.acquire(ctx, key); err != nil {
+		return err
+	}
+
+	err := write(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	defer h.release(key)
+
+	switch {
+	case err == nil:
+		if _, ok := h.pending[shard][key.hintKey]; ok {
+			delete(h.pending[shard], key.hintKey)
+			metrics.SetHintsPending(shard, len(h.pending[shard]))
+		}
+		return nil
+	case !keep(err):
+		return err
+	case !h.add(shard, hint, at):
+		slog.WarnContext(ctx, "Dropped a hint, the replica has too many", "key", hint.Key, "replica", shard)
+		return err
+	default:
+		return fmt.Errorf("%w: %w", ErrHinted, err)
+	}
+}
+
+// Add keeps the write for the replica shard, replacing an older hint of the same key. at is the position of the write
+// on the clock of the coordinator, and the hint keeps the position of the oldest write it replaced.
+// It reports false when the replica has too many hints already.
+func (h *Hints) Add(shard int, hint Hint, at uint64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.add(shard, hint, at)
+}
+
+// add is Add for a caller holding mu.
+func (h *Hints) add(shard int, hint Hint, at uint64) bool {
+	hints, ok := h.pending[shard]
+	if !ok {
+		hints = make(map[hintKey]hinted)
+		h.pending[shard] = hints
+	}
+
+	key := hintKey{namespace: namespaceName(hint), key: hint.Key}
+	older, ok := hints[key]
+	if !ok && len(hints) >= MaxHints {
+		return false
+	}
+	if ok {
+		at = min(at, older.at)
+	}
+	h.seq++
+	hints[key] = hinted{hint: hint, at: at, seq: h.seq}
+	metrics.SetHintsPending(shard, len(hints))
+	return true
+}
+
+// Oldest returns the position of the oldest write kept for the replica shard, and false when it has no hints.
+func (h *Hints) Oldest(shard int) (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var oldest uint64
+	for _, hinted := range h.pending[shard] {
+		if oldest == 0 || hinted.at < oldest {
+			oldest = hinted.at
+		}
+	}
+	return oldest, len(h.pending[shard]) > 0
+}
+
+// Pending returns the number of hints kept for the replica shard.
+func (h *Hints) Pending(shard int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.pending[shard])
+}
+
+// Replay writes the hints of the replica shard with write, and forgets the ones written. A hint replaced or dropped
+// before it is written is skipped, and one replaced while it was written is kept. It stops once ctx is done, and
+// returns the number of hints written and the last error.
+func (h *Hints) Replay(ctx context.Context, shard int, write func(hint Hint) error) (int, error) {
+	h.mu.Lock()
+	keys := make([]hintKey, 0, len(h.pending[shard]))
+	for key := range h.pending[shard] {
+		keys = append(keys, key)
+	}
+	h.mu.Unlock()
+
+	replayed := 0
+	var lastErr error
+	for _, key := range keys {
+		busy := busyKey{shard: shard, hintKey: key}
+		if err := h.acquire(ctx, busy); err != nil {
+			return replayed, err
+		}
+
+		h.mu.Lock()
+		hint, ok := h.pending[shard][key]
+		h.mu.Unlock()
+
+		var err error
+		if ok {
+			err = write(hint.hint)
+		}
+
+		h.mu.Lock()
+		switch {
+		case !ok:
+		case err != nil:
+			lastErr = err
+		default:
+			replayed++
+			if h.pending[shard][key].seq == hint.seq {
+				delete(h.pending[shard], key)
+			}
+			metrics.SetHintsPending(shard, len(h.pending[shard]))
+		}
+		h.release(busy)
+		h.mu.Unlock()
+	}
+
+	return replayed, lastErr
+}
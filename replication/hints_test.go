@@ -0,0 +1,220 @@
+package replication_test
+
+import (
+	"context"
+	"errors"
+	"github.com/EliriaT/distributed-store/replication"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHints(t *testing.T) {
+	hints := replication.NewHints()
+
+	hints.Add(1, replication.Hint{Key: "utm", Value: []byte("fcim")}, 10)
+	hints.Add(1, replication.Hint{Key: "utm", Value: []byte("fcim-2")}, 20)
+	hints.Add(1, replication.Hint{Key: "usm", Value: []byte("math")}, 30)
+	hints.Add(2, replication.Hint{Key: "utm", Delete: true}, 40)
+	if hints.Pending(1) != 2 || hints.Pending(2) != 1 {
+		t.Fatalf("Pending = %d and %d, want 2 and 1", hints.Pending(1), hints.Pending(2))
+	}
+
+	written := make(map[string]string)
+	replayed, err := hints.Replay(context.Background(), 1, func(hint replication.Hint) error {
+		if hint.Key == "usm" {
+			return errors.New("connection refused")
+		}
+		written[hint.Key] = string(hint.Value)
+		return nil
+	})
+	if replayed != 1 || err == nil {
+		t.Errorf("Replay = %d, %v, want 1 and the failed write", replayed, err)
+	}
+	if written["utm"] != "fcim-2" {
+		t.Errorf("The last write of the key was not replayed: %v", written)
+	}
+	if hints.Pending(1) != 1 {
+		t.Errorf("The failed hint was not kept: %d pending", hints.Pending(1))
+	}
+	if oldest, ok := hints.Oldest(1); !ok || oldest != 30 {
+		t.Errorf("Oldest = %d, %t, want the position of the failed hint", oldest, ok)
+	}
+	if oldest, _ := hints.Oldest(2); oldest != 40 {
+		t.Errorf("Oldest of another replica = %d, want 40", oldest)
+	}
+	if _, ok := hints.Oldest(3); ok {
+		t.Errorf("A replica without hints has an oldest hint")
+	}
+}
+
+func TestHintsLimit(t *testing.T) {
+	hints := replication.NewHints()
+
+	for i := 0; i < replication.MaxHints; i++ {
+		if !hints.Add(1, replication.Hint{Key: string(rune(i))}, 1) {
+			t.Fatalf("Hint %d was dropped below the limit", i)
+		}
+	}
+	if hints.Add(1, replication.Hint{Key: "past-the-limit"}, 1) {
+		t.Errorf("A hint past the limit was kept")
+	}
+	if !hints.Add(1, replication.Hint{Key: string(rune(0)), Value: []byte("newer")}, 2) {
+		t.Errorf("A hint of a known key was dropped at the limit")
+	}
+}
+
+// keepAll keeps every failed write as a hint.
+func keepAll(error) bool { return true }
+
+func TestHintsNewerWrite(t *testing.T) {
+	hints := replication.NewHints()
+	replica := make(map[string]string)
+	write := func(hint replication.Hint) func(context.Context) error {
+		return func(context.Context) error {
+			replica[hint.Key] = string(hint.Value)
+			return nil
+		}
+	}
+
+	// the first write fails and is hinted, the newer one reaches the replica
+	older := replication.Hint{Key: "utm", Value: []byte("fcim")}
+	err := hints.Write(context.Background(), 1, older, 10, keepAll, func(context.Context) error { return errors.New("connection refused") })
+	if !errors.Is(err, replication.ErrHinted) || hints.Pending(1) != 1 {
+		t.Fatalf("The failed write was not hinted: %v, %d pending", err, hints.Pending(1))
+	}
+	newer := replication.Hint{Key: "utm", Value: []byte("fcim-2")}
+	if err := hints.Write(context.Background(), 1, newer, 20, keepAll, write(newer)); err != nil {
+		t.Fatalf("Could not write: %v", err)
+	}
+	if hints.Pending(1) != 0 {
+		t.Errorf("The older hint was kept after a newer write: %d pending", hints.Pending(1))
+	}
+
+	replayed, err := hints.Replay(context.Background(), 1, func(hint replication.Hint) error { return write(hint)(context.Background()) })
+	if replayed != 0 || err != nil || replica["utm"] != "fcim-2" {
+		t.Errorf("Replay = %d, %v, the replica has %q, want the newer write kept", replayed, err, replica["utm"])
+	}
+
+	refused := errors.New("over quota")
+	err = hints.Write(context.Background(), 1, older, 30, func(err error) bool { return err != refused }, func(context.Context) error { return refused })
+	if err != refused || hints.Pending(1) != 0 {
+		t.Errorf("A write refused for good was hinted: %v, %d pending", err, hints.Pending(1))
+	}
+}
+
+func TestHintsNewerWriteAfterFailure(t *testing.T) {
+	hints := replication.NewHints()
+	failing := make(chan struct{})
+	fail := make(chan struct{})
+
+	failed := make(chan error)
+	go func() {
+		failed <- hints.Write(context.Background(), 1, replication.Hint{Key: "utm", Value: []byte("fcim")}, 10, keepAll, func(context.Context) error {
+			close(failing)
+			<-fail
+			return errors.New("connection refused")
+		})
+	}()
+
+	// the newer write starts while the older one fails, and must find its hint once it runs
+	<-failing
+	written := make(chan error)
+	go func() {
+		written <- hints.Write(context.Background(), 1, replication.Hint{Key: "utm", Value: []byte("fcim-2")}, 20, keepAll, func(context.Context) error {
+			return nil
+		})
+	}()
+	close(fail)
+
+	if err := <-failed; !errors.Is(err, replication.ErrHinted) {
+		t.Errorf("The failed write was not hinted: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("Could not write: %v", err)
+	}
+	if hints.Pending(1) != 0 {
+		t.Errorf("The hint of the older write was kept after the newer write: %d pending", hints.Pending(1))
+	}
+}
+
+func TestHintsWriteCancelled(t *testing.T) {
+	hints := replication.NewHints()
+	proceed := make(chan struct{})
+	writing := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hints.Write(context.Background(), 1, replication.Hint{Key: "utm", Value: []byte("fcim")}, 10, keepAll, func(context.Context) error {
+			close(writing)
+			<-proceed
+			return nil
+		})
+	}()
+	<-writing
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	called := false
+	err := hints.Write(ctx, 1, replication.Hint{Key: "utm", Value: []byte("fcim-2")}, 20, keepAll, func(context.Context) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || called {
+		t.Errorf("Write waiting for a busy key = %v, written %t, want it given up with the context", err, called)
+	}
+	if hints.Pending(1) != 0 {
+		t.Errorf("A write given up before it started was hinted")
+	}
+
+	close(proceed)
+	<-done
+}
+
+func TestHintsWriteDuringReplay(t *testing.T) {
+	hints := replication.NewHints()
+	hints.Add(1, replication.Hint{Key: "utm", Value: []byte("fcim")}, 10)
+
+	var mu sync.Mutex
+	var writes []string
+	replaying := make(chan struct{})
+	proceed := make(chan struct{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hints.Replay(context.Background(), 1, func(hint replication.Hint) error {
+			close(replaying)
+			<-proceed
+			mu.Lock()
+			writes = append(writes, string(hint.Value))
+			mu.Unlock()
+			return nil
+		})
+	}()
+
+	<-replaying
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		hints.Write(context.Background(), 1, replication.Hint{Key: "utm", Value: []byte("fcim-2")}, 20, keepAll, func(context.Context) error {
+			mu.Lock()
+			writes = append(writes, "fcim-2")
+			mu.Unlock()
+			return nil
+		})
+	}()
+
+	select {
+	case <-written:
+		t.Fatalf("The newer write did not wait for the replay of its key")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(proceed)
+	<-done
+	<-written
+
+	if len(writes) != 2 || writes[1] != "fcim-2" {
+		t.Errorf("Writes = %v, want the newer write last", writes)
+	}
+}
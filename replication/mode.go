@@ -0,0 +1,121 @@
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// WriteMode tells a coordinator what a write waits for before it is acknowledged.
+type WriteMode string
+
+const (
+	// ModeDefault waits for the consistency level of the namespace.
+	ModeDefault WriteMode = ""
+	// ModeOne, ModeQuorum and ModeAll wait for one replica, a majority of the replicas or all of them.
+	ModeOne    WriteMode = "one"
+	ModeQuorum WriteMode = "quorum"
+	ModeAll    WriteMode = "all"
+	// ModeAsync waits only for the write on the coordinator, when it is a replica of the key, and writes the other
+	// replicas in the background, keeping hints for the ones that miss it. A coordinator that is not a replica waits
+	// as for ModeAny.
+	ModeAsync WriteMode = "async"
+	// ModeAny waits for one replica, a hint kept for a replica that missed the write counting as one.
+	// The write is accepted even when all the replicas are down, but then it is not durable.
+	ModeAny WriteMode = "any"
+)
+
+// The durability reported for a write.
+const (
+	// DurabilityReplicated means the replicas the mode waits for stored the write.
+	DurabilityReplicated = "replicated"
+	// DurabilityHinted means fewer replicas stored the write, and the coordinator keeps hints for the others.
+	// The hints are kept in memory only, so the write is not durable: it is lost if the coordinator stops before
+	// a replica stores it.
+	DurabilityHinted = "hinted"
+	// DurabilityAccepted means the coordinator, a replica of the key, stored the write, and the other replicas are
+	// written in the background.
+	DurabilityAccepted = "accepted"
+	// DurabilityFailed means the write did not reach what the mode waits for.
+	DurabilityFailed = "failed"
+)
+
+// ErrHinted wraps the failed writes to a replica for which the coordinator keeps a hint.
+var ErrHinted = errors.New("kept as a hint")
+
+// ParseWriteMode returns the mode named by a request, ModeDefault when the name is empty.
+func ParseWriteMode(name string) (WriteMode, error) {
+	mode := WriteMode(strings.ToLower(name))
+	switch mode {
+	case ModeDefault, ModeOne, ModeQuorum, ModeAll, ModeAsync, ModeAny:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unsupported write mode %q. Allowed: one/quorum/all/async/any", name)
+}
+
+// String returns the name of the mode, "default" for ModeDefault.
+func (m WriteMode) String() string {
+	if m == ModeDefault {
+		return "default"
+	}
+	return string(m)
+}
+
+// Acks is what a write waits for before the coordinator answers.
+type Acks struct {
+	// Replicas is the number of replicas that must acknowledge the write.
+	Replicas int
+	// Hints counts the hints kept for the replicas that missed the write as acknowledgements.
+	Hints bool
+	// Local waits only for the write on the coordinator, the other replicas being written in the background.
+	Local bool
+}
+
+// Acks resolves the mode against the replication factor and consistency level of a namespace.
+func (m WriteMode) Acks(replicationFactor, consistencyLevel int) Acks {
+	switch m {
+	case ModeOne:
+		return Acks{Replicas: 1}
+	case ModeQuorum:
+		return Acks{Replicas: replicationFactor/2 + 1}
+	case ModeAll:
+		return Acks{Replicas: replicationFactor}
+	case ModeAsync:
+		return Acks{Local: true}
+	case ModeAny:
+		return Acks{Replicas: 1, Hints: true}
+	}
+	return Acks{Replicas: consistencyLevel}
+}
+
+// Coordinated resolves the acknowledgements for a coordinator that is a replica of the key or not. A coordinator that
+// is not one stores nothing itself, so a write waiting only for it waits to be stored on a replica or kept as a hint.
+func (a Acks) Coordinated(onReplica bool) Acks {
+	if a.Local && !onReplica {
+		return Acks{Replicas: 1, Hints: true}
+	}
+	return a
+}
+
+// Met reports whether the acknowledgements of a write are enough.
+func (a Acks) Met(replicated, hinted int) bool {
+	if a.Hints {
+		replicated += hinted
+	}
+	return replicated >= a.Replicas
+}
+
+// Durability returns what a write reached, given the replicas that stored it and the ones hints were kept for.
+func (a Acks) Durability(replicated, hinted int, err error) string {
+	switch {
+	case a.Local && err == nil:
+		return DurabilityAccepted
+	case a.Local:
+		return DurabilityFailed
+	case replicated >= a.Replicas:
+		return DurabilityReplicated
+	case a.Met(replicated, hinted):
+		return DurabilityHinted
+	}
+	return DurabilityFailed
+}
@@ -0,0 +1,99 @@
+package replication_test
+
+import (
+	"errors"
+	"github.com/EliriaT/distributed-store/replication"
+	"testing"
+)
+
+func TestParseWriteMode(t *testing.T) {
+	for name, want := range map[string]replication.WriteMode{
+		"":       replication.ModeDefault,
+		"one":    replication.ModeOne,
+		"QUORUM": replication.ModeQuorum,
+		"async":  replication.ModeAsync,
+		"any":    replication.ModeAny,
+	} {
+		mode, err := replication.ParseWriteMode(name)
+		if err != nil || mode != want {
+			t.Errorf("ParseWriteMode(%q) = %q, %v, want %q", name, mode, err, want)
+		}
+	}
+
+	if _, err := replication.ParseWriteMode("twice"); err == nil {
+		t.Errorf("An unknown write mode was accepted")
+	}
+}
+
+func TestWriteModeAcks(t *testing.T) {
+	tests := []struct {
+		mode replication.WriteMode
+		want replication.Acks
+	}{
+		{replication.ModeDefault, replication.Acks{Replicas: 2}},
+		{replication.ModeOne, replication.Acks{Replicas: 1}},
+		{replication.ModeQuorum, replication.Acks{Replicas: 2}},
+		{replication.ModeAll, replication.Acks{Replicas: 3}},
+		{replication.ModeAsync, replication.Acks{Local: true}},
+		{replication.ModeAny, replication.Acks{Replicas: 1, Hints: true}},
+	}
+
+	for _, test := range tests {
+		if acks := test.mode.Acks(3, 2); acks != test.want {
+			t.Errorf("%s: Acks = %+v, want %+v", test.mode, acks, test.want)
+		}
+	}
+}
+
+func TestDurability(t *testing.T) {
+	failed := errors.New("connection refused")
+	tests := []struct {
+		name               string
+		acks               replication.Acks
+		replicated, hinted int
+		err                error
+		want               string
+	}{
+		{"quorum reached", replication.Acks{Replicas: 2}, 2, 0, nil, replication.DurabilityReplicated},
+		{"hints do not count", replication.Acks{Replicas: 2}, 1, 1, failed, replication.DurabilityFailed},
+		{"any on a hint", replication.Acks{Replicas: 1, Hints: true}, 0, 1, failed, replication.DurabilityHinted},
+		{"any on a replica", replication.Acks{Replicas: 1, Hints: true}, 1, 0, nil, replication.DurabilityReplicated},
+		{"any without hints", replication.Acks{Replicas: 1, Hints: true}, 0, 0, failed, replication.DurabilityFailed},
+		{"async written", replication.Acks{Local: true}, 1, 0, nil, replication.DurabilityAccepted},
+		{"async failed", replication.Acks{Local: true}, 0, 0, failed, replication.DurabilityFailed},
+	}
+
+	for _, test := range tests {
+		if got := test.acks.Durability(test.replicated, test.hinted, test.err); got != test.want {
+			t.Errorf("%s: Durability = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAcksCoordinated(t *testing.T) {
+	async := replication.ModeAsync.Acks(3, 2)
+	if acks := async.Coordinated(true); acks != async {
+		t.Errorf("A replica coordinating an async write waits for %+v, want its own write", acks)
+	}
+
+	// a coordinator that is not a replica waits for the write to be stored somewhere
+	acks := async.Coordinated(false)
+	if acks != (replication.Acks{Replicas: 1, Hints: true}) {
+		t.Fatalf("A coordinator that is not a replica waits for %+v", acks)
+	}
+	failed := errors.New("connection refused")
+	if got := acks.Durability(0, 0, failed); got != replication.DurabilityFailed {
+		t.Errorf("An async write stored nowhere is %q, want failed", got)
+	}
+	if got := acks.Durability(0, 1, failed); got != replication.DurabilityHinted {
+		t.Errorf("An async write only hinted is %q, want hinted", got)
+	}
+	if got := acks.Durability(1, 0, nil); got != replication.DurabilityReplicated {
+		t.Errorf("An async write stored on a replica is %q, want replicated", got)
+	}
+
+	quorum := replication.ModeQuorum.Acks(3, 2)
+	if quorum.Coordinated(false) != quorum {
+		t.Errorf("The coordinator changed the acknowledgements of a quorum write")
+	}
+}
@@ -0,0 +1,98 @@
+package replication
+
+import (
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/sharding"
+	"slices"
+)
+
+// Push writes a key directly on a replica shard, without any further replication.
+type Push func(shard int, item db.KeyValue) error
+
+// Repair pushes every local key the current shard is a replica for to the other replicas of the key,
+// so replicas that missed writes catch up. It returns the number of keys pushed to at least one replica.
+func Repair(datastore db.Database, sharder sharding.Sharder, shards *config.Shards, replicationFactor int, push Push) (int, error) {
+	items, err := datastore.Scan("", 0)
+	if err != nil {
+		return 0, err
+	}
+
+	repaired := 0
+	var lastErr error
+
+	for _, item := range items {
+		replicas, err := sharder.GetNReplicas(item.Key, replicationFactor)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if !slices.Contains(replicas, shards.CurrIdx) {
+			continue
+		}
+
+		pushed := false
+		for _, replica := range replicas {
+			if replica == shards.CurrIdx {
+				continue
+			}
+
+			if err = push(replica, item); err != nil {
+				lastErr = err
+				continue
+			}
+			pushed = true
+		}
+
+		if pushed {
+			repaired++
+		}
+	}
+
+	return repaired, lastErr
+}
+
+// Rebalance moves every local key the current shard is no longer a replica for to the replicas of the key.
+// A key is deleted locally only after all its replicas received it. It returns the number of keys moved.
+func Rebalance(datastore db.Database, sharder sharding.Sharder, shards *config.Shards, replicationFactor int, push Push) (int, error) {
+	items, err := datastore.Scan("", 0)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	var lastErr error
+
+	for _, item := range items {
+		replicas, err := sharder.GetNReplicas(item.Key, replicationFactor)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if slices.Contains(replicas, shards.CurrIdx) {
+			continue
+		}
+
+		failed := false
+		for _, replica := range replicas {
+			if err = push(replica, item); err != nil {
+				lastErr = err
+				failed = true
+			}
+		}
+
+		if failed {
+			continue
+		}
+
+		if err = datastore.DeleteKey(item.Key); err != nil {
+			lastErr = err
+			continue
+		}
+		moved++
+	}
+
+	return moved, lastErr
+}
@@ -0,0 +1,85 @@
+package replication_test
+
+import (
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/replication"
+	"os"
+	"testing"
+)
+
+// staticSharder places every key on the replicas listed for it.
+type staticSharder map[string][]int
+
+func (s staticSharder) Index(key string) int {
+	return s[key][0]
+}
+
+func (s staticSharder) GetNReplicas(key string, count int) ([]int, error) {
+	return s[key][:count], nil
+}
+
+func createDb(t testing.TB, values map[string]string) db.Database {
+	t.Helper()
+
+	f, err := os.CreateTemp(os.TempDir(), "kvdb")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	name := f.Name()
+	f.Close()
+	t.Cleanup(func() { os.Remove(name) })
+
+	database, closeFunc, err := db.NewBoltDatabase(name, db.BoltOptions{})
+	if err != nil {
+		t.Fatalf("Could not create a new database: %v", err)
+	}
+	t.Cleanup(func() { closeFunc() })
+
+	for key, value := range values {
+		if err = database.SetKey(key, []byte(value)); err != nil {
+			t.Fatalf("SetKey(%q) failed: %v", key, err)
+		}
+	}
+
+	return database
+}
+
+func TestRepairAndRebalance(t *testing.T) {
+	database := createDb(t, map[string]string{"owned": "a", "moved": "b"})
+	sharder := staticSharder{
+		"owned": {0, 1},
+		"moved": {1, 2},
+	}
+	shards := &config.Shards{Count: 3, CurrIdx: 0}
+
+	pushed := make(map[int][]string)
+	push := func(shard int, item db.KeyValue) error {
+		pushed[shard] = append(pushed[shard], item.Key)
+		return nil
+	}
+
+	repaired, err := replication.Repair(database, sharder, shards, 2, push)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if repaired != 1 || len(pushed[1]) != 1 || pushed[1][0] != "owned" {
+		t.Errorf("Unexpected repair: repaired %d keys, pushed %v", repaired, pushed)
+	}
+
+	pushed = make(map[int][]string)
+	moved, err := replication.Rebalance(database, sharder, shards, 2, push)
+	if err != nil {
+		t.Fatalf("Rebalance failed: %v", err)
+	}
+	if moved != 1 || len(pushed[1]) != 1 || len(pushed[2]) != 1 {
+		t.Errorf("Unexpected rebalance: moved %d keys, pushed %v", moved, pushed)
+	}
+
+	if value, _ := database.GetKey("moved"); value != nil {
+		t.Errorf("The moved key should be deleted locally, got %q", value)
+	}
+	if value, _ := database.GetKey("owned"); string(value) != "a" {
+		t.Errorf("The owned key should be kept, got %q", value)
+	}
+}
@@ -1,122 +1,536 @@
 package replication
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/EliriaT/distributed-store/config"
 	"github.com/EliriaT/distributed-store/db"
+	"github.com/EliriaT/distributed-store/logging"
+	"github.com/EliriaT/distributed-store/metrics"
+	"github.com/EliriaT/distributed-store/namespace"
 	"github.com/EliriaT/distributed-store/sharding"
+	"github.com/EliriaT/distributed-store/tracing"
 	"github.com/madalv/conalg/caesar"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"net"
 	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const batchTimeout = 60 * time.Second
 const maxBatchSize = 100
 
-// OrderedReplicator uses the caesar consensus module for guaranteeing an order for set replicated commands
+// maxPendingApplies bounds the delivered commands waiting for the applier, and maxInFlight the commands the node
+// proposed that were not applied yet.
+const maxPendingApplies = 1024
+const maxInFlight = 1024
+
+// ErrReplicatorClosed fails the barriers of linearizable reads once the node is stopping.
+var ErrReplicatorClosed = errors.New("the ordered replicator is closed")
+
+// ErrBusy fails a proposal when the node has maxInFlight proposals not applied yet for the whole write timeout.
+var ErrBusy = errors.New("too many ordered commands in flight")
+
+// errNotDelivered gives up a proposal the consensus module did not deliver within the write timeout.
+var errNotDelivered = errors.New("the ordered command was not delivered in time")
+
+// errNoConsensus fails the proposals made before the consensus module is set.
+var errNoConsensus = errors.New("consensus module not started")
+
+// delivery is a command delivered by the consensus module, numbered in the order of the deliveries.
+type delivery struct {
+	index   uint64
+	command command
+	// local reports whether the current shard replicates the key of a write
+	local bool
+}
+
+// OrderedReplicator uses the caesar consensus module for guaranteeing an order for set replicated commands.
+// The commands are applied by a single goroutine, in the order the consensus module delivered them.
 type OrderedReplicator struct {
-	conalg            caesar.Conalg
-	db                db.Database
-	shards            *config.Shards
-	sharder           sharding.Sharder
-	batchQueue        []db.SetCommand
-	maxBatchSize      uint8
-	currBatchSize     int
-	replicationFactor int
-	timer             *time.Timer
-	batchUpdated      chan struct{}
+	conalg     caesar.Conalg
+	namespaces *namespace.Registry
+	shards     *config.Shards
+	sharder    sharding.Sharder
+	// applies carries the delivered commands to the applier. It is bounded, so a slow applier holds back the
+	// consensus module, and deliverMu keeps the commands in it in the order of their index.
+	applies   chan delivery
+	deliverMu sync.Mutex
+	delivered uint64
+	// batchQueue, currBatchSize, timer and last, the index of the last command applied, belong to the applier
+	batchQueue    []db.SetCommand
+	maxBatchSize  uint8
+	currBatchSize int
+	timer         *time.Timer
+	last          uint64
+	// applied is the index of the last delivered command written, or needing no write on the node
+	applied atomic.Uint64
+	// pending and pendingSince, in unix nanoseconds, describe the delivered commands not written yet
+	pending      atomic.Int64
+	pendingSince atomic.Int64
+	// failure is the first failed batch write, after which the applier stops applying
+	failureMu sync.Mutex
+	failure   error
+	// closing stops the applier, which closes closed once the last batch is written
+	stopped   atomic.Bool
+	closing   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	// proposals holds the commands the node proposed that were not applied yet, and slots bounds their number,
+	// holding back the proposals when the node lags for up to timeout, which also bounds their delivery
+	proposalsMu sync.Mutex
+	proposals   map[string]proposal
+	slots       chan struct{}
+	timeout     time.Duration
+}
+
+// proposal is a command the node proposed, with the channel of the read waiting for a barrier, and the timer giving
+// it up when it is not delivered in time.
+type proposal struct {
+	done  chan error
+	timer *time.Timer
 }
 
+// DetermineConflict reports whether one command writes a key the other reads or writes, comparing the key ranges
+// they declare. Two barriers never conflict, as reads commute. It reads the commands without copying them, and
+// a command it cannot read conflicts with every other, so that it is never reordered.
 func (r *OrderedReplicator) DetermineConflict(c1, c2 []byte) bool {
-	var command1, command2 db.SetCommand
-	err := json.Unmarshal(c1, &command1)
+	header1, err := readHeader(c1)
 	if err != nil {
-		return false
+		return true
 	}
-	err = json.Unmarshal(c2, &command2)
+	header2, err := readHeader(c2)
 	if err != nil {
-		return false
+		return true
 	}
+	return header1.conflicts(&header2)
+}
 
-	return command1.Key == command2.Key
+func namespaceName(command db.SetCommand) string {
+	if command.Namespace == "" {
+		return config.DefaultNamespace
+	}
+	return command.Namespace
 }
 
+// Execute hands a command delivered by the consensus module to the applier. The consensus module calls it from
+// many goroutines, and it blocks while the applier is behind by maxPendingApplies commands.
 func (r *OrderedReplicator) Execute(c []byte) {
-	var command db.SetCommand
-	err := json.Unmarshal(c, &command)
+	proposed, err := decodeCommand(c)
 	if err != nil {
+		slog.Warn("Dropped an ordered command", "error", err)
 		return
 	}
 
-	shards, err := r.sharder.GetNReplicas(command.Key, r.replicationFactor)
-	if err != nil {
+	if r.stopped.Load() {
+		// the node is stopping, a repair brings the key back once it runs again
+		slog.Warn("Dropped an ordered command, the replicator is closed", "key", proposed.Key)
+		r.drop(proposed.ID, ErrReplicatorClosed)
 		return
 	}
 
-	if slices.Contains(shards, r.shards.CurrIdx) {
-		log.Printf("On Node %d, added to ordered queue command SET key = %s, value = %s", r.shards.CurrIdx, command.Key, command.Value)
-		r.batchQueue = append(r.batchQueue, command)
-		r.currBatchSize++
-		r.batchUpdated <- struct{}{}
+	var local bool
+	if !proposed.Barrier {
+		local = r.replicates(proposed.SetCommand)
+	}
+	if local && r.pending.Add(1) == 1 {
+		r.pendingSince.Store(time.Now().UnixNano())
 	}
+
+	r.deliverMu.Lock()
+	defer r.deliverMu.Unlock()
+
+	r.delivered++
+	select {
+	case r.applies <- delivery{index: r.delivered, command: proposed, local: local}:
+	case <-r.closing:
+		slog.Warn("Dropped an ordered command, the replicator is closed", "key", proposed.Key)
+		r.drop(proposed.ID, ErrReplicatorClosed)
+	}
+}
+
+// replicates reports whether the current shard is a replica of the key of the command.
+func (r *OrderedReplicator) replicates(command db.SetCommand) bool {
+	ns, err := r.namespaces.Get(command.Namespace)
+	if err != nil {
+		slog.Warn("Dropped an ordered command", "error", err)
+		return false
+	}
+
+	shards, err := r.sharder.GetNReplicas(command.Key, ns.ReplicationFactor)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(shards, r.shards.CurrIdx)
 }
 
-func (r *OrderedReplicator) executeBatchWhenTimeoutOrBatchLimitReached() {
+// apply applies the delivered commands one after the other, writing them in batches.
+func (r *OrderedReplicator) apply() {
+	defer close(r.closed)
+
 	for {
 		select {
+		case <-r.closing:
+			// the commands delivered before the close are still written
+			for {
+				select {
+				case delivered := <-r.applies:
+					r.applyDelivery(delivered)
+				default:
+					r.flush()
+					return
+				}
+			}
+		case delivered := <-r.applies:
+			r.applyDelivery(delivered)
 		case <-r.timer.C:
 			r.timer.Reset(batchTimeout)
-			r.executeBatchWrite()
-		case <-r.batchUpdated:
-			if r.currBatchSize >= int(r.maxBatchSize) {
-				r.timer.Reset(batchTimeout)
-				r.executeBatchWrite()
-			}
+			r.flush()
+		}
+	}
+}
+
+// applyDelivery queues a write of a key the node replicates, and writes the queued commands for a barrier the node
+// proposed before releasing the read waiting for it. The barriers proposed by the other nodes need nothing from this
+// one. After a failed write, the commands are dropped.
+func (r *OrderedReplicator) applyDelivery(delivered delivery) {
+	command := delivered.command
+	if err := r.Err(); err != nil {
+		r.drop(command.ID, err)
+		return
+	}
+
+	r.last = delivered.index
+	done, _ := r.take(command.ID)
+	switch {
+	case command.Barrier:
+		if done != nil {
+			done <- r.flush()
+		}
+	case delivered.local:
+		if command.Delete {
+			logging.Sampled(context.Background(), "Queued an ordered delete", "key", command.Key)
+		} else {
+			logging.Sampled(context.Background(), "Queued an ordered set", "key", command.Key, logging.Value(command.Value))
+		}
+		r.batchQueue = append(r.batchQueue, command.SetCommand)
+		r.currBatchSize++
+		metrics.SetReplicatorQueueDepth(len(r.batchQueue))
+		if r.currBatchSize >= int(r.maxBatchSize) {
+			r.timer.Reset(batchTimeout)
+			r.flush()
 		}
 	}
+
+	if len(r.batchQueue) == 0 && r.Err() == nil {
+		r.setApplied(r.last)
+	}
+}
+
+// flush writes the queued commands, and stops the applier when the write fails, so that no later command is
+// written before them.
+func (r *OrderedReplicator) flush() error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	err := r.executeBatchWrite()
+	if err != nil {
+		slog.Error("Stopped applying the ordered commands, a batch write failed", "commands", len(r.batchQueue), "error", err)
+		r.failureMu.Lock()
+		r.failure = err
+		r.failureMu.Unlock()
+		return err
+	}
+	r.setApplied(r.last)
+	return nil
+}
+
+func (r *OrderedReplicator) setApplied(index uint64) {
+	r.applied.Store(index)
+	metrics.SetReplicatorAppliedIndex(index)
 }
 
-func (r *OrderedReplicator) executeBatchWrite() {
-	err := r.db.WriteInBatch(r.batchQueue)
+// executeBatchWrite writes the queued commands, grouped by namespace.
+func (r *OrderedReplicator) executeBatchWrite() error {
+	if len(r.batchQueue) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	// the batch mixes the commands of many requests, so it starts a trace of its own
+	_, span := tracing.Start(context.Background(), "replicator batch flush", trace.WithAttributes(attribute.Int("commands", len(r.batchQueue))))
+
+	batches := make(map[string][]db.SetCommand)
+	for _, command := range r.batchQueue {
+		batches[namespaceName(command)] = append(batches[namespaceName(command)], command)
+	}
+
+	var err error
+	for name, batch := range batches {
+		// the namespace exists, Execute queued only the commands of known namespaces
+		ns, _ := r.namespaces.Get(name)
+		if err = ns.DB.WriteInBatch(batch); err != nil {
+			break
+		}
+	}
+
 	if err == nil {
-		log.Printf("On Node %d, succesfully syncronised batch %v", r.shards.CurrIdx, r.batchQueue)
+		slog.Debug("Wrote an ordered batch", "commands", len(r.batchQueue))
+		since := r.pendingSince.Load()
+		if r.pending.Add(-int64(len(r.batchQueue))) == 0 {
+			// a command delivered meanwhile keeps the time it set
+			r.pendingSince.CompareAndSwap(since, 0)
+		}
 		r.batchQueue = make([]db.SetCommand, 0, r.maxBatchSize)
 		r.currBatchSize = 0
 	}
+
+	tracing.End(span, err)
+	metrics.SetReplicatorQueueDepth(len(r.batchQueue))
+	metrics.ObserveReplicatorFlush(time.Since(start))
+	return err
+}
+
+// take forgets a command the node proposed, once applied or given up, releasing its slot. It returns the channel
+// of the read waiting for a barrier, and false when the node did not propose the command.
+func (r *OrderedReplicator) take(id string) (chan error, bool) {
+	if id == "" {
+		return nil, false
+	}
+
+	r.proposalsMu.Lock()
+	defer r.proposalsMu.Unlock()
+
+	proposed, ok := r.proposals[id]
+	if ok {
+		delete(r.proposals, id)
+		proposed.timer.Stop()
+		<-r.slots
+	}
+	return proposed.done, ok
+}
+
+// drop fails a command the node proposed that will not be applied.
+func (r *OrderedReplicator) drop(id string, err error) {
+	if done, _ := r.take(id); done != nil {
+		done <- err
+	}
+}
+
+// Err returns the failed batch write that stopped the applier, or nil.
+func (r *OrderedReplicator) Err() error {
+	r.failureMu.Lock()
+	defer r.failureMu.Unlock()
+	return r.failure
+}
+
+// Applied returns the index of the last delivered command the node applied. A command delivered earlier is written
+// to the database, or does not concern the node.
+func (r *OrderedReplicator) Applied() uint64 {
+	return r.applied.Load()
+}
+
+// Close stops queueing ordered commands and writes the queued ones. It returns ctx.Err() when ctx is done first.
+// The consensus module has no way to be stopped, so it keeps running until the process exits.
+func (r *OrderedReplicator) Close(ctx context.Context) error {
+	r.closeOnce.Do(func() {
+		r.stopped.Store(true)
+		close(r.closing)
+	})
+
+	select {
+	case <-r.closed:
+		if pending, _ := r.Lag(); pending > 0 {
+			if err := r.Err(); err != nil {
+				return fmt.Errorf("%d ordered commands could not be written: %w", pending, err)
+			}
+			return fmt.Errorf("%d ordered commands could not be written", pending)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (r *OrderedReplicator) SetConalgModule(m caesar.Conalg) {
 	r.conalg = m
 }
 
-func (r *OrderedReplicator) Replicate(key string, value string) {
+// Ready returns an error when the consensus module is not set or does not accept connections, or when the
+// ordered commands stopped being applied.
+func (r *OrderedReplicator) Ready() error {
+	if r.conalg == nil {
+		return errors.New("consensus module not started")
+	}
+	if err := r.Err(); err != nil {
+		return fmt.Errorf("ordered commands not applied after a failed write: %w", err)
+	}
+
+	module, ok := r.conalg.(*caesar.Caesar)
+	if !ok {
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", module.Cfg.Port, time.Second)
+	if err != nil {
+		return fmt.Errorf("consensus module not listening on %s: %w", module.Cfg.Port, err)
+	}
+	return conn.Close()
+}
+
+// Lag returns the number of ordered commands the node queued but did not write yet, and how long the oldest one waits.
+func (r *OrderedReplicator) Lag() (pending int, lag time.Duration) {
+	pending = int(r.pending.Load())
+	if since := r.pendingSince.Load(); since > 0 {
+		lag = time.Since(time.Unix(0, since))
+	}
+	return pending, lag
+}
+
+// Replicate orders a set of the key together with the commands touching the same key. It waits while the node
+// has maxInFlight proposals not applied yet, and drops the command when ctx is done or the write timeout passes first.
+func (r *OrderedReplicator) Replicate(ctx context.Context, namespace, key string, value []byte) {
+	command := db.SetCommand{
+		Key:       key,
+		Value:     value,
+		Namespace: namespace,
+	}
+	r.replicate(ctx, command)
+}
+
+// ReplicateDelete orders a delete of the key together with the set commands touching the same key.
+func (r *OrderedReplicator) ReplicateDelete(ctx context.Context, namespace, key string) {
 	command := db.SetCommand{
-		Key:   key,
-		Value: value,
+		Key:       key,
+		Delete:    true,
+		Namespace: namespace,
 	}
-	payload, _ := json.Marshal(command)
+	r.replicate(ctx, command)
+}
+
+func (r *OrderedReplicator) replicate(ctx context.Context, write db.SetCommand) {
+	id, err := proposalID()
+	if err == nil {
+		err = r.propose(ctx, command{SetCommand: write, ID: id, Writes: []keyRef{keyOf(write.Namespace, write.Key)}}, nil)
+	}
+	if err != nil {
+		// the write still reaches the replicas directly, and a repair orders it again
+		slog.WarnContext(ctx, "Dropped an ordered command", "key", write.Key, "error", err)
+	}
+}
+
+// Barrier proposes a barrier on the key and waits for the node to execute it, after every write of the key ordered
+// before it, and to write these writes. A read of the key done after Barrier returns is linearizable.
+func (r *OrderedReplicator) Barrier(ctx context.Context, namespace, key string) error {
+	if r.conalg == nil {
+		return errNoConsensus
+	}
+	if r.stopped.Load() {
+		return ErrReplicatorClosed
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	id, err := proposalID()
+	if err != nil {
+		return err
+	}
+	barrier := command{
+		SetCommand: db.SetCommand{Key: key, Namespace: namespace},
+		ID:         id,
+		Barrier:    true,
+		Reads:      []keyRef{keyOf(namespace, key)},
+	}
+
+	ctx, span := tracing.Start(ctx, "consensus barrier", trace.WithAttributes(attribute.String("namespace", namespaceName(barrier.SetCommand))))
+	done := make(chan error, 1)
+	if err = r.propose(ctx, barrier, done); err == nil {
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+			r.take(id)
+		}
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// propose hands the command to the consensus module once the node has a slot for it. It waits for a slot for up to
+// the write timeout, failing with ErrBusy. A command not delivered within the write timeout is given up, freeing its
+// slot, and done, which receives the error of a barrier, receives errNotDelivered.
+func (r *OrderedReplicator) propose(ctx context.Context, proposed command, done chan error) error {
+	_, span := tracing.Start(ctx, "consensus propose", trace.WithAttributes(
+		attribute.String("namespace", namespaceName(proposed.SetCommand)),
+		attribute.Bool("delete", proposed.Delete),
+		attribute.Bool("barrier", proposed.Barrier),
+	))
+	defer span.End()
+
+	if r.conalg == nil {
+		return errNoConsensus
+	}
+
+	busy := time.NewTimer(r.timeout)
+	defer busy.Stop()
 
-	r.conalg.Propose(payload)
+	select {
+	case r.slots <- struct{}{}:
+	case <-busy.C:
+		return ErrBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.closing:
+		return ErrReplicatorClosed
+	}
+
+	r.proposalsMu.Lock()
+	r.proposals[proposed.ID] = proposal{done: done, timer: time.AfterFunc(r.timeout, func() {
+		slog.Warn("Gave up an ordered command not delivered in time", "key", proposed.Key, "barrier", proposed.Barrier)
+		r.drop(proposed.ID, errNotDelivered)
+	})}
+	r.proposalsMu.Unlock()
+
+	r.conalg.Propose(proposed.encode())
+	return nil
+}
+
+// proposalID returns a random identifier for a proposal of the node.
+func proposalID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
 }
 
-func NewOrderedReplicator(datastore db.Database, shards *config.Shards, cfg config.Config) *OrderedReplicator {
+func NewOrderedReplicator(namespaces *namespace.Registry, shards *config.Shards, cfg config.Config) *OrderedReplicator {
 	batchSize := maxBatchSize
 	orderedReplicator := &OrderedReplicator{
-		db:                datastore,
-		shards:            shards,
-		sharder:           sharding.NewConsistentHasher(cfg),
-		maxBatchSize:      uint8(batchSize),
-		currBatchSize:     0,
-		batchQueue:        make([]db.SetCommand, 0, batchSize),
-		replicationFactor: cfg.ReplicationFactor,
-		timer:             time.NewTimer(batchTimeout),
-		batchUpdated:      make(chan struct{}, 500),
-	}
-
-	go func() {
-		orderedReplicator.executeBatchWhenTimeoutOrBatchLimitReached()
-	}()
+		namespaces:    namespaces,
+		shards:        shards,
+		sharder:       sharding.NewConsistentHasher(cfg),
+		applies:       make(chan delivery, maxPendingApplies),
+		maxBatchSize:  uint8(batchSize),
+		currBatchSize: 0,
+		batchQueue:    make([]db.SetCommand, 0, batchSize),
+		timer:         time.NewTimer(batchTimeout),
+		closing:       make(chan struct{}),
+		closed:        make(chan struct{}),
+		proposals:     make(map[string]proposal),
+		slots:         make(chan struct{}, maxInFlight),
+		timeout:       cfg.Timeouts.WithDefaults().Write,
+	}
+
+	go orderedReplicator.apply()
 
 	return orderedReplicator
 }
@@ -0,0 +1,51 @@
+package replication_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/namespace"
+	"github.com/EliriaT/distributed-store/replication"
+	"testing"
+)
+
+func TestCloseFlushesTheBatch(t *testing.T) {
+	cfg := config.Config{ReplicationFactor: 1, ConsistencyLevel: 1, Shards: []config.Shard{{Idx: 0, Name: "Chisinau"}}}
+	database := createDb(t, nil)
+	namespaces, err := namespace.NewRegistry(database, cfg)
+	if err != nil {
+		t.Fatalf("Could not open the namespaces: %v", err)
+	}
+
+	replicator := replication.NewOrderedReplicator(namespaces, &config.Shards{Count: 1, CurrIdx: 0}, cfg)
+
+	command := legacyCommand("utm", "fcim", false)
+	replicator.Execute(command)
+	if pending, _ := replicator.Lag(); pending != 1 {
+		t.Fatalf("Got %d pending commands, want 1", pending)
+	}
+
+	if err := replicator.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if pending, _ := replicator.Lag(); pending != 0 {
+		t.Errorf("Got %d pending commands after Close, want 0", pending)
+	}
+
+	ns, _ := namespaces.Get("")
+	if value, err := ns.DB.GetKey("utm"); err != nil || string(value) != "fcim" {
+		t.Errorf("The queued command was not written: %q, %v", value, err)
+	}
+
+	command = legacyCommand("usm", "math", false)
+	replicator.Execute(command)
+	if pending, _ := replicator.Lag(); pending != 0 {
+		t.Errorf("A command was queued after Close")
+	}
+}
+
+// legacyCommand returns a command as the nodes predating the envelope proposed it, JSON with the value as a string.
+func legacyCommand(key, value string, delete bool) []byte {
+	command, _ := json.Marshal(map[string]any{"Key": key, "Value": value, "Delete": delete})
+	return command
+}
@@ -0,0 +1,128 @@
+// Package tracing sets up the OpenTelemetry tracing of a node. The spans of a request follow it from the
+// coordinator to the replicas, the trace context travelling in the W3C traceparent header of the peer requests.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EliriaT/distributed-store/config"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"net/http"
+	"os"
+)
+
+const (
+	serviceName = "distributed-store"
+	tracerName  = "github.com/EliriaT/distributed-store"
+)
+
+// Init installs the exporter of the config as the global tracer provider, keeping the configured ratio of the
+// traces the node starts. The trace context of incoming requests is always propagated, even when the node
+// exports nothing. The returned function flushes the spans not exported yet.
+func Init(ctx context.Context, cfg config.Tracing, shard string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !cfg.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch cfg.Exporter {
+	case "otlp":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	case "file":
+		file, err = os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("opening the trace file: %w", err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		err = fmt.Errorf("unsupported exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating the %s exporter: %w", cfg.Exporter, err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(serviceName),
+			semconv.ServiceInstanceID(shard),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span of the node.
+func Start(ctx context.Context, name string, attributes ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, attributes...)
+}
+
+// End marks the span as failed when err is not nil and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Detach returns a context carrying the values of ctx, its span among them, but not its deadline or cancellation,
+// for the work that goes on after the request is answered, like the writes to the replicas past the consistency level.
+func Detach(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
+
+// Handler starts a span for every request served by the handler, continuing the trace of the caller.
+// The spans are named after the request path.
+func Handler(next http.Handler, server string) http.Handler {
+	return otelhttp.NewHandler(next, server, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return server + " " + r.URL.Path
+	}))
+}
+
+// Transport starts a span for every request sent through base and passes the trace context along.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
+
+// ServerOption starts a span for every call served by a gRPC server, continuing the trace of the caller.
+func ServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler())
+}
+
+// DialOption starts a span for every call sent on a gRPC connection and passes the trace context along.
+func DialOption() grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler())
+}
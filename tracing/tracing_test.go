@@ -0,0 +1,65 @@
+package tracing_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/EliriaT/distributed-store/config"
+	"github.com/EliriaT/distributed-store/tracing"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPropagation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := tracing.Init(context.Background(), config.Tracing{Exporter: "file", File: file}, "Chisinau")
+	if err != nil {
+		t.Fatalf("Could not set up tracing: %v", err)
+	}
+
+	replica := httptest.NewServer(tracing.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), "internal"))
+	defer replica.Close()
+
+	ctx, span := tracing.Start(context.Background(), "coordinator")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, replica.URL+"/internal/set?key=utm", nil)
+	resp, err := (&http.Client{Transport: tracing.Transport(http.DefaultTransport)}).Do(req)
+	if err != nil {
+		t.Fatalf("Could not call the replica: %v", err)
+	}
+	resp.Body.Close()
+	span.End()
+
+	if err = shutdown(context.Background()); err != nil {
+		t.Fatalf("Could not flush the spans: %v", err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("Could not open the trace file: %v", err)
+	}
+	defer f.Close()
+
+	traces := make(map[string]string)
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	for decoder.More() {
+		var exported struct {
+			Name        string
+			SpanContext struct{ TraceID string }
+		}
+		if err := decoder.Decode(&exported); err != nil {
+			t.Fatalf("Could not decode a span: %v", err)
+		}
+		traces[exported.Name] = exported.SpanContext.TraceID
+	}
+
+	coordinator := traces["coordinator"]
+	if coordinator == "" {
+		t.Fatalf("The coordinator span was not exported: %v", traces)
+	}
+	if got := traces["internal /internal/set"]; got != coordinator {
+		t.Errorf("The replica span is not in the trace of the coordinator: got %q, want %q (%v)", got, coordinator, traces)
+	}
+}